@@ -16,10 +16,12 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/abates/cli"
@@ -28,14 +30,15 @@ import (
 	"github.com/abates/insteon/plm"
 	"github.com/abates/insteon/util"
 	"github.com/kirsle/configdir"
-	"github.com/tarm/serial"
 )
 
 var (
-	modem *plm.PLM = &plm.PLM{}
-	db    util.Database
+	modem   *plm.PLM
+	db      util.Database
+	capture *os.File
 
 	serialPortFlag string
+	captureFlag    string
 	timeoutFlag    time.Duration
 	writeDelayFlag time.Duration
 	ttlFlag        int
@@ -50,12 +53,13 @@ var (
 
 func init() {
 	app.SetOutput(os.Stderr)
-	app.Flags.StringVar(&serialPortFlag, "port", "/dev/ttyUSB0", "serial port connected to a PLM")
+	app.Flags.StringVar(&serialPortFlag, "port", "/dev/ttyUSB0", "serial port, tcp://host:port or http://hub:port connected to a PLM")
+	app.Flags.StringVar(&captureFlag, "capture", "", "record all traffic to and from the PLM in the given capture file (pcapng if the name ends in .pcapng)")
 	app.Flags.BoolVar(&logFlag, "log", false, "Log insteon traffic")
 	app.Flags.BoolVar(&debugFlag, "debug", false, "Set debug logging")
 	app.Flags.BoolVar(&debugFlag, "quietFlag", false, "Log nothing")
 	app.Flags.DurationVar(&timeoutFlag, "timeout", 3*time.Second, "read/write timeout duration")
-	app.Flags.DurationVar(&writeDelayFlag, "writeDelay", 0, "writeDelay duration (default of 0 indicates to compute wait time based on message length and ttl)")
+	app.Flags.DurationVar(&writeDelayFlag, "writeDelay", 0, "minimum delay before sending each message (messages are otherwise delayed until earlier messages clear the network, based on their length and ttl)")
 	app.Flags.IntVar(&ttlFlag, "ttl", 3, "default ttl for sending Insteon messages")
 
 	configDir = configdir.LocalConfig("go-insteon")
@@ -80,15 +84,36 @@ func run() error {
 		return err
 	}
 
-	c := &serial.Config{
-		Name: serialPortFlag,
-		Baud: 19200,
-	}
+	openPort := func() (io.ReadWriter, error) { return plm.OpenPort(serialPortFlag) }
+	if captureFlag != "" {
+		capture, err = os.Create(captureFlag)
+		if err != nil {
+			return fmt.Errorf("error creating capture: %v", err)
+		}
+
+		var recorder plm.RecordWriter
+		if strings.HasSuffix(captureFlag, ".pcapng") {
+			recorder, err = plm.NewPcapngWriter(capture)
+		} else {
+			recorder, err = plm.NewCaptureWriter(capture)
+		}
 
-	s, err := serial.OpenPort(c)
+		if err != nil {
+			return fmt.Errorf("error creating capture: %v", err)
+		}
+
+		openPort = func() (io.ReadWriter, error) {
+			port, err := plm.OpenPort(serialPortFlag)
+			if err != nil {
+				return nil, err
+			}
+			return plm.Record(port, recorder), nil
+		}
+	}
 
+	s, err := openPort()
 	if err != nil {
-		return fmt.Errorf("error opening serial port: %v", err)
+		return fmt.Errorf("error opening port: %v", err)
 	}
 
 	db, err = util.NewFileDB(dbfile)
@@ -96,16 +121,22 @@ func run() error {
 		log.Fatalf("Failed to load database: %v", err)
 	}
 
-	*modem = *plm.New(s, plm.Timeout(timeoutFlag), plm.WriteDelay(writeDelayFlag))
+	reconnect := plm.Reconnect(openPort)
+	modem = plm.New(s, plm.Timeout(timeoutFlag), plm.WriteDelay(writeDelayFlag), reconnect)
 	return nil
 }
 
 func open(modem *plm.PLM, addr insteon.Address, askLink bool) (*devices.BasicDevice, error) {
 	filters := []devices.Filter{}
+	retry := devices.DefaultRetryPolicy
+	retry.Retries = 2
 	if logFlag {
 		filters = append(filters, util.Snoop(os.Stdout, db))
+		retry.OnRetry = func(event devices.RetryEvent) {
+			fmt.Printf("%v: %v, retry %d in %v\n", event.Address, event.Err, event.Attempt, event.Delay)
+		}
 	}
-	filters = append(filters, devices.TTL(ttlFlag), devices.RetryFilter(3))
+	filters = append(filters, devices.TTL(ttlFlag), devices.Retry(retry))
 	device, err := db.Open(modem, addr, filters...)
 
 	if err == devices.ErrNotLinked && askLink {
@@ -120,6 +151,18 @@ func open(modem *plm.PLM, addr insteon.Address, askLink bool) (*devices.BasicDev
 
 func main() {
 	_, err := app.Run(os.Args[1:])
+	if modem != nil {
+		modem.Close()
+	}
+
+	// the capture is closed after the port so that nothing is
+	// recorded once it is closed
+	if capture != nil {
+		if cerr := capture.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("error closing capture: %v", cerr)
+		}
+	}
+
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		os.Exit(1)
@@ -15,7 +15,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
 
 	"github.com/abates/cli"
@@ -37,7 +39,6 @@ func (a *addresses) Set(str string) error {
 }
 
 type plmCmd struct {
-	*plm.PLM
 	group     int
 	addresses addresses
 	flag      string
@@ -53,7 +54,7 @@ func init() {
 		}
 	}
 
-	p := &plmCmd{PLM: modem}
+	p := &plmCmd{}
 
 	pc := &cli.Command{
 		Name:        "plm",
@@ -74,6 +75,27 @@ func init() {
 			{Name: "edit", Description: "edit the PLM all-link database", Callback: cli.Callback(p.editCmd)},
 			{Name: "info", Description: "display information (device id, link database, etc)", Callback: cli.Callback(p.infoCmd)},
 			{Name: "reset", Description: "Factory reset the IM", Callback: cli.Callback(p.resetCmd)},
+			{
+				Name:        "backup",
+				UsageStr:    "<file>",
+				Description: "save the PLM info, config and all-link database to a file",
+				Callback:    cli.Callback(p.backupCmd, "<file>"),
+			},
+			{
+				Name:        "restore",
+				UsageStr:    "<file>",
+				Description: "restore the PLM config and all-link database from a backup file",
+				Callback:    cli.Callback(p.restoreCmd, "<file>"),
+			},
+			{
+				Name:        "setcat",
+				UsageStr:    "<category>.<sub-category> <firmware>",
+				Description: "set the device category and firmware version the IM reports to other devices",
+				Callback:    cli.Callback(p.setcatCmd, "<category>", "<firmware>"),
+			},
+			{Name: "sleep", Description: "put the IM's radio to sleep", Callback: cli.Callback(p.sleepCmd)},
+			{Name: "wake", Description: "wake the IM from sleep", Callback: cli.Callback(p.wakeCmd)},
+			{Name: "events", Description: "print button presses and other events reported by the IM", Callback: cli.Callback(p.eventsCmd)},
 			{
 				Name:        "link",
 				Description: "Link the PLM to a device",
@@ -87,14 +109,61 @@ func init() {
 			{
 				Name:        "alllink",
 				UsageStr:    "<group>",
-				Description: "Put the PLM into linking mode for manual linking",
-				Callback:    cli.Callback(p.EnterLinkingMode, "<group id>"),
+				Description: "Put the PLM into linking mode and wait for a device to link",
+				Callback:    cli.Callback(p.alllinkCmd, "<group id>"),
+			},
+			{
+				Name:        "group",
+				UsageStr:    "<group> <cmd1>.<cmd2>",
+				Description: "Send a command to every device linked to one of the PLM's controller groups",
+				Callback:    cli.Callback(p.groupCmd, "<group id>", "<command>"),
+			},
+			{
+				Name:        "batchlink",
+				UsageStr:    "<group> <count>",
+				Description: "Link the PLM, as a controller, to <count> devices as their set buttons are pressed",
+				Callback:    cli.Callback(p.batchlinkCmd, "<group id>", "<count>"),
 			},
 		},
 	}
 	app.SubCommands = append(app.SubCommands, pc)
 }
 
+func (p *plmCmd) alllinkCmd(group insteon.Group) error {
+	log.Printf("Waiting for a device to link...")
+	result, err := modem.Link(plm.LinkEither, group)
+	if err == nil {
+		log.Printf("Linked %v", result)
+	}
+	return err
+}
+
+func (p *plmCmd) batchlinkCmd(group insteon.Group, count int) error {
+	log.Printf("Press the set button on each of the %d devices", count)
+	_, err := modem.LinkDevices(plm.LinkController, group, count, func(result *plm.LinkResult) {
+		log.Printf("Linked %v", result)
+	})
+	return err
+}
+
+func (p *plmCmd) groupCmd(group insteon.Group, cmd cmdVar) error {
+	result, err := modem.SendGroupCommand(group, cmd.Command)
+	if result != nil {
+		for _, addr := range result.Acked {
+			fmt.Printf("%v acknowledged\n", addr)
+		}
+
+		for _, addr := range result.Failed {
+			fmt.Printf("%v failed\n", addr)
+		}
+
+		for _, addr := range result.Unanswered() {
+			fmt.Printf("%v did not answer\n", addr)
+		}
+	}
+	return err
+}
+
 func (p *plmCmd) editCmd() error {
 	return editLinks(modem)
 }
@@ -107,6 +176,110 @@ func (p *plmCmd) resetCmd() (err error) {
 	return err
 }
 
+func (p *plmCmd) backupCmd(filename string) error {
+	backup, err := modem.Backup()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = backup.Write(file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		fmt.Printf("Saved %d links from %v to %s\n", len(backup.Links), backup.Info.Address, filename)
+	}
+	return err
+}
+
+func (p *plmCmd) restoreCmd(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+
+	backup, err := plm.ReadBackup(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	info, err := modem.Info()
+	if err != nil {
+		return err
+	}
+
+	if info.Address != backup.Info.Address {
+		msg := fmt.Sprintf("WARNING: The backup is from %v but this PLM is %v.  Devices linked to %v will need to be linked to %v\nProceed? (y/n) ", backup.Info.Address, info.Address, backup.Info.Address, info.Address)
+		if cli.Query(os.Stdin, os.Stdout, msg, "y", "n") != "y" {
+			return nil
+		}
+	}
+
+	// the capacity of an unknown model is only a guess, so the user
+	// decides whether to go ahead
+	if caps := info.Capabilities(); len(backup.Links) > caps.Capacity {
+		if caps.Model != plm.UnknownCapabilities.Model {
+			return fmt.Errorf("the backup has %d links but the %s only holds %d", len(backup.Links), caps.Model, caps.Capacity)
+		}
+
+		msg := fmt.Sprintf("WARNING: The backup has %d links but the PLM model is unknown and may only hold %d\nProceed? (y/n) ", len(backup.Links), caps.Capacity)
+		if cli.Query(os.Stdin, os.Stdout, msg, "y", "n") != "y" {
+			return nil
+		}
+	}
+
+	result, err := modem.Restore(backup)
+	if result != nil && result.Links != nil {
+		for _, change := range result.Links.Changes {
+			if change.Action != plm.LinkSkipped {
+				fmt.Printf("%v\n", change)
+			}
+		}
+
+		if result.Links.Restored {
+			fmt.Printf("The all-link database could not be rewritten and was put back the way it was\n")
+		}
+	}
+
+	if err == nil {
+		fmt.Printf("Restored %d links to %v\n", len(backup.Links), result.Info.Address)
+	}
+	return err
+}
+
+func (p *plmCmd) setcatCmd(devCat devCatVar, firmware int) error {
+	return modem.SetDeviceCategoryContext(context.Background(), devCat.DevCat, plm.Version(firmware))
+}
+
+func (p *plmCmd) sleepCmd() error {
+	return modem.RFSleep()
+}
+
+func (p *plmCmd) wakeCmd() error {
+	info, err := modem.Wake()
+	if err == nil {
+		fmt.Printf("%v is awake (category %v firmware %v)\n", info.Address, info.DevCat, info.Firmware)
+	}
+	return err
+}
+
+func (p *plmCmd) eventsCmd() error {
+	log.Printf("Waiting for IM events...")
+	sub := modem.SubscribeEvents()
+	defer sub.Unsubscribe()
+	for event := range sub.Events() {
+		log.Printf("%v", event)
+	}
+	return nil
+}
+
 func (p *plmCmd) infoCmd() (err error) {
 	fmt.Printf("PLM Info\n")
 	info, err := modem.Info()
@@ -114,11 +287,25 @@ func (p *plmCmd) infoCmd() (err error) {
 		fmt.Printf("      Address: %s\n", info.Address)
 		fmt.Printf("     Category: %02x Sub-Category: %02x\n", info.DevCat.Domain(), info.DevCat.Category())
 		fmt.Printf("     Firmware: %d\n", info.Firmware)
+		caps := info.Capabilities()
+		fmt.Printf("        Model: %v\n", caps)
+		if caps.Quirks != 0 {
+			fmt.Printf("       Quirks: %v\n", caps.Quirks)
+		}
+
 		var config plm.Config
 		config, err = modem.Config()
 		if err == nil {
 			fmt.Printf("       Config: %v\n", config)
-			err = util.PrintLinkDatabase(os.Stdout, modem)
+			var links []insteon.LinkRecord
+			links, err = modem.Links()
+			if err == nil {
+				fmt.Printf("        Links: %d of %d\n", len(links), caps.Capacity)
+				if caps.Full(len(links)) {
+					fmt.Printf("WARNING: The All-Link database is nearly full\n")
+				}
+				err = util.PrintLinks(os.Stdout, links)
+			}
 		}
 	}
 	return err
@@ -19,6 +19,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/abates/insteon"
 	"github.com/abates/insteon/commands"
 )
 
@@ -69,3 +70,17 @@ func (cmd *cmdVar) Set(str string) error {
 	cmd.Command = commands.Command((c1&0xff)<<8 | c2&0xff)
 	return nil
 }
+
+type devCatVar struct {
+	insteon.DevCat
+}
+
+// Set satisfies the flag.Value interface, the input is the category
+// and sub-category in hex such as 01.20
+func (dc *devCatVar) Set(str string) error {
+	n, err := fmt.Sscanf(str, "%02x.%02x", &dc.DevCat[0], &dc.DevCat[1])
+	if err == nil && n < 2 {
+		err = fmt.Errorf("expected category and sub-category, got %q", str)
+	}
+	return err
+}
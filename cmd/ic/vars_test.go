@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/abates/insteon"
 	"github.com/abates/insteon/commands"
 )
 
@@ -68,3 +69,29 @@ func TestCmdVar(t *testing.T) {
 		})
 	}
 }
+
+func TestDevCatVar(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    insteon.DevCat
+		wantErr bool
+	}{
+		{"dimmer", "01.20", insteon.DevCat{0x01, 0x20}, false},
+		{"hex digits", "0f.a1", insteon.DevCat{0x0f, 0xa1}, false},
+		{"missing sub-category", "01", insteon.DevCat{}, true},
+		{"not hex", "xx.01", insteon.DevCat{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := devCatVar{}
+			err := got.Set(test.input)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if err == nil && test.want != got.DevCat {
+				t.Errorf("Wanted %v got %v", test.want, got.DevCat)
+			}
+		})
+	}
+}
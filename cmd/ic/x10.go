@@ -0,0 +1,56 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+
+	"github.com/abates/cli"
+	"github.com/abates/insteon/plm"
+)
+
+func init() {
+	app.SubCommands = append(app.SubCommands, &cli.Command{
+		Name:        "x10",
+		Description: "Send and receive X10 commands through the PLM",
+		SubCommands: []*cli.Command{
+			{
+				Name:        "send",
+				UsageStr:    "<address> <function>",
+				Description: "send an X10 function (On, Off, Dim, Bright, AllLightsOn, ...) to an address (A1-P16, or A-P for all units)",
+				Callback:    cli.Callback(x10SendCmd, "<address>", "<function>"),
+			},
+			{
+				Name:        "monitor",
+				Description: "print X10 commands received by the PLM",
+				Callback:    cli.Callback(x10MonitorCmd),
+			},
+		},
+	})
+}
+
+func x10SendCmd(addr plm.X10Address, fn plm.X10Function) error {
+	return modem.SendX10(addr, fn)
+}
+
+func x10MonitorCmd() error {
+	log.Printf("Waiting for X10 commands...")
+	sub := modem.SubscribeX10()
+	defer sub.Unsubscribe()
+	for event := range sub.Events() {
+		log.Printf("%v", event)
+	}
+	return nil
+}
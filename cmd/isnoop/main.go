@@ -22,13 +22,13 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/abates/insteon"
 	"github.com/abates/insteon/devices"
 	"github.com/abates/insteon/plm"
 	"github.com/abates/insteon/util"
 	"github.com/kirsle/configdir"
-	"github.com/tarm/serial"
 )
 
 func main() {
@@ -37,25 +37,58 @@ func main() {
 
 	debugFlag := false
 	serialPortFlag := ""
+	captureFlag := ""
+	exportFlag := ""
 
 	flag.BoolVar(&debugFlag, "debug", false, "turn on debug log")
-	flag.StringVar(&serialPortFlag, "port", "/dev/ttyUSB0", "serial port connected to a PLM")
+	flag.StringVar(&serialPortFlag, "port", "/dev/ttyUSB0", "serial port, tcp://host:port or http://hub:port connected to a PLM")
+	flag.StringVar(&captureFlag, "capture", "", "record all traffic to and from the PLM in the given capture file (pcapng if the name ends in .pcapng)")
+	flag.StringVar(&exportFlag, "export", "", "convert the given capture file to pcapng, written to stdout, and exit")
 	flag.Parse()
 
+	if exportFlag != "" {
+		file, err := os.Open(exportFlag)
+		if err != nil {
+			log.Fatalf("error opening capture: %v", err)
+		}
+
+		err = plm.ExportPcapng(os.Stdout, file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("error exporting capture: %v", err)
+		}
+		return
+	}
+
 	if debugFlag {
 		plm.LogDebug.SetOutput(os.Stderr)
 		devices.LogDebug.SetOutput(os.Stderr)
 	}
 
-	c := &serial.Config{
-		Name: serialPortFlag,
-		Baud: 19200,
+	s, err := plm.OpenPort(serialPortFlag)
+	if err != nil {
+		log.Fatalf("error opening port: %v", err)
 	}
 
-	s, err := serial.OpenPort(c)
+	var port io.ReadWriter = s
+	if captureFlag != "" {
+		file, err := os.Create(captureFlag)
+		if err != nil {
+			log.Fatalf("error creating capture: %v", err)
+		}
+		defer file.Close()
 
-	if err != nil {
-		log.Fatalf("error opening serial port: %v", err)
+		var capture plm.RecordWriter
+		if strings.HasSuffix(captureFlag, ".pcapng") {
+			capture, err = plm.NewPcapngWriter(file)
+		} else {
+			capture, err = plm.NewCaptureWriter(file)
+		}
+
+		if err != nil {
+			log.Fatalf("error creating capture: %v", err)
+		}
+		port = plm.Record(s, capture)
 	}
 
 	db, err := util.NewFileDB(dbfile)
@@ -67,15 +100,18 @@ func main() {
 	rxReader, rxWriter := io.Pipe()
 	txReader, txWriter := io.Pipe()
 
-	tx := io.TeeReader(s, txWriter)
+	tx := io.TeeReader(port, txWriter)
 	rx := io.TeeReader(os.Stdin, rxWriter)
 
+	snooper := plm.Snoop(rxReader, txReader)
 	go func() {
-		mon := util.Snoop(os.Stderr, db).Filter(plm.Snoop(rxReader, txReader))
+		mon := util.Snoop(os.Stderr, db).Filter(snooper)
 		for _, err = mon.Read(); err == nil || errors.Is(err, insteon.ErrReadTimeout); _, err = mon.Read() {
 		}
 	}()
 
 	go io.Copy(os.Stdout, tx)
-	io.Copy(s, rx)
+	io.Copy(port, rx)
+	snooper.Close()
+	s.Close()
 }
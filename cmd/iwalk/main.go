@@ -27,7 +27,6 @@ import (
 	"github.com/abates/insteon/plm"
 	"github.com/abates/insteon/util"
 	"github.com/kirsle/configdir"
-	"github.com/tarm/serial"
 )
 
 var (
@@ -47,7 +46,7 @@ func main() {
 		log.Fatalf("Failed to create config file path: %v", err)
 	}
 
-	flag.StringVar(&serialPortFlag, "port", "/dev/ttyUSB0", "serial port connected to a PLM")
+	flag.StringVar(&serialPortFlag, "port", "/dev/ttyUSB0", "serial port, tcp://host:port or http://hub:port connected to a PLM")
 	flag.BoolVar(&debugFlag, "debug", false, "Debug logging")
 	flag.IntVar(&ttlFlag, "ttl", 3, "default ttl for sending Insteon messages")
 
@@ -63,15 +62,9 @@ func main() {
 		plm.LogDebug.SetOutput(os.Stderr)
 	}
 
-	c := &serial.Config{
-		Name: serialPortFlag,
-		Baud: 19200,
-	}
-
-	s, err := serial.OpenPort(c)
-
+	s, err := plm.OpenPort(serialPortFlag)
 	if err != nil {
-		log.Fatalf("error opening serial port: %v", err)
+		log.Fatalf("error opening port: %v", err)
 	}
 
 	modem = plm.New(s, plm.Timeout(time.Second*5))
@@ -89,6 +82,7 @@ func main() {
 		time.Sleep(time.Millisecond * 100)
 	})
 
+	modem.Close()
 	if err != nil {
 		log.Fatalf("Failed to retrieve modem info: %v", err)
 	}
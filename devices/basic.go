@@ -15,8 +15,10 @@
 package devices
 
 import (
+	"context"
 	"fmt"
 	"html/template"
+	"io"
 	"strings"
 	"time"
 
@@ -41,9 +43,23 @@ type BasicDevice struct {
 	MessageWriter
 	DeviceInfo
 	*linkdb
+
+	// conn is the connection dialed for the device, if any
+	conn MessageWriter
 }
 
+// New returns a device that communicates using the MessageWriter.  If
+// the MessageWriter is a Dialer, the device gets its own connection
 func New(mw MessageWriter, info DeviceInfo) *BasicDevice {
+	mw, dialed := dial(mw, info.Address)
+	d := newDevice(mw, info)
+	if dialed {
+		d.conn = mw
+	}
+	return d
+}
+
+func newDevice(mw MessageWriter, info DeviceInfo) *BasicDevice {
 	d := &BasicDevice{
 		MessageWriter: mw,
 		linkdb:        &linkdb{},
@@ -53,7 +69,22 @@ func New(mw MessageWriter, info DeviceInfo) *BasicDevice {
 	return d
 }
 
+// Close closes the connection to the device, if one was dialed (see
+// Dialer).  The device should not be used once it is closed
+func (d *BasicDevice) Close() error {
+	if closer, ok := d.conn.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 func (d *BasicDevice) Write(msg *insteon.Message) (ack *insteon.Message, err error) {
+	return d.WriteContext(context.Background(), msg)
+}
+
+// WriteContext is the same as Write except the underlying MessageWriter
+// will stop waiting for an ACK when the context is done
+func (d *BasicDevice) WriteContext(ctx context.Context, msg *insteon.Message) (ack *insteon.Message, err error) {
 	msg.Dst = d.DeviceInfo.Address
 	msg.Flags = insteon.StandardDirectMessage
 	msg.SetMaxTTL(3)
@@ -63,12 +94,18 @@ func (d *BasicDevice) Write(msg *insteon.Message) (ack *insteon.Message, err err
 	}
 
 	if d.DeviceInfo.EngineVersion == insteon.VerI2Cs {
-		return d.writeWithChecksum(msg)
+		return d.writeWithChecksum(ctx, msg)
 	}
-	return d.MessageWriter.Write(msg)
+	return WriteContext(ctx, d.MessageWriter, msg)
+}
+
+// ReadContext will read the next message from the underlying MessageWriter
+// or return ctx.Err() if the context is done first
+func (d *BasicDevice) ReadContext(ctx context.Context) (*insteon.Message, error) {
+	return readContext(ctx, d.MessageWriter)
 }
 
-func (d *BasicDevice) writeWithChecksum(msg *insteon.Message) (ack *insteon.Message, err error) {
+func (d *BasicDevice) writeWithChecksum(ctx context.Context, msg *insteon.Message) (ack *insteon.Message, err error) {
 	// set checksum
 	if len(msg.Payload) > 0 {
 		if len(msg.Payload) < 14 {
@@ -78,7 +115,7 @@ func (d *BasicDevice) writeWithChecksum(msg *insteon.Message) (ack *insteon.Mess
 		}
 		setChecksum(msg.Command, msg.Payload)
 	}
-	return d.MessageWriter.Write(msg)
+	return WriteContext(ctx, d.MessageWriter, msg)
 }
 
 func (d *BasicDevice) Info() DeviceInfo {
@@ -90,20 +127,27 @@ func (d *BasicDevice) SendCommand(command commands.Command, payload []byte) erro
 	return err
 }
 
+// SendCommandContext is the same as SendCommand but will stop waiting for
+// the device to acknowledge the command when the context is done
+func (d *BasicDevice) SendCommandContext(ctx context.Context, command commands.Command, payload []byte) error {
+	_, err := d.sendCommand(ctx, command, payload)
+	return err
+}
+
 // Send will send the given command bytes to the device including
 // a payload (for extended messages). If payload length is zero then a standard
 // length message is used to deliver the commands. Any error encountered sending
 // the command is returned (eg. ack timeout, etc)
 func (d *BasicDevice) Send(command commands.Command, payload []byte) (commands.Command, error) {
-	return d.sendCommand(command, payload)
+	return d.sendCommand(context.Background(), command, payload)
 }
 
 // sendCommand will send the given command bytes to the device including
 // a payload (for extended messages). If payload length is zero then a standard
 // length message is used to deliver the commands. The command bytes from the
 // response ack are returned as well as any error
-func (d *BasicDevice) sendCommand(command commands.Command, payload []byte) (response commands.Command, err error) {
-	ack, err := d.Write(&insteon.Message{
+func (d *BasicDevice) sendCommand(ctx context.Context, command commands.Command, payload []byte) (response commands.Command, err error) {
+	ack, err := d.WriteContext(ctx, &insteon.Message{
 		Command: command,
 		Payload: payload,
 	})
@@ -189,15 +233,27 @@ func (d *BasicDevice) Dump() string {
 	return builder.String()
 }
 
-func (d *BasicDevice) linkingMode(cmd commands.Command, payload []byte) (err error) {
-	err = d.SendCommand(cmd, payload)
+func (d *BasicDevice) linkingMode(ctx context.Context, cmd commands.Command, payload []byte) (err error) {
+	err = d.SendCommandContext(ctx, cmd, payload)
 	if err == nil {
-		time.Sleep(LinkingModeWaitTime)
+		timer := time.NewTimer(LinkingModeWaitTime)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
 	}
 	return err
 }
 
 func (d *BasicDevice) EnterLinkingMode(group insteon.Group) error {
+	return d.EnterLinkingModeContext(context.Background(), group)
+}
+
+// EnterLinkingModeContext is the same as EnterLinkingMode, but returns
+// early with ctx.Err() when the context is done
+func (d *BasicDevice) EnterLinkingModeContext(ctx context.Context, group insteon.Group) error {
 	payload := []byte{}
 	cmd := commands.EnterLinkingMode.SubCommand(int(group))
 	if d.DeviceInfo.EngineVersion == insteon.VerI2Cs {
@@ -205,17 +261,29 @@ func (d *BasicDevice) EnterLinkingMode(group insteon.Group) error {
 		payload = make([]byte, 14)
 	}
 
-	return d.linkingMode(cmd, payload)
+	return d.linkingMode(ctx, cmd, payload)
 }
 
 func (d *BasicDevice) EnterUnlinkingMode(group insteon.Group) error {
+	return d.EnterUnlinkingModeContext(context.Background(), group)
+}
+
+// EnterUnlinkingModeContext is the same as EnterUnlinkingMode, but returns
+// early with ctx.Err() when the context is done
+func (d *BasicDevice) EnterUnlinkingModeContext(ctx context.Context, group insteon.Group) error {
 	payload := []byte{}
 	if d.DeviceInfo.EngineVersion == insteon.VerI2Cs {
 		payload = make([]byte, 14)
 	}
-	return d.linkingMode(commands.EnterUnlinkingMode.SubCommand(int(group)), payload)
+	return d.linkingMode(ctx, commands.EnterUnlinkingMode.SubCommand(int(group)), payload)
 }
 
 func (d *BasicDevice) ExitLinkingMode() error {
-	return d.SendCommand(commands.ExitLinkingMode, nil)
+	return d.ExitLinkingModeContext(context.Background())
+}
+
+// ExitLinkingModeContext is the same as ExitLinkingMode, but returns
+// early with ctx.Err() when the context is done
+func (d *BasicDevice) ExitLinkingModeContext(ctx context.Context) error {
+	return d.SendCommandContext(ctx, commands.ExitLinkingMode, nil)
 }
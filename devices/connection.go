@@ -15,6 +15,7 @@
 package devices
 
 import (
+	"context"
 	"time"
 
 	"github.com/abates/insteon"
@@ -43,10 +44,86 @@ type MessageWriter interface {
 	Write(*insteon.Message) (ack *insteon.Message, err error)
 }
 
+// Dialer is a MessageWriter, such as the PLM, that can open a connection
+// to a single device.  The connection only reads the messages sent by
+// that device, so devices sharing the Dialer can read their responses
+// concurrently without reading (and discarding) each other's messages.
+// If the connection is an io.Closer, it is closed when the device is
+// closed
+type Dialer interface {
+	MessageWriter
+	DialDevice(dst insteon.Address) MessageWriter
+}
+
+// dial returns a connection to the device if the MessageWriter is a
+// Dialer, otherwise the MessageWriter is returned
+func dial(mw MessageWriter, dst insteon.Address) (conn MessageWriter, dialed bool) {
+	if dialer, ok := mw.(Dialer); ok {
+		return dialer.DialDevice(dst), true
+	}
+	return mw, false
+}
+
+// ContextMessageWriter is a MessageWriter whose blocking reads and writes
+// can be cancelled, or given a deadline, with a context.Context
+type ContextMessageWriter interface {
+	MessageWriter
+
+	// ReadContext is the same as Read except that it returns ctx.Err()
+	// if the context is done before a message is received
+	ReadContext(ctx context.Context) (*insteon.Message, error)
+
+	// WriteContext is the same as Write except that it returns ctx.Err()
+	// if the context is done before the message is acknowledged
+	WriteContext(ctx context.Context, msg *insteon.Message) (ack *insteon.Message, err error)
+}
+
+type contextReader interface {
+	ReadContext(ctx context.Context) (*insteon.Message, error)
+}
+
+type contextWriter interface {
+	WriteContext(ctx context.Context, msg *insteon.Message) (*insteon.Message, error)
+}
+
+// readContext will read from the reader using ReadContext if the reader
+// supports it.  Otherwise the context is only checked prior to calling
+// Read
+func readContext(ctx context.Context, reader messageReader) (*insteon.Message, error) {
+	if cr, ok := reader.(contextReader); ok {
+		return cr.ReadContext(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return reader.Read()
+}
+
+// WriteContext will write the message to the MessageWriter.  If the
+// MessageWriter is a ContextMessageWriter then the context is passed
+// along, otherwise the context is only checked prior to calling Write
+func WriteContext(ctx context.Context, mw MessageWriter, msg *insteon.Message) (*insteon.Message, error) {
+	if cw, ok := mw.(contextWriter); ok {
+		return cw.WriteContext(ctx, msg)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return mw.Write(msg)
+}
+
 func IDRequest(mw MessageWriter, dst insteon.Address) (version insteon.FirmwareVersion, devCat insteon.DevCat, err error) {
-	msg, err := mw.Write(&insteon.Message{Dst: dst, Flags: insteon.StandardDirectMessage, Command: commands.IDRequest})
+	return IDRequestContext(context.Background(), mw, dst)
+}
+
+// IDRequestContext is the same as IDRequest, but will stop waiting
+// for the set button pressed response when the context is done
+func IDRequestContext(ctx context.Context, mw MessageWriter, dst insteon.Address) (version insteon.FirmwareVersion, devCat insteon.DevCat, err error) {
+	msg, err := WriteContext(ctx, mw, &insteon.Message{Dst: dst, Flags: insteon.StandardDirectMessage, Command: commands.IDRequest})
 	if err == nil {
-		msg, err = Read(mw, Or(CmdMatcher(commands.SetButtonPressedResponder), CmdMatcher(commands.SetButtonPressedController)))
+		msg, err = ReadContext(ctx, mw, Or(CmdMatcher(commands.SetButtonPressedResponder), CmdMatcher(commands.SetButtonPressedController)))
 		if err == nil {
 			version = insteon.FirmwareVersion(byte(msg.Dst))
 			devCat = insteon.DevCat{byte(msg.Dst >> 16), byte(msg.Dst >> 8)}
@@ -56,7 +133,13 @@ func IDRequest(mw MessageWriter, dst insteon.Address) (version insteon.FirmwareV
 }
 
 func GetEngineVersion(mw MessageWriter, dst insteon.Address) (version insteon.EngineVersion, err error) {
-	ack, err := mw.Write(&insteon.Message{Dst: dst, Flags: insteon.StandardDirectMessage, Command: commands.GetEngineVersion})
+	return GetEngineVersionContext(context.Background(), mw, dst)
+}
+
+// GetEngineVersionContext is the same as GetEngineVersion, but will stop
+// waiting for the device to respond when the context is done
+func GetEngineVersionContext(ctx context.Context, mw MessageWriter, dst insteon.Address) (version insteon.EngineVersion, err error) {
+	ack, err := WriteContext(ctx, mw, &insteon.Message{Dst: dst, Flags: insteon.StandardDirectMessage, Command: commands.GetEngineVersion})
 	if err == nil {
 		LogDebug.Printf("Device %v responded with an engine version %d", dst, ack.Command.Command2())
 		version = insteon.EngineVersion(ack.Command.Command2())
@@ -75,8 +158,15 @@ func GetEngineVersion(mw MessageWriter, dst insteon.Address) (version insteon.En
 }
 
 func Read(reader messageReader, matcher Matcher) (*insteon.Message, error) {
-	msg, err := reader.Read()
-	for ; err == nil; msg, err = reader.Read() {
+	return ReadContext(context.Background(), reader, matcher)
+}
+
+// ReadContext will read messages from the reader until one matches the
+// given matcher or the context is done. Reading stops with ctx.Err() as
+// soon as the context is cancelled or its deadline expires
+func ReadContext(ctx context.Context, reader messageReader, matcher Matcher) (*insteon.Message, error) {
+	msg, err := readContext(ctx, reader)
+	for ; err == nil; msg, err = readContext(ctx, reader) {
 		if matcher.Matches(msg) {
 			break
 		}
@@ -15,6 +15,8 @@
 package devices
 
 import (
+	"context"
+	"errors"
 	"io"
 	"testing"
 
@@ -150,31 +152,39 @@ func TestRead(t *testing.T) {
 	}
 }
 
-/*func TestRetry(t *testing.T) {
+func TestReadContext(t *testing.T) {
 	tests := []struct {
 		name    string
-		errors  []error
-		retries int
-		want    error
+		filters []Filter
 	}{
-		{"happy path", []error{nil}, 1, nil},
-		{"retry success", []error{ErrReadTimeout, nil}, 2, nil},
-		{"retry timeout", []error{ErrReadTimeout, ErrReadTimeout}, 2, ErrReadTimeout},
-		{"third time's a charm", []error{ErrReadTimeout, ErrReadTimeout, nil}, 3, nil},
-		{"third time sometimes fails too", []error{ErrReadTimeout, ErrReadTimeout, ErrReadTimeout}, 3, ErrReadTimeout},
+		{"unfiltered", nil},
+		{"filtered", []Filter{FilterDuplicates(), TTL(3), RetryFilter(3)}},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			i := 0
-			cb := func() error {
-				i++
-				return test.errors[i-1]
+			var mw MessageWriter = &testWriter{read: []*insteon.Message{{Command: commands.Command(1)}}}
+			for _, filter := range test.filters {
+				mw = filter.Filter(mw)
 			}
-			got := retry(test.retries, cb)
-			if !errors.Is(test.want, got) {
-				t.Errorf("Wanted error %v got %v", test.want, got)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := ReadContext(ctx, mw, Matches(func(*insteon.Message) bool { return true }))
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Wanted read error %v got %v", context.Canceled, err)
+			}
+
+			_, err = WriteContext(ctx, mw, &insteon.Message{})
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Wanted write error %v got %v", context.Canceled, err)
+			}
+
+			_, err = ReadContext(context.Background(), mw, Matches(func(*insteon.Message) bool { return true }))
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
 			}
 		})
 	}
-}*/
+}
@@ -15,7 +15,9 @@
 package devices
 
 import (
+	"context"
 	"fmt"
+	"io"
 
 	"github.com/abates/insteon"
 	"github.com/abates/insteon/commands"
@@ -146,6 +148,29 @@ type Linkable interface {
 	WriteLinks(...insteon.LinkRecord) error
 }
 
+// ContextLinkable is a Linkable device whose long running operations
+// (retrieving the link database and linking) can be cancelled
+// with a context.Context
+type ContextLinkable interface {
+	Linkable
+
+	// EnterLinkingModeContext is the same as EnterLinkingMode, but
+	// returns ctx.Err() if the context is done first
+	EnterLinkingModeContext(context.Context, insteon.Group) error
+
+	// EnterUnlinkingModeContext is the same as EnterUnlinkingMode, but
+	// returns ctx.Err() if the context is done first
+	EnterUnlinkingModeContext(context.Context, insteon.Group) error
+
+	// ExitLinkingModeContext is the same as ExitLinkingMode, but
+	// returns ctx.Err() if the context is done first
+	ExitLinkingModeContext(context.Context) error
+
+	// LinksContext is the same as Links, but retrieving the link database
+	// is aborted if the context is done first
+	LinksContext(context.Context) ([]insteon.LinkRecord, error)
+}
+
 type WriteLink interface {
 	WriteLink(index int, record insteon.LinkRecord) error
 }
@@ -163,20 +188,35 @@ type DeviceInfo struct {
 // If the device responds, Open will request its engine version as
 // well as device info in order to return the correct device type
 // (Dimmer, switch, thermostat, etc).  Open requires a MessageWriter,
-// such as a PLM to use to communicate with the Insteon network
+// such as a PLM to use to communicate with the Insteon network.  If the
+// MessageWriter is a Dialer, the device gets its own connection and
+// should be closed once it is no longer needed
 func Open(mw MessageWriter, dst insteon.Address, filters ...Filter) (device *BasicDevice, info DeviceInfo, err error) {
+	return OpenContext(context.Background(), mw, dst, filters...)
+}
+
+// OpenContext is the same as Open, but the engine version and ID requests
+// are abandoned if the context is done before the device responds
+func OpenContext(ctx context.Context, mw MessageWriter, dst insteon.Address, filters ...Filter) (device *BasicDevice, info DeviceInfo, err error) {
+	conn, dialed := dial(mw, dst)
+	mw = conn
 	for _, filter := range filters {
 		mw = filter.Filter(mw)
 	}
 
 	info.Address = dst
-	info.EngineVersion, err = GetEngineVersion(mw, dst)
+	info.EngineVersion, err = GetEngineVersionContext(ctx, mw, dst)
 	if err == nil {
-		info.FirmwareVersion, info.DevCat, err = IDRequest(mw, dst)
+		info.FirmwareVersion, info.DevCat, err = IDRequestContext(ctx, mw, dst)
 	}
 
 	if err == nil || err == ErrNotLinked {
-		device = New(mw, info)
+		device = newDevice(mw, info)
+		if dialed {
+			device.conn = conn
+		}
+	} else if closer, ok := conn.(io.Closer); ok && dialed {
+		closer.Close()
 	}
 	return
 }
@@ -0,0 +1,387 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package devicetest provides simulated Insteon devices.  The devices
+// are attached to the network of an emulated IM so that code using the
+// devices and util packages can be tested end to end without hardware:
+//
+//	im := plmtest.New(plmtest.TimeScale(0))
+//	im.AddDevice(devicetest.NewDimmer(insteon.Address(0x010203)))
+//	modem := plm.New(im)
+//	defer modem.Close()
+//
+// Each device keeps an All-Link database laid out in memory the same
+// way a real device does, starting at devices.BaseLinkDBAddress, along
+// with its operating flags and extended (ExtendedGetSet) data.  Devices
+// take part in linking sessions and I2CS devices NAK messages from
+// unlinked senders and messages with an incorrect checksum.
+package devicetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+	"github.com/abates/insteon/plm/plmtest"
+)
+
+// NAK reasons returned in command 2 of a NAK
+const (
+	nakIllegalValue = 0xfb
+	nakChecksum     = 0xfd
+	nakUnknown      = 0xfd
+	nakNotLinked    = 0xff
+)
+
+// unlinkedCommands are the commands an I2CS device will accept from a
+// sender it is not linked to
+var unlinkedCommands = map[int]bool{
+	commands.AssignToAllLinkGroup.Command1():   true,
+	commands.DeleteFromAllLinkGroup.Command1(): true,
+	commands.ExitLinkingMode.Command1():        true,
+	commands.EnterLinkingMode.Command1():       true,
+	commands.EnterUnlinkingMode.Command1():     true,
+	commands.Ping.Command1():                   true,
+	commands.IDRequest.Command1():              true,
+}
+
+// handler answers a direct message sent to the device.  Handlers are
+// called with the device locked
+type handler func(d *Device, msg *insteon.Message) []*insteon.Message
+
+// Option is used to configure a Device
+type Option func(d *Device)
+
+// DevCat sets the device category reported in response to an ID request
+func DevCat(devCat insteon.DevCat) Option {
+	return func(d *Device) {
+		d.devCat = devCat
+	}
+}
+
+// Firmware sets the firmware version reported in response to an ID request
+func Firmware(firmware insteon.FirmwareVersion) Option {
+	return func(d *Device) {
+		d.firmware = firmware
+	}
+}
+
+// Engine sets the Insteon engine version of the device.  Devices with
+// the VerI2Cs engine require extended messages to have a checksum and
+// will only answer senders that are in their All-Link database
+func Engine(engine insteon.EngineVersion) Option {
+	return func(d *Device) {
+		d.engine = engine
+	}
+}
+
+// Links sets the initial contents of the device All-Link database
+func Links(links ...insteon.LinkRecord) Option {
+	return func(d *Device) {
+		d.links = append([]insteon.LinkRecord{}, links...)
+	}
+}
+
+// linkState tracks the device's part in a linking session
+type linkState struct {
+	active    bool
+	unlinking bool
+	responder bool
+	group     insteon.Group
+	heard     insteon.Address
+	heardAt   time.Time
+}
+
+// Device is a simulated Insteon device.  Device implements
+// plmtest.Device so it can be added to an emulated IM
+type Device struct {
+	mu       sync.Mutex
+	address  insteon.Address
+	devCat   insteon.DevCat
+	firmware insteon.FirmwareVersion
+	engine   insteon.EngineVersion
+	links    []insteon.LinkRecord
+	flags    [5]byte
+	data     [14]byte
+	level    int
+	linking  linkState
+	received []*insteon.Message
+	handlers map[int]handler
+	therm    *thermostat
+}
+
+var _ plmtest.Device = &Device{}
+
+func newDevice(address insteon.Address, devCat insteon.DevCat, firmware insteon.FirmwareVersion) *Device {
+	return &Device{
+		address:  address,
+		devCat:   devCat,
+		firmware: firmware,
+		engine:   insteon.VerI2,
+		handlers: map[int]handler{
+			commands.AssignToAllLinkGroup.Command1():   (*Device).assign,
+			commands.DeleteFromAllLinkGroup.Command1(): (*Device).assign,
+			commands.ExitLinkingMode.Command1():        (*Device).exitLinking,
+			commands.EnterLinkingMode.Command1():       (*Device).enterLinking,
+			commands.EnterUnlinkingMode.Command1():     (*Device).enterLinking,
+			commands.GetEngineVersion.Command1():       (*Device).engineVersion,
+			commands.Ping.Command1():                   (*Device).ping,
+			commands.IDRequest.Command1():              (*Device).idRequest,
+			commands.GetOperatingFlags.Command1():      (*Device).getFlags,
+			commands.SetOperatingFlags.Command1():      (*Device).setFlags,
+			commands.ExtendedGetSet.Command1():         (*Device).extendedGetSet,
+			commands.ReadWriteALDB.Command1():          (*Device).readWriteALDB,
+		},
+	}
+}
+
+// NewSwitch returns a simulated on/off switch
+func NewSwitch(address insteon.Address, options ...Option) *Device {
+	d := newDevice(address, insteon.DevCat{0x02, 0x2a}, 0x43)
+	d.lighting(false)
+	for _, o := range options {
+		o(d)
+	}
+	return d
+}
+
+// NewDimmer returns a simulated dimmer
+func NewDimmer(address insteon.Address, options ...Option) *Device {
+	d := newDevice(address, insteon.DevCat{0x01, 0x20}, 0x41)
+	d.lighting(true)
+	for _, o := range options {
+		o(d)
+	}
+	return d
+}
+
+// NewI2CS returns a simulated dimmer that uses the I2CS engine.  The
+// dimmer will NAK everything but linking commands and ID requests
+// until it has been linked
+func NewI2CS(address insteon.Address, options ...Option) *Device {
+	return NewDimmer(address, append([]Option{Firmware(0x45), Engine(insteon.VerI2Cs)}, options...)...)
+}
+
+// Address returns the address of the device
+func (d *Device) Address() insteon.Address {
+	return d.address
+}
+
+// Links returns a copy of the device All-Link database up to, but not
+// including, the high water mark
+func (d *Device) Links() []insteon.LinkRecord {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	links := []insteon.LinkRecord{}
+	for _, link := range d.links {
+		if link.Flags.LastRecord() {
+			break
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// Level returns the current on level of the device
+func (d *Device) Level() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.level
+}
+
+// Received returns every message the device has received
+func (d *Device) Received() []*insteon.Message {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*insteon.Message{}, d.received...)
+}
+
+// Receive answers a message from the network
+func (d *Device) Receive(msg *insteon.Message) []*insteon.Message {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.received = append(d.received, msg)
+
+	if msg.Type().Broadcast() {
+		return d.hear(msg)
+	} else if msg.Dst != d.address || msg.Type() != insteon.MsgTypeDirect {
+		return nil
+	}
+
+	if d.engine == insteon.VerI2Cs {
+		if msg.Flags.Extended() && msg.Payload[13] != checksum(msg.Command, msg.Payload[:13]) {
+			return d.nak(msg, nakChecksum)
+		}
+
+		if !unlinkedCommands[msg.Command.Command1()] && !d.linked(msg.Src) {
+			return d.nak(msg, nakNotLinked)
+		}
+	}
+
+	if h, found := d.handlers[msg.Command.Command1()]; found {
+		return h(d, msg)
+	}
+	return d.nak(msg, nakUnknown)
+}
+
+// checksum computes the I2CS checksum of an extended message
+func checksum(cmd commands.Command, payload []byte) byte {
+	sum := byte(cmd.Command1() + cmd.Command2())
+	for _, b := range payload {
+		sum += b
+	}
+	return ^sum + 1
+}
+
+func (d *Device) reply(msg *insteon.Message, flags insteon.Flags, cmd2 byte) []*insteon.Message {
+	flags.SetMaxTTL(msg.MaxTTL())
+	flags.SetTTL(msg.MaxTTL())
+	return []*insteon.Message{{
+		Src:     d.address,
+		Dst:     msg.Src,
+		Flags:   flags,
+		Command: commands.From(byte(flags), byte(msg.Command.Command1()), cmd2),
+	}}
+}
+
+func (d *Device) ack(msg *insteon.Message, cmd2 byte) []*insteon.Message {
+	return d.reply(msg, insteon.StandardDirectAck, cmd2)
+}
+
+func (d *Device) nak(msg *insteon.Message, reason byte) []*insteon.Message {
+	return d.reply(msg, insteon.StandardDirectNak, reason)
+}
+
+func (d *Device) direct(dst insteon.Address, cmd commands.Command) *insteon.Message {
+	return &insteon.Message{
+		Src:     d.address,
+		Dst:     dst,
+		Flags:   insteon.StandardDirectMessage,
+		Command: commands.From(byte(insteon.StandardDirectMessage), byte(cmd.Command1()), byte(cmd.Command2())),
+	}
+}
+
+// extended returns an extended message, I2CS devices include the checksum
+func (d *Device) extended(dst insteon.Address, cmd commands.Command, payload []byte) *insteon.Message {
+	buf := make([]byte, 14)
+	copy(buf, payload)
+	if d.engine == insteon.VerI2Cs {
+		buf[13] = checksum(cmd, buf[:13])
+	}
+	return &insteon.Message{
+		Src:     d.address,
+		Dst:     dst,
+		Flags:   insteon.ExtendedDirectMessage,
+		Command: commands.From(byte(insteon.ExtendedDirectMessage), byte(cmd.Command1()), byte(cmd.Command2())),
+		Payload: buf,
+	}
+}
+
+// broadcast returns a broadcast message with the device category and
+// firmware version in the destination address
+func (d *Device) broadcast(cmd commands.Command) *insteon.Message {
+	return &insteon.Message{
+		Src:     d.address,
+		Dst:     insteon.Address(uint32(d.devCat[0])<<16 | uint32(d.devCat[1])<<8 | uint32(d.firmware)),
+		Flags:   insteon.StandardBroadcast,
+		Command: commands.From(byte(insteon.StandardBroadcast), byte(cmd.Command1()), byte(cmd.Command2())),
+	}
+}
+
+func (d *Device) engineVersion(msg *insteon.Message) []*insteon.Message {
+	return d.ack(msg, byte(d.engine))
+}
+
+func (d *Device) ping(msg *insteon.Message) []*insteon.Message {
+	return d.ack(msg, byte(msg.Command.Command2()))
+}
+
+func (d *Device) idRequest(msg *insteon.Message) []*insteon.Message {
+	return append(d.ack(msg, 0x00), d.broadcast(commands.SetButtonPressedResponder))
+}
+
+// flagIndex maps the GetOperatingFlags selector to the flag byte
+var flagIndex = map[int]int{0x01: 0, 0x02: 1, 0x04: 2, 0x10: 3, 0x20: 4}
+
+func (d *Device) getFlags(msg *insteon.Message) []*insteon.Message {
+	i, found := flagIndex[msg.Command.Command2()]
+	if !found {
+		return d.nak(msg, nakIllegalValue)
+	}
+	return d.ack(msg, d.flags[i])
+}
+
+// flagBits maps the SetOperatingFlags commands to the flag byte and bit
+// they set or clear.  Even commands set the bit and odd commands clear
+// it, except for the LED which is the other way around
+var flagBits = map[int]struct {
+	index int
+	bit   byte
+}{
+	0x00: {0, 0x01}, // program lock
+	0x02: {0, 0x02}, // TX LED
+	0x04: {0, 0x04}, // resume dim
+	0x06: {4, 0x20}, // load sense
+	0x08: {3, 0x10}, // LED
+}
+
+func (d *Device) setFlags(msg *insteon.Message) []*insteon.Message {
+	cmd2 := msg.Command.Command2()
+	fb, found := flagBits[cmd2&^0x01]
+	if !found {
+		return d.nak(msg, nakIllegalValue)
+	}
+
+	set := cmd2&0x01 == 0
+	if cmd2&^0x01 == 0x08 {
+		set = !set
+	}
+
+	if set {
+		d.flags[fb.index] |= fb.bit
+	} else {
+		d.flags[fb.index] &^= fb.bit
+	}
+	return d.ack(msg, byte(cmd2))
+}
+
+// extendedGetSet answers the get (D2 = 0x00) form of ExtendedGetSet
+// with the device data and updates the data for the X10 address, ramp
+// rate and on level set commands
+func (d *Device) extendedGetSet(msg *insteon.Message) []*insteon.Message {
+	if d.therm != nil {
+		return d.therm.extendedGetSet(d, msg)
+	}
+
+	switch msg.Payload[1] {
+	case 0x00:
+		payload := d.data
+		payload[0] = msg.Payload[0]
+		payload[1] = 0x01
+		return append(d.ack(msg, 0x00), d.extended(msg.Src, commands.ExtendedGetSet, payload[:13]))
+	case 0x04:
+		// X10 house and unit code
+		d.data[4], d.data[5] = msg.Payload[2], msg.Payload[3]
+	case 0x05:
+		// ramp rate
+		d.data[6] = msg.Payload[2]
+	case 0x06:
+		// on level
+		d.data[7] = msg.Payload[2]
+	default:
+		return d.nak(msg, nakIllegalValue)
+	}
+	return d.ack(msg, 0x00)
+}
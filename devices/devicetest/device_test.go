@@ -0,0 +1,363 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devicetest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+	"github.com/abates/insteon/devices"
+	"github.com/abates/insteon/plm"
+	"github.com/abates/insteon/plm/plmtest"
+	"github.com/abates/insteon/util"
+)
+
+func init() {
+	devices.LinkingModeWaitTime = 10 * time.Millisecond
+}
+
+func testNetwork(t *testing.T, devs ...*Device) (*plmtest.IM, *plm.PLM) {
+	t.Helper()
+	im := plmtest.New(plmtest.TimeScale(0.01), plmtest.Links(insteon.ControllerLink(0, insteon.Address(0x0a0b0c))))
+	for _, d := range devs {
+		im.AddDevice(d)
+	}
+	modem := plm.New(im, plm.Timeout(time.Second), plm.PacingScale(0.01))
+	t.Cleanup(func() { modem.Close() })
+	return im, modem
+}
+
+func open(t *testing.T, modem *plm.PLM, address insteon.Address) *devices.BasicDevice {
+	t.Helper()
+	device, _, err := devices.Open(modem, address)
+	if err != nil && !errors.Is(err, devices.ErrNotLinked) {
+		t.Fatalf("Unexpected error opening %v: %v", address, err)
+	}
+	return device
+}
+
+func hasLink(links []insteon.LinkRecord, want insteon.LinkRecord) bool {
+	for _, link := range links {
+		if link.Flags.InUse() && link.Equal(&want) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name       string
+		device     *Device
+		wantDevCat insteon.DevCat
+		wantEngine insteon.EngineVersion
+		wantErr    error
+	}{
+		{"switch", NewSwitch(insteon.Address(0x010203)), insteon.DevCat{0x02, 0x2a}, insteon.VerI2, nil},
+		{"dimmer", NewDimmer(insteon.Address(0x010203)), insteon.DevCat{0x01, 0x20}, insteon.VerI2, nil},
+		{"thermostat", NewThermostat(insteon.Address(0x010203)), insteon.DevCat{0x05, 0x0b}, insteon.VerI2, nil},
+		{"unlinked i2cs", NewI2CS(insteon.Address(0x010203)), insteon.DevCat{}, insteon.VerI2Cs, devices.ErrNotLinked},
+		{"linked i2cs", NewI2CS(insteon.Address(0x010203), Links(insteon.ResponderLink(1, insteon.Address(0x445566)))), insteon.DevCat{0x01, 0x20}, insteon.VerI2Cs, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, modem := testNetwork(t, test.device)
+			_, info, err := devices.Open(modem, test.device.Address())
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if info.DevCat != test.wantDevCat {
+				t.Errorf("Wanted devcat %v got %v", test.wantDevCat, info.DevCat)
+			}
+
+			if info.EngineVersion != test.wantEngine {
+				t.Errorf("Wanted engine %v got %v", test.wantEngine, info.EngineVersion)
+			}
+		})
+	}
+}
+
+func TestDimmer(t *testing.T) {
+	d := NewDimmer(insteon.Address(0x010203))
+	_, modem := testNetwork(t, d)
+	dimmer := devices.Lookup(open(t, modem, d.Address())).(*devices.Dimmer)
+
+	if err := dimmer.TurnOn(0x80); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if d.Level() != 0x80 {
+		t.Errorf("Wanted level 0x80 got %#x", d.Level())
+	}
+
+	if level, err := dimmer.Status(); err != nil || level != 0x80 {
+		t.Errorf("Wanted level 0x80 got %#x (%v)", level, err)
+	}
+
+	config, err := dimmer.Config()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := devices.DimmerConfig{Ramp: 0x1c, OnLevel: 0xff, SNT: 0x20}
+	if config != want {
+		t.Errorf("Wanted config %+v got %+v", want, config)
+	}
+
+	if err := dimmer.SetLoadSense(false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	flags, err := dimmer.OperatingFlags()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if flags.LoadSense() || !flags.LED() || !flags.TxLED() {
+		t.Errorf("Wanted LED, TX LED and no load sense got %v", flags)
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	d := NewSwitch(insteon.Address(0x010203))
+	_, modem := testNetwork(t, d)
+	sw := devices.Lookup(open(t, modem, d.Address())).(*devices.Switch)
+
+	if err := sw.TurnOn(0x80); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if d.Level() != 0xff {
+		t.Errorf("Wanted level 0xff got %#x", d.Level())
+	}
+
+	if err := sw.TurnOff(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if level, err := sw.Status(); err != nil || level != 0 {
+		t.Errorf("Wanted level 0 got %#x (%v)", level, err)
+	}
+}
+
+func TestThermostat(t *testing.T) {
+	d := NewThermostat(insteon.Address(0x010203))
+	_, modem := testNetwork(t, d)
+	therm := devices.Lookup(open(t, modem, d.Address())).(*devices.Thermostat)
+
+	if err := therm.SetMode(devices.Cool); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := therm.SetCoolSetpoint(0, 74); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	status, err := therm.Status()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if status.Mode != devices.Cool || status.Setpoint != 74 || status.Temperature != 70 || status.Humidity != 45 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	info, err := therm.GetInfo()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if info.CoolSetPoint != 74 || info.HeatSetPoint != 68 || info.Humidity != 45 {
+		t.Errorf("Unexpected info %+v", info)
+	}
+}
+
+func TestI2CSChecksum(t *testing.T) {
+	d := NewI2CS(insteon.Address(0x010203), Links(insteon.ResponderLink(1, insteon.Address(0x445566))))
+	_, modem := testNetwork(t, d)
+
+	msg := &insteon.Message{Dst: d.Address(), Flags: insteon.ExtendedDirectMessage, Command: commands.ExtendedGetSet, Payload: make([]byte, 14)}
+	msg.Payload[13] = 0x42
+	ack, err := modem.Write(msg)
+	if !errors.Is(err, devices.ErrNak) {
+		t.Fatalf("Wanted %v got %v", devices.ErrNak, err)
+	}
+
+	if ack.Command.Command2() != nakChecksum {
+		t.Errorf("Wanted NAK reason %#x got %#x", nakChecksum, ack.Command.Command2())
+	}
+
+	// BasicDevice computes the checksum
+	dimmer := devices.Lookup(open(t, modem, d.Address())).(*devices.Dimmer)
+	if _, err := dimmer.Config(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		device *Device
+	}{
+		{"dimmer", NewDimmer(insteon.Address(0x010203))},
+		{"i2cs", NewI2CS(insteon.Address(0x010203))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			im, modem := testNetwork(t, test.device)
+			device := open(t, modem, test.device.Address())
+
+			// the IM is the controller
+			if err := util.ForceLink(1, modem, device); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !hasLink(im.Links(), insteon.ControllerLink(1, test.device.Address())) {
+				t.Errorf("Expected controller link in %v", im.Links())
+			}
+
+			if !hasLink(test.device.Links(), insteon.ResponderLink(1, im.Address())) {
+				t.Errorf("Expected responder link in %v", test.device.Links())
+			}
+
+			// now that the device is linked, the ALDB can be read
+			device = open(t, modem, test.device.Address())
+			if err := util.Link(2, device, modem); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !hasLink(im.Links(), insteon.ResponderLink(2, test.device.Address())) {
+				t.Errorf("Expected responder link in %v", im.Links())
+			}
+
+			if !hasLink(test.device.Links(), insteon.ControllerLink(2, im.Address())) {
+				t.Errorf("Expected controller link in %v", test.device.Links())
+			}
+
+			if err := util.Unlink(1, modem, device); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if hasLink(im.Links(), insteon.ControllerLink(1, test.device.Address())) {
+				t.Errorf("Expected controller link to be deleted from %v", im.Links())
+			}
+
+			if hasLink(test.device.Links(), insteon.ResponderLink(1, im.Address())) {
+				t.Errorf("Expected responder link to be deleted from %v", test.device.Links())
+			}
+		})
+	}
+}
+
+func TestWriteLinks(t *testing.T) {
+	d := NewDimmer(insteon.Address(0x010203), Links(
+		insteon.ResponderLink(1, insteon.Address(0x445566)),
+		insteon.ControllerLink(1, insteon.Address(0x070809)),
+		insteon.ResponderLink(3, insteon.Address(0x070809)),
+	))
+	_, modem := testNetwork(t, d)
+	device := open(t, modem, d.Address())
+
+	want := []insteon.LinkRecord{
+		insteon.ControllerLink(1, insteon.Address(0x445566)),
+		insteon.ResponderLink(2, insteon.Address(0x0a0b0c)),
+	}
+
+	if err := device.WriteLinks(append([]insteon.LinkRecord{}, want...)...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := d.Links(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted links %v got %v", want, got)
+	}
+
+	// read them back over the network
+	got, err := open(t, modem, d.Address()).Links()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted links %v got %v", want, got)
+	}
+}
+
+func TestUpdateLinks(t *testing.T) {
+	available := insteon.ResponderLink(5, insteon.Address(0x0d0e0f))
+	available.Flags.SetAvailable()
+	d := NewDimmer(insteon.Address(0x010203), Links(
+		insteon.ResponderLink(1, insteon.Address(0x445566)),
+		available,
+		insteon.ControllerLink(1, insteon.Address(0x070809)),
+	))
+	_, modem := testNetwork(t, d)
+	device := open(t, modem, d.Address())
+
+	add := insteon.ResponderLink(2, insteon.Address(0x0a0b0c))
+	add2 := insteon.ResponderLink(3, insteon.Address(0x0a0b0c))
+	if err := device.UpdateLinks(insteon.ControllerLink(1, insteon.Address(0x070809)), add, add2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []insteon.LinkRecord{
+		insteon.ResponderLink(1, insteon.Address(0x445566)),
+		add,
+		insteon.ControllerLink(1, insteon.Address(0x070809)),
+		add2,
+	}
+
+	if got := d.Links(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted links %v got %v", want, got)
+	}
+}
+
+func TestCrossLinkAll(t *testing.T) {
+	d1 := NewDimmer(insteon.Address(0x010203))
+	d2 := NewSwitch(insteon.Address(0x040506))
+	d3 := NewI2CS(insteon.Address(0x070809), Links(insteon.ResponderLink(0, insteon.Address(0x445566))))
+	_, modem := testNetwork(t, d1, d2, d3)
+
+	linkables := []devices.Linkable{}
+	for _, d := range []*Device{d1, d2, d3} {
+		linkables = append(linkables, open(t, modem, d.Address()))
+	}
+
+	if err := util.CrossLinkAll(1, linkables...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, d := range []*Device{d1, d2, d3} {
+		for _, other := range []*Device{d1, d2, d3} {
+			if d == other {
+				continue
+			}
+
+			if !hasLink(d.Links(), insteon.ControllerLink(1, other.Address())) {
+				t.Errorf("Expected controller link to %v in %v", other.Address(), d.Links())
+			}
+
+			if !hasLink(d.Links(), insteon.ResponderLink(1, other.Address())) {
+				t.Errorf("Expected responder link to %v in %v", other.Address(), d.Links())
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devicetest
+
+import (
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+)
+
+// lighting adds the lighting control commands to the device.  Switches
+// are either fully on or off, dimmers can be set to any level
+func (d *Device) lighting(dimmable bool) {
+	// TX LED and LED on, 0x3f SNR, load sense enabled
+	d.flags = [5]byte{0x02, 0x00, 0x3f, 0x10, 0x20}
+	// ramp rate, on level and signal to noise threshold
+	d.data[6], d.data[7], d.data[8] = 0x1c, 0xff, 0x20
+
+	level := func(level int) int {
+		if !dimmable && level > 0 {
+			return 0xff
+		}
+		return level
+	}
+
+	on := func(d *Device, msg *insteon.Message) []*insteon.Message {
+		d.level = level(msg.Command.Command2())
+		return d.ack(msg, byte(d.level))
+	}
+
+	off := func(d *Device, msg *insteon.Message) []*insteon.Message {
+		d.level = 0
+		return d.ack(msg, 0x00)
+	}
+
+	d.handlers[commands.LightOn.Command1()] = on
+	d.handlers[commands.LightOnFast.Command1()] = on
+	d.handlers[commands.LightInstantChange.Command1()] = on
+	d.handlers[commands.LightOff.Command1()] = off
+	d.handlers[commands.LightOffFast.Command1()] = off
+	d.handlers[commands.LightStatusRequest.Command1()] = func(d *Device, msg *insteon.Message) []*insteon.Message {
+		// command 1 of the status ACK is the All-Link database delta
+		responses := d.ack(msg, byte(d.level))
+		responses[0].Command = commands.From(byte(responses[0].Flags), d.flags[1], byte(d.level))
+		return responses
+	}
+}
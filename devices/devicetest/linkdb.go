@@ -0,0 +1,219 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devicetest
+
+import (
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+	"github.com/abates/insteon/devices"
+	"github.com/abates/insteon/plm/plmtest"
+)
+
+// ALDB request types in D2 of a ReadWriteALDB message
+const (
+	readLink     = devices.LinkRequestType(0x00)
+	linkResponse = devices.LinkRequestType(0x01)
+	writeLink    = devices.LinkRequestType(0x02)
+)
+
+// record returns the link record at index i.  Memory past the end of
+// the database reads as zeros, which is a high water mark
+func (d *Device) record(i int) insteon.LinkRecord {
+	if i < len(d.links) {
+		return d.links[i]
+	}
+	return insteon.LinkRecord{}
+}
+
+// index converts a memory address to a link record index
+func index(address devices.MemAddress) (int, bool) {
+	if address == 0 {
+		return 0, true
+	} else if address > devices.BaseLinkDBAddress || (devices.BaseLinkDBAddress-address)%devices.LinkRecordSize != 0 {
+		return 0, false
+	}
+	return int((devices.BaseLinkDBAddress - address) / devices.LinkRecordSize), true
+}
+
+func memAddress(i int) devices.MemAddress {
+	return devices.BaseLinkDBAddress - devices.MemAddress(i)*devices.LinkRecordSize
+}
+
+// linked indicates if the address is in the All-Link database
+func (d *Device) linked(address insteon.Address) bool {
+	for _, link := range d.links {
+		if link.Flags.LastRecord() {
+			break
+		} else if link.Flags.InUse() && link.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// addLink updates the data of a matching record or writes the link to
+// the first available record.  When the link is written over the high
+// water mark the next record becomes the high water mark
+func (d *Device) addLink(link insteon.LinkRecord) {
+	link.Flags.SetInUse()
+	link.Flags.ClearLastRecord()
+	free := -1
+	for i := 0; ; i++ {
+		existing := d.record(i)
+		if existing.Flags.InUse() && existing.Equal(&link) {
+			d.write(i, link)
+			return
+		} else if existing.Flags.Available() && free < 0 {
+			free = i
+		}
+
+		if existing.Flags.LastRecord() {
+			break
+		}
+	}
+
+	if d.record(free).Flags.LastRecord() && free+1 < len(d.links) {
+		d.links[free+1] = insteon.LinkRecord{}
+	}
+	d.write(free, link)
+}
+
+// deleteLink marks a matching record as available
+func (d *Device) deleteLink(link insteon.LinkRecord) {
+	for i, existing := range d.links {
+		if existing.Flags.LastRecord() {
+			break
+		} else if existing.Flags.InUse() && existing.Equal(&link) {
+			existing.Flags.SetAvailable()
+			d.write(i, existing)
+		}
+	}
+}
+
+// write stores the link at index i and increments the database delta
+func (d *Device) write(i int, link insteon.LinkRecord) {
+	for len(d.links) <= i {
+		d.links = append(d.links, insteon.LinkRecord{})
+	}
+	d.links[i] = link
+	d.flags[1]++
+}
+
+// readWriteALDB answers reads from, and writes to, the All-Link database.
+// Reads of zero records return every record up to and including the
+// high water mark
+func (d *Device) readWriteALDB(msg *insteon.Message) []*insteon.Message {
+	lr := &devices.LinkRequest{}
+	if err := lr.UnmarshalBinary(msg.Payload); err != nil {
+		return d.nak(msg, nakIllegalValue)
+	}
+
+	i, ok := index(lr.MemAddress)
+	if !ok {
+		return d.nak(msg, nakIllegalValue)
+	}
+
+	switch lr.Type {
+	case readLink:
+		responses := d.ack(msg, 0x00)
+		for n := 1; ; n++ {
+			link := d.record(i)
+			buf, _ := (&devices.LinkRequest{Type: linkResponse, MemAddress: memAddress(i), Link: &link}).MarshalBinary()
+			responses = append(responses, d.extended(msg.Src, commands.ReadWriteALDB, buf[:13]))
+			if n == lr.NumRecords || link.Flags.LastRecord() {
+				break
+			}
+			i++
+		}
+		return responses
+	case writeLink:
+		d.write(i, *lr.Link)
+		return d.ack(msg, 0x00)
+	}
+	return d.nak(msg, nakIllegalValue)
+}
+
+// heardController indicates if another device recently started a
+// linking session as the controller
+func (ls *linkState) heardController() bool {
+	return ls.heard != insteon.Address(0) && time.Since(ls.heardAt) < plmtest.LinkingTimeout
+}
+
+// enterLinking is the same as pressing the set button.  If another
+// device is waiting to link as the controller the device becomes the
+// responder, otherwise it starts a linking session as the controller
+func (d *Device) enterLinking(msg *insteon.Message) []*insteon.Message {
+	d.linking.active = true
+	d.linking.unlinking = msg.Command.Command1() == commands.EnterUnlinkingMode.Command1()
+	d.linking.group = insteon.Group(msg.Command.Command2())
+	d.linking.responder = !d.linking.unlinking && d.linking.heardController()
+
+	responses := d.ack(msg, byte(msg.Command.Command2()))
+	if d.linking.responder {
+		d.linking.heard = insteon.Address(0)
+		return append(responses, d.broadcast(commands.SetButtonPressedResponder))
+	}
+	return append(responses, d.broadcast(commands.SetButtonPressedController))
+}
+
+func (d *Device) exitLinking(msg *insteon.Message) []*insteon.Message {
+	d.linking.active = false
+	return d.ack(msg, 0x00)
+}
+
+// hear handles the set button pressed broadcasts sent by other devices
+// during a linking session.  A controller in linking mode that hears a
+// responder adds (or deletes) its controller link and tells the
+// responder to do the same
+func (d *Device) hear(msg *insteon.Message) []*insteon.Message {
+	switch msg.Command.Command1() {
+	case commands.SetButtonPressedController.Command1():
+		d.linking.heard, d.linking.heardAt = msg.Src, time.Now()
+	case commands.SetButtonPressedResponder.Command1():
+		d.linking.heard = insteon.Address(0)
+		if d.linking.active && !d.linking.responder {
+			d.linking.active = false
+			link := insteon.ControllerLink(d.linking.group, msg.Src)
+			link.Data = [3]byte{0x03, 0x00, byte(d.linking.group)}
+			if d.linking.unlinking {
+				d.deleteLink(link)
+				return []*insteon.Message{d.direct(msg.Src, commands.DeleteFromAllLinkGroup.SubCommand(int(link.Group)))}
+			}
+			d.addLink(link)
+			return []*insteon.Message{d.direct(msg.Src, commands.AssignToAllLinkGroup.SubCommand(int(link.Group)))}
+		}
+	}
+	return nil
+}
+
+// assign adds (or deletes) a responder link to the controller that sent
+// the message.  The device must be in linking mode
+func (d *Device) assign(msg *insteon.Message) []*insteon.Message {
+	if !d.linking.active {
+		return d.nak(msg, nakIllegalValue)
+	}
+
+	d.linking.active = false
+	link := insteon.ResponderLink(insteon.Group(msg.Command.Command2()), msg.Src)
+	link.Data = [3]byte{0xff, 0x1c, 0x01}
+	if msg.Command.Command1() == commands.DeleteFromAllLinkGroup.Command1() {
+		d.deleteLink(link)
+	} else {
+		d.addLink(link)
+	}
+	return d.ack(msg, byte(msg.Command.Command2()))
+}
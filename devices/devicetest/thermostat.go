@@ -0,0 +1,194 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devicetest
+
+import (
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+	"github.com/abates/insteon/devices"
+)
+
+// thermostatModes maps the thermostat control sub-commands to the mode
+// they select
+var thermostatModes = map[int]devices.ThermostatMode{
+	commands.SetHeat.Command2():        devices.Heat,
+	commands.SetCool.Command2():        devices.Cool,
+	commands.SetModeAuto.Command2():    devices.Auto,
+	commands.SetFan.Command2():         devices.FanOn,
+	commands.ClearFan.Command2():       devices.FanOff,
+	commands.ThermOff.Command2():       devices.ThermostatOff,
+	commands.SetProgramHeat.Command2(): devices.ProgramHeat,
+	commands.SetProgramCool.Command2(): devices.ProgramCool,
+	commands.SetProgramAuto.Command2(): devices.ProgramAuto,
+}
+
+// thermostat is the state of a simulated thermostat.  Temperatures are
+// in degrees Fahrenheit
+type thermostat struct {
+	mode     devices.ThermostatMode
+	fanSpeed devices.FanSpeed
+	state    devices.EquipmentState
+	flags    devices.ThermostatFlags
+	temp     int
+	humidity int
+	deadband int
+	cool     int
+	heat     int
+}
+
+// NewThermostat returns a simulated thermostat
+func NewThermostat(address insteon.Address, options ...Option) *Device {
+	d := newDevice(address, insteon.DevCat{0x05, 0x0b}, 0x0e)
+	t := &thermostat{
+		mode:     devices.Auto,
+		fanSpeed: devices.LowSpeed,
+		temp:     70,
+		humidity: 45,
+		deadband: 2,
+		cool:     76,
+		heat:     68,
+	}
+	d.therm = t
+
+	d.handlers[commands.DecreaseTemp.Command1()] = t.adjust(-1)
+	d.handlers[commands.IncreaseTemp.Command1()] = t.adjust(1)
+	d.handlers[commands.GetZoneInfo.Command1()] = t.zoneInfo
+	d.handlers[commands.GetThermostatMode.Command1()] = t.control
+	d.handlers[commands.SetCoolSetpoint.Command1()] = t.setpoint(&t.cool)
+	d.handlers[commands.SetHeatSetpoint.Command1()] = t.setpoint(&t.heat)
+
+	for _, o := range options {
+		o(d)
+	}
+	return d
+}
+
+// active is the set point for the current mode
+func (t *thermostat) active() *int {
+	if t.mode == devices.Cool || t.mode == devices.ProgramCool {
+		return &t.cool
+	}
+	return &t.heat
+}
+
+// adjust returns a handler that moves the active set point up or down.
+// The change, in half degrees, is in command 2 of standard messages or
+// D1 of extended messages
+func (t *thermostat) adjust(sign int) handler {
+	return func(d *Device, msg *insteon.Message) []*insteon.Message {
+		delta := msg.Command.Command2()
+		if msg.Flags.Extended() {
+			delta = int(msg.Payload[0])
+		}
+		*t.active() += sign * delta / 2
+		return d.ack(msg, byte(msg.Command.Command2()))
+	}
+}
+
+// setpoint returns a handler that sets the given set point.  The set
+// point, in half degrees, is in command 2 of standard messages or D1 of
+// extended messages
+func (t *thermostat) setpoint(setpoint *int) handler {
+	return func(d *Device, msg *insteon.Message) []*insteon.Message {
+		value := msg.Command.Command2()
+		if msg.Flags.Extended() {
+			value = int(msg.Payload[0])
+			t.deadband = int(msg.Payload[1]) / 2
+		}
+		*setpoint = value / 2
+		return d.ack(msg, byte(msg.Command.Command2()))
+	}
+}
+
+func (t *thermostat) zoneInfo(d *Device, msg *insteon.Message) []*insteon.Message {
+	var value int
+	switch msg.Command.Command2() & 0xf0 {
+	case 0x00:
+		value = t.temp * 2
+	case 0x10:
+		value = t.deadband * 2
+	case 0x20:
+		value = *t.active() * 2
+	case 0x30:
+		value = t.humidity
+	default:
+		return d.nak(msg, nakIllegalValue)
+	}
+	return d.ack(msg, byte(value))
+}
+
+// control answers the thermostat control (0x6b) commands
+func (t *thermostat) control(d *Device, msg *insteon.Message) []*insteon.Message {
+	cmd2 := msg.Command.Command2()
+	switch cmd2 {
+	case commands.GetThermostatMode.Command2():
+		return d.ack(msg, byte(t.mode))
+	case commands.GetAmbientTemp.Command2():
+		return d.ack(msg, byte(t.temp))
+	case commands.GetEquipmentState.Command2():
+		return d.ack(msg, byte(t.state))
+	case commands.GetFanOnSpeed.Command2():
+		return d.ack(msg, byte(t.fanSpeed))
+	case commands.SetFanOnLow.Command2():
+		t.fanSpeed = devices.LowSpeed
+	case commands.SetFanOnMed.Command2():
+		t.fanSpeed = devices.MedSpeed
+	case commands.SetFanOnHigh.Command2():
+		t.fanSpeed = devices.HighSpeed
+	case commands.DisableStatusMessage.Command2():
+	default:
+		mode, found := thermostatModes[cmd2]
+		if !found {
+			return d.nak(msg, nakIllegalValue)
+		}
+		t.mode = mode
+	}
+	return d.ack(msg, byte(cmd2))
+}
+
+// extendedGetSet answers requests for the two thermostat data sets and
+// stores the thermostat flags
+func (t *thermostat) extendedGetSet(d *Device, msg *insteon.Message) []*insteon.Message {
+	switch msg.Payload[1] {
+	case 0x00:
+		payload := make([]byte, 13)
+		payload[1] = 0x01
+		payload[2] = msg.Payload[2]
+		switch msg.Payload[2] {
+		case 0x00:
+			// the temperature is in tenths of a degree celsius
+			temp := (t.temp - 32) * 50 / 9
+			payload[3] = byte(temp)
+			payload[4] = byte(t.humidity)
+			payload[7] = byte(t.mode)
+			payload[8] = byte(t.fanSpeed)
+			payload[12] = byte(t.flags)
+			return append(d.ack(msg, 0x00), d.extended(msg.Src, commands.ExtendedGetSet, append(payload, byte(temp>>8))))
+		case 0x01:
+			payload[6] = byte(t.cool)
+			payload[7] = byte(t.heat)
+		default:
+			return d.nak(msg, nakIllegalValue)
+		}
+		return append(d.ack(msg, 0x00), d.extended(msg.Src, commands.ExtendedGetSet, payload))
+	case 0x04:
+		t.flags = devices.ThermostatFlags(msg.Payload[3])
+	case 0x08:
+		// enable status messages
+	default:
+		return d.nak(msg, nakIllegalValue)
+	}
+	return d.ack(msg, 0x00)
+}
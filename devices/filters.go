@@ -1,6 +1,10 @@
 package devices
 
-import "github.com/abates/insteon"
+import (
+	"context"
+
+	"github.com/abates/insteon"
+)
 
 type FilterFunc func(next MessageWriter) MessageWriter
 
@@ -13,26 +17,48 @@ type Filter interface {
 }
 
 type filter struct {
-	read  func() (*insteon.Message, error)
-	write func(*insteon.Message) (*insteon.Message, error)
+	read  func(context.Context) (*insteon.Message, error)
+	write func(context.Context, *insteon.Message) (*insteon.Message, error)
 }
 
 func (f *filter) Read() (*insteon.Message, error) {
-	return f.read()
+	return f.read(context.Background())
+}
+
+func (f *filter) ReadContext(ctx context.Context) (*insteon.Message, error) {
+	return f.read(ctx)
 }
 
 func (f *filter) Write(msg *insteon.Message) (*insteon.Message, error) {
-	return f.write(msg)
+	return f.write(context.Background(), msg)
+}
+
+func (f *filter) WriteContext(ctx context.Context, msg *insteon.Message) (*insteon.Message, error) {
+	return f.write(ctx, msg)
+}
+
+// readFunc returns the context aware read function of the MessageWriter
+func readFunc(mw MessageWriter) func(context.Context) (*insteon.Message, error) {
+	return func(ctx context.Context) (*insteon.Message, error) {
+		return readContext(ctx, mw)
+	}
+}
+
+// writeFunc returns the context aware write function of the MessageWriter
+func writeFunc(mw MessageWriter) func(context.Context, *insteon.Message) (*insteon.Message, error) {
+	return func(ctx context.Context, msg *insteon.Message) (*insteon.Message, error) {
+		return WriteContext(ctx, mw, msg)
+	}
 }
 
 func FilterDuplicates() Filter {
 	return FilterFunc(func(mw MessageWriter) MessageWriter {
 		cache := NewCache(10)
 		mw = cache.Filter(mw)
-		read := func() (*insteon.Message, error) {
-			msg, err := mw.Read()
+		read := func(ctx context.Context) (*insteon.Message, error) {
+			msg, err := readContext(ctx, mw)
 		top:
-			for ; err == nil; msg, err = mw.Read() {
+			for ; err == nil; msg, err = readContext(ctx, mw) {
 				if _, found := cache.Lookup(DuplicateMatcher(msg)); found {
 					LogDebug.Printf("Dropping duplicate message %v", msg)
 					continue top
@@ -44,7 +70,7 @@ func FilterDuplicates() Filter {
 
 		return &filter{
 			read:  read,
-			write: mw.Write,
+			write: writeFunc(mw),
 		}
 	})
 }
@@ -52,11 +78,11 @@ func FilterDuplicates() Filter {
 func TTL(ttl int) Filter {
 	return FilterFunc(func(mw MessageWriter) MessageWriter {
 		return &filter{
-			read: mw.Read,
-			write: func(msg *insteon.Message) (*insteon.Message, error) {
+			read: readFunc(mw),
+			write: func(ctx context.Context, msg *insteon.Message) (*insteon.Message, error) {
 				msg.SetMaxTTL(uint8(ttl))
 				msg.SetTTL(uint8(ttl))
-				return mw.Write(msg)
+				return WriteContext(ctx, mw, msg)
 			},
 		}
 	})
@@ -79,15 +105,15 @@ func NewCache(size int, messages ...*insteon.Message) *CacheFilter {
 }
 
 func (c *CacheFilter) Filter(next MessageWriter) MessageWriter {
-	c.filter.read = func() (*insteon.Message, error) {
-		msg, err := next.Read()
+	c.filter.read = func(ctx context.Context) (*insteon.Message, error) {
+		msg, err := readContext(ctx, next)
 		c.push(msg)
 		return msg, err
 	}
 
-	c.filter.write = func(msg *insteon.Message) (*insteon.Message, error) {
+	c.filter.write = func(ctx context.Context, msg *insteon.Message) (*insteon.Message, error) {
 		c.push(msg)
-		return next.Write(msg)
+		return WriteContext(ctx, next, msg)
 	}
 	return c
 }
@@ -140,29 +166,3 @@ func (c *CacheFilter) Lookup(matcher Matcher) (*insteon.Message, bool) {
 	}
 	return nil, false
 }
-
-func RetryFilter(tries int) Filter {
-	return FilterFunc(func(mw MessageWriter) MessageWriter {
-		return &filter{
-			read: mw.Read,
-			write: func(msg *insteon.Message) (ack *insteon.Message, err error) {
-				t := tries
-				for {
-					ack, err = mw.Write(msg)
-					if err == nil || err != ErrReadTimeout {
-						break
-					}
-
-					if t > 1 {
-						t--
-						Log.Printf("Read Timeout, retrying")
-					} else {
-						Log.Printf("Retry count exceeded (%d)", tries)
-						break
-					}
-				}
-				return
-			},
-		}
-	})
-}
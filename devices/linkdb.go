@@ -15,6 +15,7 @@
 package devices
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -150,7 +151,7 @@ func (ldb *linkdb) old() bool {
 	return ldb.age.Add(MaxLinkDbAge).Before(time.Now())
 }
 
-func (ldb *linkdb) refresh() error {
+func (ldb *linkdb) refresh(ctx context.Context) error {
 	if !ldb.old() {
 		return nil
 	}
@@ -161,10 +162,10 @@ func (ldb *linkdb) refresh() error {
 	lastAddress := MemAddress(0)
 
 	buf, _ := (&LinkRequest{Type: readLink, NumRecords: 0}).MarshalBinary()
-	_, err := ldb.Write(&insteon.Message{Command: commands.ReadWriteALDB, Payload: buf})
+	_, err := WriteContext(ctx, ldb.MessageWriter, &insteon.Message{Command: commands.ReadWriteALDB, Payload: buf})
 	var msg *insteon.Message
 	for err == nil {
-		msg, err = Read(ldb, CmdMatcher(commands.ReadWriteALDB))
+		msg, err = ReadContext(ctx, ldb.MessageWriter, CmdMatcher(commands.ReadWriteALDB))
 		if err == nil {
 			lr := &LinkRequest{}
 			err = lr.UnmarshalBinary(msg.Payload)
@@ -195,7 +196,13 @@ func (ldb *linkdb) refresh() error {
 // Links will retrieve the link-database from the device and
 // return a list of LinkRecords
 func (ldb *linkdb) Links() (links []insteon.LinkRecord, err error) {
-	err = ldb.refresh()
+	return ldb.LinksContext(context.Background())
+}
+
+// LinksContext is the same as Links, but the database retrieval
+// is aborted, with ctx.Err(), if the context is done first
+func (ldb *linkdb) LinksContext(ctx context.Context) (links []insteon.LinkRecord, err error) {
+	err = ldb.refresh(ctx)
 	if err == nil {
 		links = make([]insteon.LinkRecord, len(ldb.links))
 		copy(links, ldb.links)
@@ -208,7 +215,7 @@ func (ldb *linkdb) AddLinks(addLinks ...insteon.LinkRecord) (err error) {
 		return nil
 	}
 
-	err = ldb.refresh()
+	err = ldb.refresh(context.Background())
 	if err == nil {
 		for i, link := range ldb.links {
 			if link.Flags.Available() {
@@ -289,7 +296,7 @@ func (ldb *linkdb) writeLinks(links ...insteon.LinkRecord) (err error) {
 }
 
 func (ldb *linkdb) UpdateLinks(links ...insteon.LinkRecord) (err error) {
-	err = ldb.refresh()
+	err = ldb.refresh(context.Background())
 
 	if err == nil {
 		for i := 0; err == nil && i < len(links); i++ {
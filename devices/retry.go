@@ -0,0 +1,186 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devices
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+// RetryEvent describes a failed attempt that is about to be retried
+type RetryEvent struct {
+	// Address is the device the message was sent to.  It is zero
+	// when the command was sent to the IM
+	Address insteon.Address
+
+	// Attempt is the retry that is about to be made, starting at 1
+	Attempt int
+
+	// Err is the error returned by the failed attempt
+	Err error
+
+	// Delay is how long the retry waits before trying again
+	Delay time.Duration
+}
+
+// RetryPolicy determines how failed writes are retried.  Each retry
+// waits for an exponentially increasing backoff that is randomly
+// adjusted so that several senders don't keep colliding with each other
+type RetryPolicy struct {
+	// Retries is the number of times to try again after the first
+	// attempt fails
+	Retries int
+
+	// MinBackoff is the delay before the first retry.  The delay
+	// doubles with each subsequent retry
+	MinBackoff time.Duration
+
+	// MaxBackoff is the longest delay between retries
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction (0 to 1) of each delay that is randomly
+	// added to, or subtracted from, the delay
+	Jitter float64
+
+	// OnRetry, if set, is called before each retry
+	OnRetry func(RetryEvent)
+}
+
+// DefaultRetryPolicy is used by RetryFilter and by the PLM when no
+// other policy is given
+var DefaultRetryPolicy = RetryPolicy{
+	Retries:    3,
+	MinBackoff: 250 * time.Millisecond,
+	MaxBackoff: 4 * time.Second,
+	Jitter:     0.2,
+}
+
+// AckTimeout returns how long to wait for a device to acknowledge msg.
+// The timeout is taken from the "INSTEON Message Retrying" section of
+// the Insteon Developer's Guide and depends on the maximum number of
+// hops and whether the message is standard or extended
+func AckTimeout(msg *insteon.Message) time.Duration {
+	hops := int(msg.MaxTTL())
+	if hops >= len(retryTimes) {
+		hops = len(retryTimes) - 1
+	}
+
+	if msg.Flags.Extended() {
+		return retryTimes[hops].extended
+	}
+	return retryTimes[hops].standard
+}
+
+// Backoff returns the delay before the given retry, starting at 1
+func (rp RetryPolicy) Backoff(retry int) time.Duration {
+	delay := rp.MinBackoff
+	for i := 1; i < retry && (rp.MaxBackoff <= 0 || delay < rp.MaxBackoff); i++ {
+		delay *= 2
+	}
+
+	if rp.MaxBackoff > 0 && delay > rp.MaxBackoff {
+		delay = rp.MaxBackoff
+	}
+
+	if rp.Jitter > 0 {
+		delay += time.Duration(float64(delay) * rp.Jitter * (2*rand.Float64() - 1))
+	}
+	return delay
+}
+
+// Do calls fn until it succeeds, returns an error that retryable rejects,
+// the retries are used up or the context is done.  Each retry waits at
+// least minDelay, which is normally the time it takes the previous
+// attempt to clear the network.  The last error from fn is returned
+func (rp RetryPolicy) Do(ctx context.Context, address insteon.Address, minDelay time.Duration, retryable func(error) bool, fn func() error) error {
+	err := fn()
+	for attempt := 1; err != nil && retryable(err); attempt++ {
+		if attempt > rp.Retries {
+			LogDebug.Printf("Retry count exceeded (%d)", rp.Retries)
+			break
+		}
+
+		delay := rp.Backoff(attempt)
+		if delay < minDelay {
+			delay = minDelay
+		}
+
+		LogDebug.Printf("%v, retrying in %v", err, delay)
+		if rp.OnRetry != nil {
+			rp.OnRetry(RetryEvent{Address: address, Attempt: attempt, Err: err, Delay: delay})
+		}
+
+		if err := Sleep(ctx, delay); err != nil {
+			return err
+		}
+		err = fn()
+	}
+	return err
+}
+
+// IsTimeout indicates if the error is from a device (or IM) that didn't
+// respond in time
+func IsTimeout(err error) bool {
+	return errors.Is(err, ErrReadTimeout) || errors.Is(err, insteon.ErrReadTimeout)
+}
+
+// Retry returns a filter that retries messages, according to the policy,
+// when the device doesn't acknowledge them in time
+func Retry(policy RetryPolicy) Filter {
+	return FilterFunc(func(mw MessageWriter) MessageWriter {
+		return &filter{
+			read: readFunc(mw),
+			write: func(ctx context.Context, msg *insteon.Message) (ack *insteon.Message, err error) {
+				buf, _ := msg.MarshalBinary()
+				minDelay := insteon.PropagationDelay(msg.MaxTTL(), len(buf))
+				err = policy.Do(ctx, msg.Dst, minDelay, IsTimeout, func() (err error) {
+					ack, err = WriteContext(ctx, mw, msg)
+					return err
+				})
+				return ack, err
+			},
+		}
+	})
+}
+
+// RetryFilter returns a filter that makes up to the given number of tries
+// to deliver each message using the DefaultRetryPolicy
+func RetryFilter(tries int) Filter {
+	policy := DefaultRetryPolicy
+	policy.Retries = tries - 1
+	return Retry(policy)
+}
+
+// Sleep pauses for the given duration or until the context is done,
+// whichever comes first.  ctx.Err() is returned if the context finished
+// before the duration elapsed
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
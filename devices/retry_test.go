@@ -0,0 +1,188 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+)
+
+func TestAckTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags insteon.Flags
+		want  time.Duration
+	}{
+		{"standard 0 hops", insteon.Flag(insteon.MsgTypeDirect, false, 0, 0), 1400 * time.Millisecond},
+		{"standard 3 hops", insteon.Flag(insteon.MsgTypeDirect, false, 3, 3), 2000 * time.Millisecond},
+		{"extended 1 hop", insteon.Flag(insteon.MsgTypeDirect, true, 1, 1), 2690 * time.Millisecond},
+		{"extended 3 hops", insteon.Flag(insteon.MsgTypeDirect, true, 3, 3), 3170 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := AckTimeout(&insteon.Message{Flags: test.flags})
+			if got != test.want {
+				t.Errorf("Wanted timeout %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("retry %d", test.retry), func(t *testing.T) {
+			if got := policy.Backoff(test.retry); got != test.want {
+				t.Errorf("Wanted backoff %v got %v", test.want, got)
+			}
+
+			jittered := policy
+			jittered.Jitter = 0.5
+			got := jittered.Backoff(test.retry)
+			if got < test.want/2 || got > test.want*3/2 {
+				t.Errorf("Wanted backoff within 50%% of %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	tests := []struct {
+		name    string
+		errors  []error
+		retries int
+		want    error
+	}{
+		{"happy path", []error{nil}, 0, nil},
+		{"retry success", []error{ErrReadTimeout, nil}, 1, nil},
+		{"retry timeout", []error{ErrReadTimeout, ErrReadTimeout}, 1, ErrReadTimeout},
+		{"third time's a charm", []error{ErrReadTimeout, ErrReadTimeout, nil}, 2, nil},
+		{"third time sometimes fails too", []error{ErrReadTimeout, ErrReadTimeout, ErrReadTimeout}, 2, ErrReadTimeout},
+		{"wrapped timeout", []error{fmt.Errorf("Device ACK %w", insteon.ErrReadTimeout), nil}, 1, nil},
+		{"not retryable", []error{ErrNak, nil}, 1, ErrNak},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var events []RetryEvent
+			policy := RetryPolicy{Retries: test.retries, OnRetry: func(event RetryEvent) { events = append(events, event) }}
+			i := 0
+			got := policy.Do(context.Background(), insteon.Address(0x010203), 0, IsTimeout, func() error {
+				i++
+				return test.errors[i-1]
+			})
+
+			if !errors.Is(got, test.want) {
+				t.Errorf("Wanted error %v got %v", test.want, got)
+			}
+
+			if len(events) != i-1 {
+				t.Fatalf("Wanted %d retry events got %d", i-1, len(events))
+			}
+
+			for j, event := range events {
+				if event.Attempt != j+1 || event.Address != insteon.Address(0x010203) || event.Err != test.errors[j] {
+					t.Errorf("Unexpected retry event %+v", event)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{Retries: 3, MinBackoff: time.Hour, OnRetry: func(RetryEvent) { cancel() }}
+	err := policy.Do(ctx, insteon.Address(0), 0, IsTimeout, func() error { return ErrReadTimeout })
+	if err != context.Canceled {
+		t.Errorf("Wanted error %v got %v", context.Canceled, err)
+	}
+}
+
+// timeoutWriter times out the given number of writes before
+// acknowledging them
+type timeoutWriter struct {
+	testWriter
+	timeouts int
+}
+
+func (tw *timeoutWriter) Write(msg *insteon.Message) (*insteon.Message, error) {
+	ack, err := tw.testWriter.Write(msg)
+	if len(tw.written) <= tw.timeouts {
+		return nil, fmt.Errorf("Device ACK %w", insteon.ErrReadTimeout)
+	}
+	return ack, err
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		tries      int
+		timeouts   int
+		wantWrites int
+		wantErr    error
+	}{
+		{"no timeout", 3, 0, 1, nil},
+		{"one timeout", 3, 1, 2, nil},
+		{"too many timeouts", 2, 2, 2, insteon.ErrReadTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tw := &timeoutWriter{timeouts: test.timeouts}
+			policy := RetryPolicy{Retries: test.tries - 1}
+			msg := &insteon.Message{Dst: insteon.Address(0x010203), Flags: insteon.StandardDirectMessage, Command: commands.LightOn}
+			_, err := Retry(policy).Filter(tw).Write(msg)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if len(tw.written) != test.wantWrites {
+				t.Errorf("Wanted %d writes got %d", test.wantWrites, len(tw.written))
+			}
+		})
+	}
+}
+
+func TestRetryFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		tries      int
+		wantWrites int
+		wantErr    error
+	}{
+		{"one try", 1, 1, insteon.ErrReadTimeout},
+		{"two tries", 2, 2, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tw := &timeoutWriter{timeouts: 1}
+			msg := &insteon.Message{Dst: insteon.Address(0x010203), Flags: insteon.StandardDirectMessage, Command: commands.LightOn}
+			_, err := RetryFilter(test.tries).Filter(tw).Write(msg)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if len(tw.written) != test.wantWrites {
+				t.Errorf("Wanted %d writes got %d", test.wantWrites, len(tw.written))
+			}
+		})
+	}
+}
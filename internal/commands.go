@@ -204,6 +204,11 @@ func init() {
 				output: "COMMANDS.md",
 				data:   func() interface{} { return commands },
 			},
+			{
+				input:  "internal/insteon.lua.tmpl",
+				output: "wireshark/insteon.lua",
+				data:   func() interface{} { return commands },
+			},
 		},
 	}
 }
@@ -0,0 +1,156 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+// BackupVersion is the version of the backup document written by Backup
+const BackupVersion = 1
+
+// ErrBackupVersion is returned when reading a backup written by an
+// unsupported version
+var ErrBackupVersion = errors.New("unsupported backup version")
+
+// Backup is a copy of everything needed to move an IM's setup to
+// another IM
+type Backup struct {
+	Version int                  `json:"version"`
+	Created time.Time            `json:"created"`
+	Info    Info                 `json:"info"`
+	Config  Config               `json:"config"`
+	Links   []insteon.LinkRecord `json:"links"`
+}
+
+// ReadBackup reads a JSON backup document
+func ReadBackup(reader io.Reader) (*Backup, error) {
+	backup := &Backup{}
+	if err := json.NewDecoder(reader).Decode(backup); err != nil {
+		return nil, err
+	}
+
+	if backup.Version != BackupVersion {
+		return nil, fmt.Errorf("%w %d", ErrBackupVersion, backup.Version)
+	}
+	return backup, nil
+}
+
+// Write writes the backup as a JSON document
+func (backup *Backup) Write(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(backup)
+}
+
+// RestoreResult describes what Restore did
+type RestoreResult struct {
+	// Info is the IM that the backup was restored to
+	Info *Info
+
+	// Replaced is true if the backup was taken from a different IM.
+	// Devices that link to the IM still refer to the old address and
+	// must be linked to the new one
+	Replaced bool
+
+	// Links is the result of rewriting the All-Link database
+	Links *RewriteReport
+}
+
+// Backup reads the IM's info, config and All-Link database
+func (plm *PLM) Backup() (*Backup, error) {
+	return plm.BackupContext(context.Background())
+}
+
+// BackupContext is the same as Backup, but gives up once the context is
+// done
+func (plm *PLM) BackupContext(ctx context.Context) (*Backup, error) {
+	info, err := plm.info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := plm.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := plm.linkdb.LinksContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backup{
+		Version: BackupVersion,
+		Created: time.Now(),
+		Info:    *info,
+		Config:  config,
+		Links:   links,
+	}, nil
+}
+
+// Restore applies the backup's config and All-Link database to the IM
+func (plm *PLM) Restore(backup *Backup) (*RestoreResult, error) {
+	return plm.RestoreContext(context.Background(), backup)
+}
+
+// RestoreContext applies the backup's config to the IM and rewrites the
+// IM's All-Link database (see RewriteLinks) to match the backup.  The
+// database is then read back to confirm it matches.  The backup may be
+// restored to a different IM, such as when replacing a failed one, in
+// which case the result is marked as replaced.  The result so far is
+// returned along with any error
+func (plm *PLM) RestoreContext(ctx context.Context, backup *Backup) (result *RestoreResult, err error) {
+	if backup.Version != BackupVersion {
+		return nil, fmt.Errorf("%w %d", ErrBackupVersion, backup.Version)
+	}
+
+	result = &RestoreResult{}
+	if result.Info, err = plm.info(ctx); err != nil {
+		return result, err
+	}
+
+	if result.Info.Address != backup.Info.Address {
+		Log.Printf("Restoring the backup of %v to %v, devices linked to %v must be linked to %v", backup.Info.Address, result.Info.Address, backup.Info.Address, result.Info.Address)
+		result.Replaced = true
+	}
+
+	if err = plm.setConfig(ctx, backup.Config); err != nil {
+		return result, err
+	}
+
+	if result.Links, err = plm.linkdb.RewriteLinks(ctx, backup.Links...); err != nil {
+		return result, err
+	}
+
+	links, err := plm.linkdb.LinksContext(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	for _, change := range plan(links, backup.Links) {
+		if change.Action != LinkSkipped {
+			return result, fmt.Errorf("%w: %v", ErrVerifyFailed, change)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,32 @@
+package plm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadBackup(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"current", `{"version": 1, "info": {"address": "01.02.03", "devCat": "03.15", "firmware": 158}, "config": 64, "links": ["UC 1 04.05.06 00 00 00"]}`, nil},
+		{"future", `{"version": 2}`, ErrBackupVersion},
+		{"missing", `{}`, ErrBackupVersion},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backup, err := ReadBackup(strings.NewReader(test.input))
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			} else if err == nil {
+				if backup.Info.Address.String() != "01.02.03" || backup.Config != Config(0x40) || len(backup.Links) != 1 || backup.Links[0].Address.String() != "04.05.06" {
+					t.Errorf("Unexpected backup %+v", backup)
+				}
+			}
+		})
+	}
+}
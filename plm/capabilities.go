@@ -0,0 +1,124 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abates/insteon"
+)
+
+// Quirk is a known misbehavior of an IM model
+type Quirk int
+
+const (
+	// QuirkShiftedRecords means the IM sometimes stores a link record
+	// shifted over by a few bytes.  The linkdb detects this from the
+	// ACK and rewrites the record
+	QuirkShiftedRecords Quirk = 1 << iota
+)
+
+func (q Quirk) String() string {
+	var quirks []string
+	if q&QuirkShiftedRecords == QuirkShiftedRecords {
+		quirks = append(quirks, "shifted records")
+	}
+
+	if len(quirks) == 0 {
+		return "none"
+	}
+	return strings.Join(quirks, ", ")
+}
+
+// Capabilities describes what an IM model supports
+type Capabilities struct {
+	// Model is the product number, such as 2413U, or "Unknown"
+	Model string
+
+	// Description is the product name
+	Description string
+
+	// Capacity is the number of records the All-Link database holds
+	Capacity int
+
+	// RFSleep is true if the IM supports RFSleep
+	RFSleep bool
+
+	// HostCategory is true if the IM supports SetDeviceCategory
+	HostCategory bool
+
+	// Quirks are the known problems with the model
+	Quirks Quirk
+}
+
+// Has returns true if the IM has the given quirk
+func (c *Capabilities) Has(quirk Quirk) bool {
+	return c.Quirks&quirk == quirk
+}
+
+// Full returns true if a database of n records is within 5% of the
+// IM's capacity
+func (c *Capabilities) Full(n int) bool {
+	return n >= c.Capacity-c.Capacity/20
+}
+
+func (c *Capabilities) String() string {
+	return fmt.Sprintf("%s %s (%d links)", c.Model, c.Description, c.Capacity)
+}
+
+// UnknownCapabilities are used when the IM's device category isn't
+// recognized.  They are conservative, the smallest database of any
+// model and none of the optional commands
+var UnknownCapabilities = Capabilities{
+	Model:       "Unknown",
+	Description: "Insteon Modem",
+	Capacity:    417,
+	Quirks:      QuirkShiftedRecords,
+}
+
+// models maps the network bridge (0x03) sub-categories reported by IMs
+// to their capabilities
+var models = map[insteon.DevCat]Capabilities{
+	{0x03, 0x05}: {Model: "2412S", Description: "PowerLinc Serial Modem", Capacity: 417, HostCategory: true},
+	{0x03, 0x0b}: {Model: "2412U", Description: "PowerLinc USB Modem", Capacity: 417, HostCategory: true},
+	{0x03, 0x13}: {Model: "2413S", Description: "PowerLinc Serial Modem (Dual-Band)", Capacity: 1000, RFSleep: true, HostCategory: true, Quirks: QuirkShiftedRecords},
+	{0x03, 0x15}: {Model: "2413U", Description: "PowerLinc USB Modem (Dual-Band)", Capacity: 1000, RFSleep: true, HostCategory: true, Quirks: QuirkShiftedRecords},
+	{0x03, 0x1b}: {Model: "2242", Description: "Insteon Hub", Capacity: 1000, HostCategory: true, Quirks: QuirkShiftedRecords},
+	{0x03, 0x33}: {Model: "2245", Description: "Insteon Hub 2", Capacity: 1000, HostCategory: true, Quirks: QuirkShiftedRecords},
+}
+
+// Capabilities returns the capabilities of the IM model described by
+// the info.  UnknownCapabilities are returned if the model isn't known.
+// Only the device category is used, the firmware version is ignored
+// since the capabilities (and quirks) are known per model rather than
+// per firmware release
+func (info *Info) Capabilities() *Capabilities {
+	caps := UnknownCapabilities
+	if c, found := models[info.DevCat]; found {
+		caps = c
+	}
+	return &caps
+}
+
+// Capabilities gets the IM's info and returns the capabilities of its
+// model
+func (plm *PLM) Capabilities() (*Capabilities, error) {
+	info, err := plm.Info()
+	if err != nil {
+		return nil, err
+	}
+	return info.Capabilities(), nil
+}
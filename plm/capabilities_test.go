@@ -0,0 +1,77 @@
+package plm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		name             string
+		devCat           insteon.DevCat
+		wantModel        string
+		wantRFSleep      bool
+		wantShiftRecords bool
+	}{
+		{"2413U", insteon.DevCat{0x03, 0x15}, "2413U", true, true},
+		{"2412S", insteon.DevCat{0x03, 0x05}, "2412S", false, false},
+		{"unknown", insteon.DevCat{0x03, 0xfe}, "Unknown", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := &Info{DevCat: test.devCat}
+			got := info.Capabilities()
+			if got.Model != test.wantModel {
+				t.Errorf("Wanted model %q got %q", test.wantModel, got.Model)
+			}
+
+			if got.RFSleep != test.wantRFSleep {
+				t.Errorf("Wanted RF sleep %v got %v", test.wantRFSleep, got.RFSleep)
+			}
+
+			if got.Has(QuirkShiftedRecords) != test.wantShiftRecords {
+				t.Errorf("Wanted shifted records %v got %v", test.wantShiftRecords, got.Has(QuirkShiftedRecords))
+			}
+		})
+	}
+}
+
+func TestCapabilitiesFull(t *testing.T) {
+	caps := &Capabilities{Capacity: 1000}
+	tests := []struct {
+		links int
+		want  bool
+	}{
+		{0, false},
+		{949, false},
+		{950, true},
+		{1000, true},
+	}
+
+	for _, test := range tests {
+		if got := caps.Full(test.links); got != test.want {
+			t.Errorf("Wanted Full(%d) %v got %v", test.links, test.want, got)
+		}
+	}
+}
+
+func TestPLMCapabilities(t *testing.T) {
+	im := newTestIM(func(pkt []byte) [][]byte {
+		return [][]byte{{0x02, 0x60, 0x01, 0x02, 0x03, 0x03, 0x15, 0x9e, 0x06}}
+	})
+	defer im.Close()
+	modem := New(im, Timeout(time.Second))
+	defer modem.Close()
+
+	got, err := modem.Capabilities()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got.Model != "2413U" || got.Capacity != 1000 {
+		t.Errorf("Wanted 2413U with 1000 links got %v", got)
+	}
+}
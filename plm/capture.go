@@ -0,0 +1,354 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+// ErrNotCapture is returned when reading something that isn't a capture
+var ErrNotCapture = errors.New("not an IM capture")
+
+// captureMagic starts every capture, the last byte is the format
+// version
+var captureMagic = []byte{'I', 'M', 'C', 'A', 'P', 0x00, 0x00, 0x01}
+
+// Direction is the direction bytes were travelling when they were
+// captured
+type Direction byte
+
+const (
+	// FromIM is data the IM sent to the host
+	FromIM Direction = 0x00
+
+	// ToIM is data the host sent to the IM
+	ToIM Direction = 0x01
+)
+
+func (d Direction) String() string {
+	switch d {
+	case FromIM:
+		return "RX"
+	case ToIM:
+		return "TX"
+	}
+	return fmt.Sprintf("Direction(%d)", byte(d))
+}
+
+// CaptureRecord is one read from, or write to, the IM
+type CaptureRecord struct {
+	Time      time.Time
+	Direction Direction
+	Data      []byte
+}
+
+func (cr CaptureRecord) String() string {
+	return fmt.Sprintf("%s %v %s", cr.Time.Format("15:04:05.000000"), cr.Direction, hexDump("%02x", cr.Data, " "))
+}
+
+// MarshalBinary encodes the record as the time (unix nanoseconds, 8
+// bytes), direction (1 byte), length (2 bytes) and then the data.  All
+// numbers are big endian
+func (cr *CaptureRecord) MarshalBinary() ([]byte, error) {
+	if len(cr.Data) > 0xffff {
+		return nil, fmt.Errorf("capture record too long (%d bytes)", len(cr.Data))
+	}
+
+	buf := make([]byte, 11+len(cr.Data))
+	binary.BigEndian.PutUint64(buf[0:8], uint64(cr.Time.UnixNano()))
+	buf[8] = byte(cr.Direction)
+	binary.BigEndian.PutUint16(buf[9:11], uint16(len(cr.Data)))
+	copy(buf[11:], cr.Data)
+	return buf, nil
+}
+
+// RecordWriter is anything that captured records can be written to,
+// such as a CaptureWriter or a PcapngWriter
+type RecordWriter interface {
+	WriteRecord(record CaptureRecord) error
+}
+
+// CaptureWriter writes capture records to a file (or any io.Writer).  It
+// is safe to use from multiple goroutines
+type CaptureWriter struct {
+	mu     sync.Mutex
+	writer io.Writer
+	err    error
+}
+
+// NewCaptureWriter writes the capture header and returns a writer for
+// the records
+func NewCaptureWriter(writer io.Writer) (*CaptureWriter, error) {
+	if _, err := writer.Write(captureMagic); err != nil {
+		return nil, err
+	}
+	return &CaptureWriter{writer: writer}, nil
+}
+
+// WriteRecord appends the record to the capture.  Once a write fails,
+// the error is returned for every following record
+func (cw *CaptureWriter) WriteRecord(record CaptureRecord) error {
+	buf, err := record.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.err == nil {
+		_, cw.err = cw.writer.Write(buf)
+	}
+	return cw.err
+}
+
+// CaptureReader reads records from a capture
+type CaptureReader struct {
+	reader *bufio.Reader
+}
+
+// NewCaptureReader checks the capture header and returns a reader for
+// the records
+func NewCaptureReader(reader io.Reader) (*CaptureReader, error) {
+	cr := &CaptureReader{reader: bufio.NewReader(reader)}
+	magic := make([]byte, len(captureMagic))
+	if _, err := io.ReadFull(cr.reader, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrNotCapture
+		}
+		return nil, err
+	}
+
+	if !bytes.Equal(magic, captureMagic) {
+		return nil, ErrNotCapture
+	}
+	return cr, nil
+}
+
+// ReadRecord returns the next record, or io.EOF at the end of the
+// capture
+func (cr *CaptureReader) ReadRecord() (record CaptureRecord, err error) {
+	header := make([]byte, 11)
+	if _, err = io.ReadFull(cr.reader, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w: truncated capture record", insteon.ErrBufferTooShort)
+		}
+		return record, err
+	}
+
+	record.Time = time.Unix(0, int64(binary.BigEndian.Uint64(header[0:8])))
+	record.Direction = Direction(header[8])
+	record.Data = make([]byte, binary.BigEndian.Uint16(header[9:11]))
+	if _, err = io.ReadFull(cr.reader, record.Data); err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("%w: truncated capture record", insteon.ErrBufferTooShort)
+	}
+	return record, err
+}
+
+// Recorder is an io.ReadWriteCloser that records everything read from,
+// and written to, the underlying port
+type Recorder struct {
+	port    io.ReadWriter
+	capture RecordWriter
+	once    sync.Once
+}
+
+// Record wraps the port so that all traffic is recorded to the capture.
+// Pass the recorder to New (or the Reconnect dial function) in place of
+// the port.  Failing to write the capture is logged but doesn't
+// interrupt communication with the IM
+func Record(port io.ReadWriter, capture RecordWriter) *Recorder {
+	return &Recorder{port: port, capture: capture}
+}
+
+func (r *Recorder) record(direction Direction, data []byte) {
+	record := CaptureRecord{Time: time.Now(), Direction: direction, Data: append([]byte{}, data...)}
+	if err := r.capture.WriteRecord(record); err != nil {
+		r.once.Do(func() { Log.Printf("Failed to write capture: %v", err) })
+	}
+}
+
+func (r *Recorder) Read(buf []byte) (n int, err error) {
+	n, err = r.port.Read(buf)
+	if n > 0 {
+		r.record(FromIM, buf[0:n])
+	}
+	return n, err
+}
+
+func (r *Recorder) Write(buf []byte) (n int, err error) {
+	n, err = r.port.Write(buf)
+	if n > 0 {
+		r.record(ToIM, buf[0:n])
+	}
+	return n, err
+}
+
+// Close closes the port, if it is an io.Closer
+func (r *Recorder) Close() error {
+	if closer, ok := r.port.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// replay plays the records of a capture into pipes
+type replay struct {
+	records []CaptureRecord
+	speed   float64
+	fromIM  *io.PipeWriter
+	toIM    *io.PipeWriter
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newReplay(capture io.Reader, speed float64) (*replay, error) {
+	reader, err := NewCaptureReader(capture)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &replay{speed: speed, done: make(chan struct{})}
+	for {
+		record, err := reader.ReadRecord()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		r.records = append(r.records, record)
+	}
+	return r, nil
+}
+
+func (r *replay) run() {
+	start := time.Now()
+
+	// a write fails once its reader has been closed, the rest of the
+	// data for that reader is skipped
+	open := map[*io.PipeWriter]bool{r.fromIM: true}
+	if r.toIM != nil {
+		open[r.toIM] = true
+	}
+
+	for _, record := range r.records {
+		if r.speed > 0 {
+			offset := time.Duration(float64(record.Time.Sub(r.records[0].Time)) / r.speed)
+			timer := time.NewTimer(time.Until(start.Add(offset)))
+			select {
+			case <-timer.C:
+			case <-r.done:
+				timer.Stop()
+				return
+			}
+		}
+
+		w := r.fromIM
+		if record.Direction != FromIM {
+			w = r.toIM
+		}
+
+		if !open[w] {
+			continue
+		}
+
+		if _, err := w.Write(record.Data); err != nil {
+			delete(open, w)
+			if len(open) == 0 {
+				break
+			}
+		}
+	}
+
+	r.fromIM.Close()
+	if r.toIM != nil {
+		r.toIM.Close()
+	}
+}
+
+func (r *replay) stop() {
+	r.once.Do(func() {
+		close(r.done)
+		r.fromIM.CloseWithError(ErrClosed)
+		if r.toIM != nil {
+			r.toIM.CloseWithError(ErrClosed)
+		}
+	})
+}
+
+// Replayer is an io.ReadWriteCloser that plays back the data the IM sent
+// in a capture.  Data written to the replayer is discarded
+type Replayer struct {
+	replay *replay
+	reader *io.PipeReader
+}
+
+// Replay returns an IM port, to be passed to New, that plays back the
+// capture.  The data the IM sent is read with the same timing as when it
+// was captured, divided by speed.  A speed of 2 plays the capture twice
+// as fast, and a speed of 0 plays it as fast as it can be read.  Reads
+// return io.EOF at the end of the capture
+func Replay(capture io.Reader, speed float64) (*Replayer, error) {
+	r, err := newReplay(capture, speed)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	r.fromIM = writer
+	go r.run()
+	return &Replayer{replay: r, reader: reader}, nil
+}
+
+func (r *Replayer) Read(buf []byte) (int, error) { return r.reader.Read(buf) }
+
+// Write discards the data, since the IM's responses are already in the
+// capture
+func (r *Replayer) Write(buf []byte) (int, error) { return len(buf), nil }
+
+// Close stops the replay
+func (r *Replayer) Close() error {
+	r.replay.stop()
+	return nil
+}
+
+// ReplaySnoop plays back both directions of the capture, with the same
+// timing as Replay, for use with Snoop.  The first reader returns the
+// data the host sent to the IM and the second returns the data the IM
+// sent to the host, in the order that Snoop takes them.  Each write
+// waits for the data to be read, so both readers must be read for the
+// replay to proceed.  Closing a reader skips the rest of its data and
+// the other reader gets the rest of the replay
+func ReplaySnoop(capture io.Reader, speed float64) (toIM, fromIM io.ReadCloser, err error) {
+	r, err := newReplay(capture, speed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	toReader, toWriter := io.Pipe()
+	fromReader, fromWriter := io.Pipe()
+	r.toIM = toWriter
+	r.fromIM = fromWriter
+	go r.run()
+	return toReader, fromReader, nil
+}
@@ -0,0 +1,184 @@
+package plm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+type capturePort struct {
+	io.Reader
+	bytes.Buffer
+}
+
+func (cp *capturePort) Read(buf []byte) (int, error) { return cp.Reader.Read(buf) }
+
+func TestCaptureRecordReplay(t *testing.T) {
+	stdMsg := []byte{0x02, 0x50, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x0f, 0x11, 0xff}
+	port := &capturePort{Reader: bytes.NewReader(stdMsg)}
+	capture := &bytes.Buffer{}
+	cw, err := NewCaptureWriter(capture)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	recorder := Record(port, cw)
+	recorder.Write([]byte{0x02, 0x60})
+	buf := make([]byte, len(stdMsg))
+	io.ReadFull(recorder, buf)
+
+	cr, err := NewCaptureReader(bytes.NewReader(capture.Bytes()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got []CaptureRecord
+	for {
+		record, err := cr.ReadRecord()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		got = append(got, record)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Wanted 2 records got %d", len(got))
+	}
+
+	if got[0].Direction != ToIM || !bytes.Equal(got[0].Data, []byte{0x02, 0x60}) {
+		t.Errorf("Wanted TX 02 60 got %v", got[0])
+	}
+
+	if got[1].Direction != FromIM || !bytes.Equal(got[1].Data, stdMsg) {
+		t.Errorf("Wanted RX %x got %v", stdMsg, got[1])
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		replayer, err := Replay(bytes.NewReader(capture.Bytes()), 0)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		modem := New(replayer, Timeout(time.Second))
+		defer modem.Close()
+
+		msg, err := modem.Read()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		want := &insteon.Message{}
+		want.UnmarshalBinary(stdMsg[2:])
+		if !reflect.DeepEqual(want, msg) {
+			t.Errorf("Wanted message %v got %v", want, msg)
+		}
+	})
+
+	t.Run("snoop", func(t *testing.T) {
+		toIM, fromIM, err := ReplaySnoop(bytes.NewReader(capture.Bytes()), 0)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		snooper := Snoop(toIM, fromIM)
+		defer snooper.Close()
+
+		msg, err := snooper.Read()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if msg.Src != insteon.Address(0x010203) {
+			t.Errorf("Wanted message from %v got %v", insteon.Address(0x010203), msg)
+		}
+	})
+}
+
+func TestReplaySnoopClosedReader(t *testing.T) {
+	capture := &bytes.Buffer{}
+	cw, _ := NewCaptureWriter(capture)
+	start := time.Now()
+	cw.WriteRecord(CaptureRecord{Time: start, Direction: ToIM, Data: []byte{0x01}})
+	cw.WriteRecord(CaptureRecord{Time: start, Direction: FromIM, Data: []byte{0x02}})
+	cw.WriteRecord(CaptureRecord{Time: start, Direction: ToIM, Data: []byte{0x03}})
+	cw.WriteRecord(CaptureRecord{Time: start, Direction: FromIM, Data: []byte{0x04}})
+
+	toIM, fromIM, err := ReplaySnoop(capture, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer fromIM.Close()
+
+	// nobody reads what the host sent, the IM's data still plays back
+	toIM.Close()
+	got, err := ioutil.ReadAll(fromIM)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !bytes.Equal([]byte{0x02, 0x04}, got) {
+		t.Errorf("Wanted 02 04 got %x", got)
+	}
+}
+
+func TestReplayTiming(t *testing.T) {
+	capture := &bytes.Buffer{}
+	cw, _ := NewCaptureWriter(capture)
+	start := time.Now()
+	cw.WriteRecord(CaptureRecord{Time: start, Direction: FromIM, Data: []byte{0x01}})
+	cw.WriteRecord(CaptureRecord{Time: start.Add(time.Second), Direction: FromIM, Data: []byte{0x02}})
+
+	replayer, err := Replay(capture, 20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer replayer.Close()
+
+	begin := time.Now()
+	got, err := ioutil.ReadAll(replayer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !bytes.Equal([]byte{0x01, 0x02}, got) {
+		t.Errorf("Wanted 01 02 got %x", got)
+	}
+
+	// one second played 20 times faster
+	if elapsed := time.Since(begin); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Wanted replay to take about 50ms got %v", elapsed)
+	}
+}
+
+func TestCaptureReaderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{"empty", nil, ErrNotCapture},
+		{"not a capture", []byte("not a capture"), ErrNotCapture},
+		{"truncated", append(append([]byte{}, captureMagic...), 0x00, 0x01), insteon.ErrBufferTooShort},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cr, err := NewCaptureReader(bytes.NewReader(test.input))
+			if err == nil {
+				_, err = cr.ReadRecord()
+			}
+
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+		})
+	}
+}
@@ -17,6 +17,41 @@ package plm
 
 var commandLens map[Command]int
 
+// hostLens is the payload length of the commands the host sends to the
+// IM, they have no ACK byte and (except for sending insteon messages)
+// none of the response that the IM adds when it echos the command.
+// Extended insteon messages have an additional 14 bytes
+var hostLens = map[Command]int{
+	CmdGetInfo:             0,
+	CmdSendAllLink:         3,
+	CmdSendInsteonMsg:      6,
+	CmdSendX10:             2,
+	CmdStartAllLink:        2,
+	CmdCancelAllLink:       0,
+	CmdSetHostCategory:     3,
+	CmdReset:               0,
+	CmdSetAckMsg:           1,
+	CmdGetFirstAllLink:     0,
+	CmdGetNextAllLink:      0,
+	CmdSetConfig:           1,
+	CmdGetAllLinkForSender: 0,
+	CmdLedOn:               0,
+	CmdLedOff:              0,
+	CmdManageAllLinkRecord: 9,
+	CmdSetNakMsgByte:       1,
+	CmdSetNameMsgTwoBytes:  2,
+	CmdRfSleep:             2,
+	CmdGetConfig:           0,
+}
+
+// HostPayloadLen returns the payload length of the command when it is
+// sent by the host to the IM.  False is returned if the host doesn't
+// send the command
+func HostPayloadLen(cmd Command) (length int, found bool) {
+	length, found = hostLens[cmd]
+	return length, found
+}
+
 type Command byte
 
 const (
@@ -82,7 +117,7 @@ func init() {
 		CmdManageAllLinkRecord:   10,
 		CmdSetNakMsgByte:         2,
 		CmdSetNameMsgTwoBytes:    3,
-		CmdRfSleep:               1,
+		CmdRfSleep:               3,
 		CmdGetConfig:             4,
 	}
 }
@@ -58,3 +58,23 @@ func TestCommand(t *testing.T) {
 		t.Errorf("Failed to parse file: %v", err)
 	}
 }
+
+func TestHostPayloadLen(t *testing.T) {
+	tests := []struct {
+		cmd       Command
+		want      int
+		wantFound bool
+	}{
+		{CmdGetInfo, 0, true},
+		{CmdSendInsteonMsg, 6, true},
+		{CmdManageAllLinkRecord, 9, true},
+		{CmdStdMsgReceived, 0, false},
+	}
+
+	for _, test := range tests {
+		got, found := HostPayloadLen(test.cmd)
+		if got != test.want || found != test.wantFound {
+			t.Errorf("%v: wanted %d %v got %d %v", test.cmd, test.want, test.wantFound, got, found)
+		}
+	}
+}
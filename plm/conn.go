@@ -0,0 +1,91 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abates/insteon"
+)
+
+// Conn is a devices.MessageWriter for a single Insteon device.  Conn
+// is returned by PLM.Dial and only reads messages that were sent by
+// the connected device
+type Conn struct {
+	plm    *PLM
+	addr   insteon.Address
+	msgBuf chan *insteon.Message
+}
+
+// deliver queues the message to be read.  If the buffer is full, the
+// oldest message is dropped since a device that isn't being read
+// (such as an open device that is idle) only needs its latest messages
+func (conn *Conn) deliver(msg *insteon.Message) {
+	for {
+		select {
+		case conn.msgBuf <- msg:
+			return
+		default:
+		}
+
+		select {
+		case dropped := <-conn.msgBuf:
+			LogDebug.Printf("Message %v dropped, connection buffer is full", dropped)
+		default:
+		}
+	}
+}
+
+// Address returns the address of the connected device
+func (conn *Conn) Address() insteon.Address {
+	return conn.addr
+}
+
+// Read returns the next message received from the device
+func (conn *Conn) Read() (*insteon.Message, error) {
+	return conn.ReadContext(context.Background())
+}
+
+// ReadContext returns the next message received from the device. The
+// wait is limited by both the PLM timeout and the context
+func (conn *Conn) ReadContext(ctx context.Context) (*insteon.Message, error) {
+	return conn.plm.readMessage(ctx, conn.msgBuf)
+}
+
+// Write sends the message to the device and waits for the ACK. The
+// message destination is always set to the address of the device
+func (conn *Conn) Write(msg *insteon.Message) (*insteon.Message, error) {
+	return conn.WriteContext(context.Background(), msg)
+}
+
+// WriteContext is the same as Write, but stops waiting for the
+// ACK when the context is done
+func (conn *Conn) WriteContext(ctx context.Context, msg *insteon.Message) (*insteon.Message, error) {
+	msg.Dst = conn.addr
+	return conn.plm.WriteContext(ctx, msg)
+}
+
+// Close removes the connection from the PLM.  Messages from the device
+// will be delivered to PLM.Read once all connections to the device
+// have been closed
+func (conn *Conn) Close() error {
+	conn.plm.hangup(conn)
+	return nil
+}
+
+func (conn *Conn) String() string {
+	return fmt.Sprintf("PLM Connection (%s)", conn.addr)
+}
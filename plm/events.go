@@ -0,0 +1,177 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"fmt"
+
+	"github.com/abates/insteon"
+)
+
+// Event is a report the IM sends on its own rather than in response to
+// a command.  Events are one of ButtonEvent, UserResetEvent,
+// CleanupFailureEvent or CleanupStatusEvent
+type Event interface {
+	fmt.Stringer
+}
+
+// ButtonAction is what was done to a button on the IM
+type ButtonAction byte
+
+const (
+	// ButtonTapped means the button was pressed and released
+	ButtonTapped ButtonAction = 0x02
+
+	// ButtonHeld means the button has been held down for more than
+	// three seconds
+	ButtonHeld ButtonAction = 0x03
+
+	// ButtonReleased means the button was released after being held
+	ButtonReleased ButtonAction = 0x04
+)
+
+func (ba ButtonAction) String() string {
+	switch ba {
+	case ButtonTapped:
+		return "Tapped"
+	case ButtonHeld:
+		return "Held"
+	case ButtonReleased:
+		return "Released"
+	}
+	return fmt.Sprintf("ButtonAction(%d)", byte(ba))
+}
+
+// ButtonEvent is sent when a button on the IM is used.  Button 1 is the
+// SET button, some IMs have a second and third button
+type ButtonEvent struct {
+	Button int
+	Action ButtonAction
+}
+
+func (be ButtonEvent) String() string {
+	if be.Button == 1 {
+		return fmt.Sprintf("SET button %v", be.Action)
+	}
+	return fmt.Sprintf("Button %d %v", be.Button, be.Action)
+}
+
+// UserResetEvent is sent when the user has factory reset the IM by
+// holding the SET button while it powered up.  The IM configuration and
+// All-Link database have been erased
+type UserResetEvent struct{}
+
+func (UserResetEvent) String() string { return "User reset" }
+
+// CleanupFailureEvent is sent when a device in the group didn't
+// acknowledge the All-Link cleanup message sent to it after an All-Link
+// broadcast
+type CleanupFailureEvent struct {
+	Group   insteon.Group
+	Address insteon.Address
+}
+
+func (cf CleanupFailureEvent) String() string {
+	return fmt.Sprintf("All-Link cleanup failed for %v in group %v", cf.Address, cf.Group)
+}
+
+// CleanupStatusEvent is sent once the IM has finished sending the
+// cleanup messages for an All-Link broadcast.  Success is false if the
+// cleanup was interrupted by other traffic
+type CleanupStatusEvent struct {
+	Success bool
+}
+
+func (cs CleanupStatusEvent) String() string {
+	if cs.Success {
+		return "All-Link cleanup completed"
+	}
+	return "All-Link cleanup aborted"
+}
+
+// decodeEvent returns the event for an unsolicited IM packet.  False
+// is returned if the packet is not an event, or is malformed
+func decodeEvent(pkt *Packet) (Event, bool) {
+	switch pkt.Command {
+	case CmdButtonEventReport:
+		if len(pkt.Payload) > 0 {
+			return ButtonEvent{Button: int(pkt.Payload[0]>>4) + 1, Action: ButtonAction(pkt.Payload[0] & 0x0f)}, true
+		}
+	case CmdUserResetDetected:
+		return UserResetEvent{}, true
+	case CmdAllLinkCleanupFailure:
+		if len(pkt.Payload) > 4 {
+			var addr insteon.Address
+			addr.Put(pkt.Payload[2:5])
+			return CleanupFailureEvent{Group: insteon.Group(pkt.Payload[1]), Address: addr}, true
+		}
+	case CmdAllLinkCleanupStatus:
+		if len(pkt.Payload) > 0 {
+			return CleanupStatusEvent{Success: pkt.Payload[0] == 0x06}, true
+		}
+	}
+	return nil, false
+}
+
+// eventChan is the channel of an EventSubscription
+type eventChan chan Event
+
+func (c eventChan) send(v interface{}) bool {
+	select {
+	case c <- v.(Event):
+		return true
+	default:
+	}
+	return false
+}
+
+func (c eventChan) discard() {
+	select {
+	case <-c:
+	default:
+	}
+}
+
+func (c eventChan) close() { close(c) }
+
+// EventSubscription receives the events reported by the IM
+type EventSubscription struct {
+	subscriber
+	ch chan Event
+}
+
+// SubscribeEvents returns a subscription that receives every event
+// reported by the IM.  Events are buffered (DefaultSubscriptionBuffer)
+// and dropped when the buffer is full.  The channel is closed when
+// Unsubscribe is called or the PLM stops reading
+func (plm *PLM) SubscribeEvents() *EventSubscription {
+	s := &EventSubscription{ch: make(chan Event, DefaultSubscriptionBuffer)}
+	s.topic = eventTopic
+	s.buf = eventChan(s.ch)
+	plm.subscribe(&s.subscriber)
+	return s
+}
+
+// Events returns the channel that events are delivered to
+func (s *EventSubscription) Events() <-chan Event {
+	return s.ch
+}
+
+// dispatchEvent delivers the event to every event subscription
+func (plm *PLM) dispatchEvent(event Event) {
+	plm.mu.Lock()
+	defer plm.mu.Unlock()
+	plm.publish(eventTopic, event)
+}
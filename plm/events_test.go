@@ -0,0 +1,68 @@
+package plm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  *Packet
+		want   Event
+		wantOk bool
+	}{
+		{"set button tapped", &Packet{Command: CmdButtonEventReport, Payload: []byte{0x02}}, ButtonEvent{1, ButtonTapped}, true},
+		{"button 2 held", &Packet{Command: CmdButtonEventReport, Payload: []byte{0x13}}, ButtonEvent{2, ButtonHeld}, true},
+		{"button 3 released", &Packet{Command: CmdButtonEventReport, Payload: []byte{0x24}}, ButtonEvent{3, ButtonReleased}, true},
+		{"user reset", &Packet{Command: CmdUserResetDetected}, UserResetEvent{}, true},
+		{"cleanup failure", &Packet{Command: CmdAllLinkCleanupFailure, Payload: []byte{0x01, 0x02, 0x03, 0x04, 0x05}}, CleanupFailureEvent{2, insteon.Address(0x030405)}, true},
+		{"cleanup success", &Packet{Command: CmdAllLinkCleanupStatus, Payload: []byte{0x06}}, CleanupStatusEvent{true}, true},
+		{"cleanup aborted", &Packet{Command: CmdAllLinkCleanupStatus, Payload: []byte{0x15}}, CleanupStatusEvent{false}, true},
+		{"short cleanup failure", &Packet{Command: CmdAllLinkCleanupFailure, Payload: []byte{0x01}}, nil, false},
+		{"not an event", &Packet{Command: CmdAllLinkComplete, Payload: make([]byte, 8)}, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := decodeEvent(test.input)
+			if ok != test.wantOk {
+				t.Errorf("Wanted ok %v got %v", test.wantOk, ok)
+			} else if got != test.want {
+				t.Errorf("Wanted event %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	port, rx := newTestPort()
+	defer rx.Close()
+	modem := New(port, Timeout(10*time.Millisecond))
+
+	sub := modem.SubscribeEvents()
+	go rx.Write([]byte{0x02, 0x54, 0x03, 0x02, 0x55})
+
+	for _, want := range []Event{ButtonEvent{1, ButtonHeld}, UserResetEvent{}} {
+		select {
+		case got := <-sub.Events():
+			if got != want {
+				t.Errorf("Wanted event %v got %v", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %v", want)
+		}
+	}
+
+	// events are not delivered to packet readers
+	if pkt, err := modem.ReadPacket(); err == nil {
+		t.Errorf("Expected no packets, got %v", pkt)
+	}
+
+	sub.Unsubscribe()
+	if _, open := <-sub.Events(); open {
+		t.Errorf("Expected the events channel to be closed")
+	}
+}
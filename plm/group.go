@@ -0,0 +1,199 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+	"github.com/abates/insteon/devices"
+)
+
+// GroupResult is the outcome of a group command sent by the IM
+type GroupResult struct {
+	Group   insteon.Group
+	Command commands.Command
+
+	// Responders are the devices that the IM's All-Link database lists
+	// as responders to the group
+	Responders []insteon.Address
+
+	// Acked are the devices that acknowledged the All-Link cleanup
+	Acked []insteon.Address
+
+	// Failed are the devices that the IM reported as not acknowledging
+	// the All-Link cleanup, or that NAK'd it
+	Failed []insteon.Address
+
+	// Complete is true if the IM reported that it finished sending the
+	// cleanup messages.  It is false if the cleanup was interrupted by
+	// other traffic or the IM never reported the cleanup status
+	Complete bool
+}
+
+// Unanswered returns the responders that neither acknowledged the
+// cleanup nor were reported as failed
+func (gr *GroupResult) Unanswered() (addresses []insteon.Address) {
+	for _, addr := range gr.Responders {
+		if !contains(gr.Acked, addr) && !contains(gr.Failed, addr) {
+			addresses = append(addresses, addr)
+		}
+	}
+	return addresses
+}
+
+func (gr *GroupResult) String() string {
+	return fmt.Sprintf("%v %v: %d responders, %d acked, %d failed", gr.Group, gr.Command, len(gr.Responders), len(gr.Acked), len(gr.Failed))
+}
+
+func contains(addresses []insteon.Address, addr insteon.Address) bool {
+	for _, a := range addresses {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupTimeout is how long to wait for the cleanup of each responder.
+// The IM sends every responder a direct cleanup message and may retry
+// it, so allow for two attempts with the maximum number of hops
+var cleanupTimeout = 2 * devices.AckTimeout(&insteon.Message{Flags: insteon.Flag(insteon.MsgTypeAllLinkCleanup, false, 3, 3)})
+
+// responders returns the devices that the IM controls in the group.
+// The IM can only search its database by group and address, so the
+// responders come from the cached links (see LinkCacheAge) rather than
+// reading the whole database for every group command
+func (plm *PLM) responders(ctx context.Context, group insteon.Group) (responders []insteon.Address, err error) {
+	links, err := plm.linkdb.LinksContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, link := range links {
+		if link.Flags.InUse() && link.Flags.Controller() && link.Group == group && !contains(responders, link.Address) {
+			responders = append(responders, link.Address)
+		}
+	}
+	return responders, nil
+}
+
+// SendGroupCommand sends the command to every device in the IM's
+// controller group
+func (plm *PLM) SendGroupCommand(group insteon.Group, cmd commands.Command) (*GroupResult, error) {
+	return plm.SendGroupCommandContext(context.Background(), group, cmd)
+}
+
+// SendGroupCommandContext has the IM broadcast the command to the group
+// and then waits while the IM sends the All-Link cleanup to each
+// responder in its All-Link database.  Other insteon messages are held
+// in the queue until the cleanup is finished, since any other traffic
+// would interrupt it.  The result lists the responders that
+// acknowledged the cleanup and those that didn't.  If the cleanup
+// doesn't finish in time, or the context is done first, the result so
+// far is returned along with the error
+func (plm *PLM) SendGroupCommandContext(ctx context.Context, group insteon.Group, cmd commands.Command) (*GroupResult, error) {
+	responders, err := plm.responders(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+
+	// hold the queue so nothing else is transmitted during the cleanup
+	r := plm.queue.push(&insteon.Message{Dst: insteon.Address(group), Flags: insteon.StandardAllLinkBroadcast, Command: cmd}, priority(ctx))
+	if _, err = plm.queue.wait(ctx, r); err != nil {
+		return nil, err
+	}
+	defer plm.queue.finish(r, nil, nil)
+
+	// subscribe prior to sending the command so that a fast cleanup
+	// can't get away
+	events := plm.SubscribeEvents()
+	defer events.Unsubscribe()
+
+	acks := plm.Subscribe(devices.Matches(func(msg *insteon.Message) bool {
+		return (msg.Type() == insteon.MsgTypeAllLinkCleanupAck || msg.Type() == insteon.MsgTypeAllLinkCleanupNak) &&
+			msg.Command.Command1() == cmd.Command1() && msg.Command.Command2() == int(group)
+	}))
+	defer acks.Unsubscribe()
+
+	result := &GroupResult{Group: group, Command: cmd, Responders: responders}
+	LogDebug.Printf("TX Group command %v to %v", cmd, group)
+	payload := []byte{byte(group), byte(cmd.Command1()), byte(cmd.Command2())}
+	_, err = retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: CmdSendAllLink, Payload: payload})
+	if err != nil || len(responders) == 0 {
+		return result, err
+	}
+
+	timer := time.NewTimer(plm.timeout + time.Duration(len(responders))*cleanupTimeout)
+	defer timer.Stop()
+
+	ack := func(msg *insteon.Message) {
+		if msg.Type() == insteon.MsgTypeAllLinkCleanupNak {
+			if !contains(result.Failed, msg.Src) {
+				result.Failed = append(result.Failed, msg.Src)
+			}
+		} else if !contains(result.Acked, msg.Src) {
+			result.Acked = append(result.Acked, msg.Src)
+		}
+	}
+
+	ackCh := acks.Messages()
+	for {
+		select {
+		case msg, open := <-ackCh:
+			if open {
+				ack(msg)
+			} else {
+				ackCh = nil
+			}
+		case event, open := <-events.Events():
+			if !open {
+				return result, ErrClosed
+			}
+
+			switch e := event.(type) {
+			case CleanupFailureEvent:
+				if e.Group == group && !contains(result.Failed, e.Address) {
+					result.Failed = append(result.Failed, e.Address)
+				}
+			case CleanupStatusEvent:
+				// ACKs received before the status are already buffered
+				for done := false; !done; {
+					select {
+					case msg, open := <-ackCh:
+						if open {
+							ack(msg)
+						} else {
+							done = true
+						}
+					default:
+						done = true
+					}
+				}
+				result.Complete = e.Success
+				return result, nil
+			}
+		case <-plm.done:
+			return result, ErrClosed
+		case <-timer.C:
+			return result, fmt.Errorf("All-Link cleanup %w", ErrReadTimeout)
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package plm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+)
+
+// newGroupIM returns a test IM with the given links that answers a group
+// command with the cleanup responses
+func newGroupIM(links []insteon.LinkRecord, cleanup ...[]byte) *testIM {
+	cursor := 0
+	return newTestIM(func(pkt []byte) [][]byte {
+		echo := append(append([]byte{}, pkt...), 0x06)
+		switch Command(pkt[1]) {
+		case CmdGetFirstAllLink, CmdGetNextAllLink:
+			if Command(pkt[1]) == CmdGetFirstAllLink {
+				cursor = 0
+			}
+
+			if cursor >= len(links) {
+				return [][]byte{append(append([]byte{}, pkt...), 0x15)}
+			}
+			buf, _ := links[cursor].MarshalBinary()
+			cursor++
+			return [][]byte{echo, append([]byte{0x02, byte(CmdAllLinkRecordResp)}, buf...)}
+		case CmdSendAllLink:
+			return append([][]byte{echo}, cleanup...)
+		}
+		return [][]byte{echo}
+	})
+}
+
+// cleanupAck is the cleanup ACK (or NAK) sent by src to the IM
+func cleanupAck(src byte, msgType insteon.MessageType, cmd commands.Command, group insteon.Group) []byte {
+	return []byte{0x02, 0x50, 0x01, 0x01, src, 0x0a, 0x0b, 0x0c, byte(insteon.Flag(msgType, false, 3, 3)), byte(cmd.Command1()), byte(group)}
+}
+
+func TestSendGroupCommand(t *testing.T) {
+	links := []insteon.LinkRecord{
+		insteon.ControllerLink(1, 0x010101),
+		insteon.ControllerLink(1, 0x010102),
+		insteon.ControllerLink(1, 0x010103),
+		insteon.ControllerLink(1, 0x010104),
+		insteon.ControllerLink(2, 0x010105),
+		insteon.ResponderLink(1, 0x010106),
+	}
+
+	tests := []struct {
+		name    string
+		cleanup [][]byte
+		want    *GroupResult
+		wantErr error
+	}{
+		{
+			name: "all acked",
+			cleanup: [][]byte{
+				cleanupAck(0x01, insteon.MsgTypeAllLinkCleanupAck, commands.LightOn, 1),
+				cleanupAck(0x02, insteon.MsgTypeAllLinkCleanupAck, commands.LightOn, 1),
+				cleanupAck(0x03, insteon.MsgTypeAllLinkCleanupAck, commands.LightOn, 1),
+				cleanupAck(0x04, insteon.MsgTypeAllLinkCleanupAck, commands.LightOn, 1),
+				{0x02, 0x58, 0x06},
+			},
+			want: &GroupResult{Acked: []insteon.Address{0x010101, 0x010102, 0x010103, 0x010104}, Complete: true},
+		},
+		{
+			name: "failures",
+			cleanup: [][]byte{
+				cleanupAck(0x01, insteon.MsgTypeAllLinkCleanupAck, commands.LightOn, 1),
+				{0x02, 0x56, 0x01, 0x01, 0x01, 0x01, 0x02},
+				cleanupAck(0x03, insteon.MsgTypeAllLinkCleanupNak, commands.LightOn, 1),
+				{0x02, 0x58, 0x06},
+			},
+			want: &GroupResult{Acked: []insteon.Address{0x010101}, Failed: []insteon.Address{0x010102, 0x010103}, Complete: true},
+		},
+		{
+			name: "aborted",
+			cleanup: [][]byte{
+				cleanupAck(0x01, insteon.MsgTypeAllLinkCleanupAck, commands.LightOn, 1),
+				cleanupAck(0x05, insteon.MsgTypeAllLinkCleanupAck, commands.LightOn, 2),
+				{0x02, 0x58, 0x15},
+			},
+			want: &GroupResult{Acked: []insteon.Address{0x010101}},
+		},
+		{
+			name: "no status",
+			cleanup: [][]byte{
+				cleanupAck(0x02, insteon.MsgTypeAllLinkCleanupAck, commands.LightOn, 1),
+			},
+			want:    &GroupResult{Acked: []insteon.Address{0x010102}},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			im := newGroupIM(links, test.cleanup...)
+			defer im.Close()
+			modem := New(im, Timeout(time.Second), PacingScale(0))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			got, err := modem.SendGroupCommandContext(ctx, 1, commands.LightOn)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			// ACKs and failures arrive on different channels, so
+			// their order isn't fixed
+			for _, addresses := range [][]insteon.Address{got.Acked, got.Failed} {
+				sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+			}
+
+			test.want.Group = 1
+			test.want.Command = commands.LightOn
+			test.want.Responders = []insteon.Address{0x010101, 0x010102, 0x010103, 0x010104}
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %+v got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSendGroupCommandCachedLinks(t *testing.T) {
+	links := []insteon.LinkRecord{insteon.ControllerLink(1, 0x010101)}
+	im := newGroupIM(links, cleanupAck(0x01, insteon.MsgTypeAllLinkCleanupAck, commands.LightOn, 1), []byte{0x02, 0x58, 0x06})
+	defer im.Close()
+
+	var sent []Command
+	respond := im.respond
+	im.respond = func(pkt []byte) [][]byte {
+		sent = append(sent, Command(pkt[1]))
+		return respond(pkt)
+	}
+	modem := New(im, Timeout(time.Second), PacingScale(0))
+
+	for i := 0; i < 2; i++ {
+		im.mu.Lock()
+		sent = nil
+		im.mu.Unlock()
+
+		if _, err := modem.SendGroupCommand(1, commands.LightOn); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// the second command uses the links read for the first
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if want := []Command{CmdSendAllLink}; !reflect.DeepEqual(want, sent) {
+		t.Errorf("Wanted commands %v got %v", want, sent)
+	}
+}
+
+func TestGroupResultUnanswered(t *testing.T) {
+	result := &GroupResult{
+		Responders: []insteon.Address{0x010101, 0x010102, 0x010103},
+		Acked:      []insteon.Address{0x010101},
+		Failed:     []insteon.Address{0x010103},
+	}
+
+	want := []insteon.Address{0x010102}
+	if got := result.Unanswered(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+}
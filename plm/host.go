@@ -0,0 +1,109 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/devices"
+)
+
+// Reply determines how the IM answers the direct messages it receives.
+// The IM sends the ACK (or NAK) as soon as a message arrives, before the
+// host sees the message, so a reply must be set ahead of time.  The zero
+// value leaves the IM's current reply alone
+type Reply struct {
+	cmd     Command
+	payload []byte
+}
+
+// AckCmd2 is a reply that ACKs direct messages with the given cmd2.
+// This is how a host reports status, the IM answers a status request
+// with cmd2 set to the current level
+func AckCmd2(cmd2 byte) Reply {
+	return Reply{cmd: CmdSetAckMsg, payload: []byte{cmd2}}
+}
+
+// AckCmd is a reply that ACKs direct messages with the given cmd1 and
+// cmd2
+func AckCmd(cmd1, cmd2 byte) Reply {
+	return Reply{cmd: CmdSetNameMsgTwoBytes, payload: []byte{cmd1, cmd2}}
+}
+
+// NakCmd2 is a reply that NAKs direct messages with the given cmd2
+func NakCmd2(cmd2 byte) Reply {
+	return Reply{cmd: CmdSetNakMsgByte, payload: []byte{cmd2}}
+}
+
+func (r Reply) String() string {
+	switch r.cmd {
+	case CmdSetAckMsg:
+		return fmt.Sprintf("ACK cmd2 %02x", r.payload[0])
+	case CmdSetNameMsgTwoBytes:
+		return fmt.Sprintf("ACK %02x.%02x", r.payload[0], r.payload[1])
+	case CmdSetNakMsgByte:
+		return fmt.Sprintf("NAK cmd2 %02x", r.payload[0])
+	}
+	return "No reply"
+}
+
+// SetReply sets how the IM answers the direct messages it receives
+func (plm *PLM) SetReply(reply Reply) error {
+	return plm.SetReplyContext(context.Background(), reply)
+}
+
+// SetReplyContext is the same as SetReply, but gives up once the context
+// is done
+func (plm *PLM) SetReplyContext(ctx context.Context, reply Reply) error {
+	if reply.cmd == 0 {
+		return nil
+	}
+
+	LogDebug.Printf("Setting IM reply to %v", reply)
+	_, err := retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: reply.cmd, Payload: reply.payload})
+	return err
+}
+
+// DirectHandler is called with each direct message sent to the IM.  The
+// returned reply is set in the IM and answers the messages that follow
+type DirectHandler func(msg *insteon.Message) Reply
+
+// HandleDirect calls the handler for every direct message, sent to the
+// IM, that matches the matcher (or every direct message if the matcher
+// is nil).  This allows the host to act as an Insteon device that other
+// controllers can query, for instance by keeping the IM's reply set to
+// the status of a virtual device.  Handlers are called, in order, from
+// their own goroutine and the messages are still delivered to Read,
+// Conns and subscriptions as usual.  Call Unsubscribe on the returned
+// subscription to remove the handler
+func (plm *PLM) HandleDirect(matcher devices.Matcher, handler DirectHandler) *Subscription {
+	addr := plm.Address()
+	direct := devices.Matcher(devices.Matches(func(msg *insteon.Message) bool {
+		return msg.Type() == insteon.MsgTypeDirect && (addr == insteon.Address(0) || msg.Dst == addr)
+	}))
+
+	if matcher != nil {
+		direct = devices.And(direct, matcher)
+	}
+
+	return plm.SubscribeFunc(direct, func(msg *insteon.Message) {
+		reply := handler(msg)
+		if err := plm.SetReply(reply); err != nil {
+			Log.Printf("Failed to set the reply to %v: %v", msg, err)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package plm
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+func TestSetReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Reply
+		want  []byte
+	}{
+		{"ack cmd2", AckCmd2(0x42), []byte{0x02, 0x68, 0x42}},
+		{"ack cmd", AckCmd(0x19, 0xff), []byte{0x02, 0x71, 0x19, 0xff}},
+		{"nak cmd2", NakCmd2(0xfd), []byte{0x02, 0x70, 0xfd}},
+		{"no reply", Reply{}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []byte
+			im := newTestIM(func(pkt []byte) [][]byte {
+				got = append(got, pkt...)
+				return [][]byte{append(append([]byte{}, pkt...), 0x06)}
+			})
+			defer im.Close()
+			modem := New(im, Timeout(time.Second))
+
+			if err := modem.SetReply(test.input); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !bytes.Equal(test.want, got) {
+				t.Errorf("Wanted packet %x got %x", test.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleDirect(t *testing.T) {
+	var mu sync.Mutex
+	var replies [][]byte
+	im := newTestIM(func(pkt []byte) [][]byte {
+		if Command(pkt[1]) == CmdGetInfo {
+			return [][]byte{{0x02, 0x60, 0x0a, 0x0b, 0x0c, 0x03, 0x15, 0x9e, 0x06}}
+		}
+
+		mu.Lock()
+		replies = append(replies, append([]byte{}, pkt...))
+		mu.Unlock()
+		return [][]byte{append(append([]byte{}, pkt...), 0x06)}
+	})
+	defer im.Close()
+	modem := New(im, Timeout(time.Second))
+
+	handled := make(chan *insteon.Message, 3)
+	sub := modem.HandleDirect(nil, func(msg *insteon.Message) Reply {
+		handled <- msg
+		return AckCmd2(byte(msg.Command.Command2()))
+	})
+	defer sub.Unsubscribe()
+
+	// a broadcast, a direct message for another device and a direct
+	// message for the IM
+	go im.tx.Write(bytes.Join([][]byte{
+		{0x02, 0x50, 0x01, 0x02, 0x03, 0x01, 0x20, 0x41, 0x8f, 0x01, 0x00},
+		{0x02, 0x50, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x0f, 0x19, 0x01},
+		{0x02, 0x50, 0x01, 0x02, 0x03, 0x0a, 0x0b, 0x0c, 0x0f, 0x19, 0x02},
+	}, nil))
+
+	select {
+	case msg := <-handled:
+		if msg.Dst != insteon.Address(0x0a0b0c) || msg.Command.Command2() != 0x02 {
+			t.Errorf("Wanted the status request to the IM, got %v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the handler")
+	}
+
+	// wait for the reply to be set
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		mu.Lock()
+		n := len(replies)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := [][]byte{{0x02, 0x68, 0x02}}; len(replies) != 1 || !bytes.Equal(want[0], replies[0]) {
+		t.Errorf("Wanted replies %x got %x", want, replies)
+	}
+
+	if len(handled) != 0 {
+		t.Errorf("Wanted only one message handled got %d more", len(handled))
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+func TestParseHubBuffer(t *testing.T) {
+	ring := strings.Repeat("00", 10)
+	tests := []struct {
+		name      string
+		bs        string
+		last      int
+		wantData  []byte
+		wantIndex int
+		wantErr   error
+	}{
+		{"empty", ring + "00", 0, []byte{}, 0, nil},
+		{"no new data", "0260" + ring[4:] + "04", 4, []byte{}, 4, nil},
+		{"new data", "02600102" + ring[8:] + "08", 0, []byte{0x02, 0x60, 0x01, 0x02}, 8, nil},
+		{"offset", "02600102" + ring[8:] + "08", 4, []byte{0x01, 0x02}, 8, nil},
+		{"wrap", "0306" + ring[4:16] + "0262" + "04", 16, []byte{0x02, 0x62, 0x03, 0x06}, 4, nil},
+		{"odd length", ring + "0", 0, nil, 0, ErrBufferFormat},
+		{"bad index", ring + "zz", 0, nil, 0, ErrBufferFormat},
+		{"index too large", ring + "ff", 0, nil, 0, ErrBufferFormat},
+		{"bad hex", "zz" + ring[2:] + "02", 0, nil, 0, ErrBufferFormat},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, index, err := parseHubBuffer(test.bs, test.last)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if err == nil {
+				if !bytes.Equal(test.wantData, data) {
+					t.Errorf("Wanted data %x got %x", test.wantData, data)
+				}
+
+				if test.wantIndex != index {
+					t.Errorf("Wanted index %d got %d", test.wantIndex, index)
+				}
+			}
+		})
+	}
+}
+
+// testHub emulates the web interface of an Insteon Hub. Commands
+// are answered with the responses from the respond function, which
+// are written into the ring buffer
+type testHub struct {
+	mu      sync.Mutex
+	ring    []byte
+	index   int
+	respond func(pkt []byte) [][]byte
+}
+
+func newTestHub(respond func(pkt []byte) [][]byte) *httptest.Server {
+	hub := &testHub{ring: bytes.Repeat([]byte("0"), 200), respond: respond}
+	return httptest.NewServer(hub)
+}
+
+func (th *testHub) write(data []byte) {
+	for _, c := range strings.ToUpper(hex.EncodeToString(data)) {
+		th.ring[th.index] = byte(c)
+		th.index = (th.index + 1) % len(th.ring)
+	}
+}
+
+func (th *testHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	switch {
+	case r.URL.Path == "/buffstatus.xml":
+		fmt.Fprintf(w, "<response><BS>%s%02X</BS></response>", th.ring, th.index)
+	case r.URL.Path == "/1" && r.URL.RawQuery == "XB=M=1":
+		th.ring = bytes.Repeat([]byte("0"), 200)
+		th.index = 0
+	case r.URL.Path == "/3" && strings.HasSuffix(r.URL.RawQuery, "=I=3"):
+		pkt, err := hex.DecodeString(strings.TrimSuffix(r.URL.RawQuery, "=I=3"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, response := range th.respond(pkt) {
+			th.write(response)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestHubPortAuth(t *testing.T) {
+	server := newTestHub(nil)
+	defer server.Close()
+
+	_, err := DialHub(server.URL)
+	if err == nil {
+		t.Errorf("Expected an error without credentials")
+	}
+
+	port, err := DialHub(server.URL, BasicAuth("user", "pass"))
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else {
+		port.Close()
+	}
+}
+
+func TestHubPortPLM(t *testing.T) {
+	server := newTestHub(func(pkt []byte) [][]byte {
+		if pkt[1] == byte(CmdGetInfo) {
+			return [][]byte{{0x02, 0x60, 0x01, 0x02, 0x03, 0x03, 0x15, 0x9e, 0x06}}
+		}
+		return [][]byte{pkt}
+	})
+	defer server.Close()
+
+	port, err := DialHub(strings.Replace(server.URL, "http://", "http://user:pass@", 1), PollInterval(time.Millisecond), FastPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer port.Close()
+
+	// fill most of the ring so the response to GetInfo wraps around
+	port.Write(bytes.Repeat([]byte{0x00}, 96))
+	buf := make([]byte, 96)
+	if _, err := io.ReadFull(port, buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	modem := New(port, Timeout(time.Second))
+	info, err := modem.Info()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := insteon.Address(0x010203)
+	if info.Address != want {
+		t.Errorf("Wanted address %v got %v", want, info.Address)
+	}
+}
+
+func TestHubPortReplay(t *testing.T) {
+	ring := strings.Repeat("0", 200)
+	recorded := []string{
+		ring + "00",
+		"0262010203" + ring[10:] + "0A",
+		"02620102030F11FF06" + ring[18:] + "12",
+		"02620102030F11FF0602500102030405062B11FF" + ring[40:] + "28",
+	}
+	want := []byte{0x02, 0x62, 0x01, 0x02, 0x03, 0x0f, 0x11, 0xff, 0x06, 0x02, 0x50, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x2b, 0x11, 0xff}
+
+	mu := sync.Mutex{}
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/buffstatus.xml" {
+			mu.Lock()
+			i := polls
+			if polls < len(recorded)-1 {
+				polls++
+			}
+			mu.Unlock()
+			fmt.Fprintf(w, "<response><BS>%s</BS></response>", recorded[i])
+		}
+	}))
+	defer server.Close()
+
+	port, err := DialHub(server.URL, PollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer port.Close()
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(port, got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(want, got) {
+		t.Errorf("Wanted %x got %x", want, got)
+	}
+}
+
+// syncBuffer is a bytes.Buffer that is safe to use from multiple
+// goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.String()
+}
+
+func TestHubPortBackoff(t *testing.T) {
+	mu := sync.Mutex{}
+	failing := false
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/buffstatus.xml" {
+			return
+		}
+
+		if failing {
+			polls++
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "<response><BS>%s</BS></response>", "0262"+strings.Repeat("0", 196)+"04")
+	}))
+	defer server.Close()
+
+	logs := &syncBuffer{}
+	oldLog := Log
+	Log = log.New(logs, "", 0)
+	defer func() { Log = oldLog }()
+
+	port, err := DialHub(server.URL, PollInterval(time.Millisecond), MaxPollInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer port.Close()
+
+	mu.Lock()
+	failing = true
+	mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 2)
+		_, err := io.ReadFull(port, buf)
+		done <- err
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	// without backing off there would be close to 200 polls
+	if polls > 30 {
+		t.Errorf("Wanted polling to back off, got %d polls", polls)
+	}
+	failing = false
+	mu.Unlock()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{"Failed to poll hub", "Polling hub"}
+	lines := []string{}
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, "hub") {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) != len(want) {
+		t.Fatalf("Wanted %d log lines got %q", len(want), lines)
+	}
+
+	for i, line := range lines {
+		if !strings.HasPrefix(line, want[i]) {
+			t.Errorf("Wanted log line %d to start with %q got %q", i, want[i], line)
+		}
+	}
+}
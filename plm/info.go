@@ -25,9 +25,9 @@ type Version byte
 func (v Version) String() string { return fmt.Sprintf("%d", byte(v)) }
 
 type Info struct {
-	Address  insteon.Address
-	DevCat   insteon.DevCat
-	Firmware Version
+	Address  insteon.Address `json:"address"`
+	DevCat   insteon.DevCat  `json:"devCat"`
+	Firmware Version         `json:"firmware"`
 }
 
 func (info *Info) String() string {
@@ -15,10 +15,15 @@
 package plm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/abates/insteon"
+	"github.com/abates/insteon/devices"
 )
 
 type recordRequestCommand byte
@@ -80,34 +85,57 @@ func (alr *allLinkReq) String() string {
 	return fmt.Sprintf("%02x %d", alr.Mode, alr.Group)
 }
 
+// DefaultLinkCacheAge is how long the links read from the IM are cached
+// when no LinkCacheAge option is given
+const DefaultLinkCacheAge = time.Minute
+
 type linkdb struct {
-	age     time.Time
-	links   []insteon.LinkRecord
-	plm     packetWriter
-	retries int
-	timeout time.Duration
+	// mu serializes access to the IM link database since walking
+	// the database requires a sequence of commands
+	mu     sync.Mutex
+	age    time.Time
+	links  []insteon.LinkRecord
+	plm    packetWriter
+	retry  devices.RetryPolicy
+	maxAge time.Duration
+
+	// stale is set when the IM's database may have been changed by
+	// someone else, such as a device linked with the SET button.  It
+	// is only accessed atomically since it is set without holding mu
+	stale int32
 }
 
+// old indicates if the cached links need to be read from the IM again
 func (ldb *linkdb) old() bool {
-	return ldb.age.Add(ldb.timeout).Before(time.Now())
+	return atomic.LoadInt32(&ldb.stale) != 0 || ldb.age.Add(ldb.maxAge).Before(time.Now())
+}
+
+// invalidate causes the links to be read from the IM the next time
+// they are needed
+func (ldb *linkdb) invalidate() {
+	atomic.StoreInt32(&ldb.stale, 1)
 }
 
-func (ldb *linkdb) refresh() error {
+func (ldb *linkdb) refresh(ctx context.Context) error {
 	if !ldb.old() {
 		return nil
 	}
+
+	// anything that invalidates the cache while the database is being
+	// read causes it to be read again next time
+	atomic.StoreInt32(&ldb.stale, 0)
 	links := make([]insteon.LinkRecord, 0)
-	_, err := retry(ldb.plm, ldb.retries, true).WritePacket(&Packet{Command: CmdGetFirstAllLink})
+	_, err := retry(ldb.plm, ldb.retry, true).WritePacketContext(ctx, &Packet{Command: CmdGetFirstAllLink})
 	for err == nil {
 		var pkt *Packet
-		pkt, err = ldb.plm.ReadPacket()
+		pkt, err = ldb.plm.ReadPacketContext(ctx)
 		if err == nil {
 			if pkt.Command == CmdAllLinkRecordResp {
 				link := insteon.LinkRecord{}
 				err = link.UnmarshalBinary(pkt.Payload)
 				if err == nil {
 					links = append(links, link)
-					_, err = retry(ldb.plm, ldb.retries, false).WritePacket(&Packet{Command: CmdGetNextAllLink})
+					_, err = retry(ldb.plm, ldb.retry, false).WritePacketContext(ctx, &Packet{Command: CmdGetNextAllLink})
 				}
 			}
 		}
@@ -116,27 +144,38 @@ func (ldb *linkdb) refresh() error {
 	if err == ErrNak {
 		err = nil
 		ldb.links = links
+		ldb.age = time.Now()
+	} else {
+		ldb.invalidate()
 	}
 	return err
 }
 
 func (ldb *linkdb) Links() ([]insteon.LinkRecord, error) {
-	err := ldb.refresh()
+	return ldb.LinksContext(context.Background())
+}
+
+// LinksContext is the same as Links, but walking the IM link database
+// is aborted if the context is done first
+func (ldb *linkdb) LinksContext(ctx context.Context) ([]insteon.LinkRecord, error) {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+	err := ldb.refresh(ctx)
 	links := make([]insteon.LinkRecord, len(ldb.links))
 	copy(links, ldb.links)
 	return links, err
 }
 
-func (ldb *linkdb) deleteLink(link *insteon.LinkRecord) (*Packet, error) {
+func (ldb *linkdb) deleteLink(ctx context.Context, link *insteon.LinkRecord) (*Packet, error) {
 	mrr := &manageRecordRequest{
 		cmd:  LinkCmdDeleteFirst,
 		link: link,
 	}
 	payload, _ := mrr.MarshalBinary()
-	return retry(ldb.plm, 3, true).WritePacket(&Packet{Command: CmdManageAllLinkRecord, Payload: payload})
+	return retry(ldb.plm, ldb.retry, true).WritePacketContext(ctx, &Packet{Command: CmdManageAllLinkRecord, Payload: payload})
 }
 
-func (ldb *linkdb) writeLink(link *insteon.LinkRecord) (*Packet, error) {
+func (ldb *linkdb) writeLink(ctx context.Context, link *insteon.LinkRecord) (*Packet, error) {
 	mrr := &manageRecordRequest{
 		cmd:  LinkCmdModFirstResp,
 		link: link,
@@ -145,55 +184,199 @@ func (ldb *linkdb) writeLink(link *insteon.LinkRecord) (*Packet, error) {
 		mrr.cmd = LinkCmdModFirstCtrl
 	}
 	payload, _ := mrr.MarshalBinary()
-	return retry(ldb.plm, 3, true).WritePacket(&Packet{Command: CmdManageAllLinkRecord, Payload: payload})
+	return retry(ldb.plm, ldb.retry, true).WritePacketContext(ctx, &Packet{Command: CmdManageAllLinkRecord, Payload: payload})
 }
 
-func (ldb *linkdb) WriteLinks(newLinks ...insteon.LinkRecord) (err error) {
-	if err == nil {
-		// blow away the database and pray something doesn't go wrong, it's really
-		// too bad that the PLM doesn't support some form of transactions or modifying
-		// ALDB records by address
-		for i := 0; i < len(ldb.links) && err == nil; i++ {
-			_, err = ldb.deleteLink(&ldb.links[i])
+// addLink adds the link to the IM, or updates the data of the matching
+// record if there is one
+func (ldb *linkdb) addLink(ctx context.Context, link insteon.LinkRecord) error {
+	ack, err := ldb.writeLink(ctx, &link)
+	if err == ErrWrongPayload {
+		// For some reason (at least with my PLM) it is common for
+		// a link record to be shifted over a few bytes after sending
+		// it to the PLM.  This can be detected because the ACK payload
+		// won't match the transmitted packet.  We try to fix this by
+		// deleting the corrupted record and re-adding it
+		delLink := &insteon.LinkRecord{}
+		delLink.UnmarshalBinary(ack.Payload)
+		_, err = ldb.deleteLink(ctx, delLink)
+		if err == nil {
+			// try again
+			_, err = ldb.writeLink(ctx, &link)
 		}
 	}
+	return err
+}
 
-	if err == nil {
-		ldb.links = nil
+// matching returns the records with the group and address, in the order
+// the IM finds them
+func (ldb *linkdb) matching(ctx context.Context, group insteon.Group, address insteon.Address) (links []insteon.LinkRecord, err error) {
+	for cmd := LinkCmdFindFirst; ; cmd = LinkCmdFindNext {
+		link, err := ldb.find(ctx, cmd, group, address)
+		if err == ErrLinkNotFound {
+			return links, nil
+		} else if err != nil {
+			return links, err
+		}
+		links = append(links, *link)
+	}
+}
 
-		for _, link := range newLinks {
-			var ack *Packet
-			ack, err = ldb.writeLink(&link)
-			//_, err = ldb.plm.Write(&Packet{Command: CmdManageAllLinkRecord, Payload: payload})
-			if err == nil {
-				ldb.links = append(ldb.links, link)
-			} else if err == ErrWrongPayload {
-				// For some reason (at least with my PLM) it is common for
-				// a link record to be shifted over a few bytes after sending
-				// it to the PLM.  This can be detected because the ACK payload
-				// won't match the transmitted packet.  We try to fix this by
-				// deleting the corrupted record and re-adding it
-				delLink := &insteon.LinkRecord{}
-				delLink.UnmarshalBinary(ack.Payload)
-				_, err = ldb.deleteLink(delLink)
-				if err == nil {
-					// try again
-					_, err = ldb.writeLink(&link)
-					if err == nil {
-						ldb.links = append(ldb.links, link)
-					}
-				}
+// removeLink deletes the records with the same type, group and address
+// as the link.  The IM's delete command removes the first record with the
+// group and address, whether it is a controller or a responder record, so
+// the records are read back after each delete to find out which one was
+// removed.  Any other record that was removed along the way is added back
+func (ldb *linkdb) removeLink(ctx context.Context, link *insteon.LinkRecord) error {
+	found, err := ldb.matching(ctx, link.Group, link.Address)
+	removed := []insteon.LinkRecord{}
+	for err == nil && hasLink(found, link) {
+		var remaining []insteon.LinkRecord
+		if _, err = ldb.deleteLink(ctx, link); err == nil {
+			remaining, err = ldb.matching(ctx, link.Group, link.Address)
+		}
+
+		if err == nil && len(remaining) >= len(found) {
+			err = fmt.Errorf("%w: %v was not deleted", ErrVerifyFailed, link)
+		} else if err == nil {
+			// the rest of the records are found in the same order, so
+			// the first one that differs is the one that was deleted
+			i := 0
+			for i < len(remaining) && remaining[i] == found[i] {
+				i++
 			}
 
-			if err != nil {
-				break
+			if !found[i].Equal(link) {
+				removed = append(removed, found[i])
 			}
+			found = remaining
 		}
 	}
 
+	for _, other := range removed {
+		if err == nil {
+			LogDebug.Printf("Restoring link %v", other)
+			err = ldb.addLink(ctx, other)
+		}
+	}
+	return err
+}
+
+func hasLink(links []insteon.LinkRecord, link *insteon.LinkRecord) bool {
+	for i := range links {
+		if links[i].Equal(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// index returns the index of the first cached record with the same
+// type, group and address as link, or -1 if there isn't one
+func (ldb *linkdb) index(link *insteon.LinkRecord) int {
+	for i := range ldb.links {
+		if ldb.links[i].Equal(link) {
+			return i
+		}
+	}
+	return -1
+}
+
+// WriteLinks makes the IM's All-Link database match the given links.  See
+// RewriteLinks for details
+func (ldb *linkdb) WriteLinks(newLinks ...insteon.LinkRecord) error {
+	_, err := ldb.RewriteLinks(context.Background(), newLinks...)
 	return err
 }
 
+// readLink sends the command and then reads the link record that the IM
+// sends once it has acknowledged the command.  The IM NAKs the command
+// when there is no matching record
+func (ldb *linkdb) readLink(ctx context.Context, pkt *Packet) (*insteon.LinkRecord, error) {
+	_, err := retry(ldb.plm, ldb.retry, false).WritePacketContext(ctx, pkt)
+	if errors.Is(err, ErrNak) {
+		return nil, ErrLinkNotFound
+	}
+
+	for err == nil {
+		var resp *Packet
+		resp, err = ldb.plm.ReadPacketContext(ctx)
+		if err == nil && resp.Command == CmdAllLinkRecordResp {
+			link := &insteon.LinkRecord{}
+			if err = link.UnmarshalBinary(resp.Payload); err == nil {
+				return link, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// LinkForSender returns the IM's link record for the device that sent the
+// last message the IM received.  ErrLinkNotFound is returned if there is
+// no such record
+func (ldb *linkdb) LinkForSender() (*insteon.LinkRecord, error) {
+	return ldb.LinkForSenderContext(context.Background())
+}
+
+// LinkForSenderContext is the same as LinkForSender, but gives up once
+// the context is done
+func (ldb *linkdb) LinkForSenderContext(ctx context.Context) (*insteon.LinkRecord, error) {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+	return ldb.readLink(ctx, &Packet{Command: CmdGetAllLinkForSender})
+}
+
+// FindLink asks the IM for its first link record with the given group and
+// address.  This is much faster than reading the entire database with
+// Links.  ErrLinkNotFound is returned if there is no such record
+func (ldb *linkdb) FindLink(group insteon.Group, address insteon.Address) (*insteon.LinkRecord, error) {
+	return ldb.FindLinkContext(context.Background(), group, address)
+}
+
+// FindLinkContext is the same as FindLink, but gives up once the context
+// is done
+func (ldb *linkdb) FindLinkContext(ctx context.Context, group insteon.Group, address insteon.Address) (*insteon.LinkRecord, error) {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+	return ldb.find(ctx, LinkCmdFindFirst, group, address)
+}
+
+// FindLinks returns every link record in the IM with the given group and
+// address, usually a controller and a responder record.  An empty list is
+// returned if there are none
+func (ldb *linkdb) FindLinks(group insteon.Group, address insteon.Address) ([]insteon.LinkRecord, error) {
+	return ldb.FindLinksContext(context.Background(), group, address)
+}
+
+// FindLinksContext is the same as FindLinks, but gives up once the
+// context is done
+func (ldb *linkdb) FindLinksContext(ctx context.Context, group insteon.Group, address insteon.Address) (links []insteon.LinkRecord, err error) {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+
+	cmd := LinkCmdFindFirst
+	for {
+		var link *insteon.LinkRecord
+		link, err = ldb.find(ctx, cmd, group, address)
+		if err != nil {
+			break
+		}
+		links = append(links, *link)
+		cmd = LinkCmdFindNext
+	}
+
+	if err == ErrLinkNotFound {
+		err = nil
+	}
+	return links, err
+}
+
+func (ldb *linkdb) find(ctx context.Context, cmd recordRequestCommand, group insteon.Group, address insteon.Address) (*insteon.LinkRecord, error) {
+	mrr := &manageRecordRequest{cmd: cmd, link: &insteon.LinkRecord{Group: group, Address: address}}
+	payload, _ := mrr.MarshalBinary()
+	return ldb.readLink(ctx, &Packet{Command: CmdManageAllLinkRecord, Payload: payload})
+}
+
 func (ldb *linkdb) IterateDevices(cb func(insteon.Address)) error {
 	read := make(map[insteon.Address]bool)
 	links, err := ldb.Links()
@@ -209,25 +392,96 @@ func (ldb *linkdb) IterateDevices(cb func(insteon.Address)) error {
 	return err
 }
 
-func (ldb *linkdb) UpdateLinks(...insteon.LinkRecord) error {
-	return insteon.ErrNotImplemented
+// UpdateLinks makes only the changes needed for the IM's All-Link
+// database to include the given links.  Links that are marked available
+// are deleted from the database, links that are already in the database
+// with the same data are skipped, links whose data differ are updated in
+// place and the rest are added
+func (ldb *linkdb) UpdateLinks(links ...insteon.LinkRecord) (err error) {
+	return ldb.UpdateLinksContext(context.Background(), links...)
+}
+
+// UpdateLinksContext is the same as UpdateLinks, but stops making changes
+// once the context is done
+func (ldb *linkdb) UpdateLinksContext(ctx context.Context, links ...insteon.LinkRecord) (err error) {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+
+	// the cached links are kept up to date with each change, but
+	// a failed change may have been partially made
+	defer func() {
+		if err != nil {
+			ldb.invalidate()
+		}
+	}()
+
+	err = ldb.refresh(ctx)
+	for _, link := range links {
+		if err != nil {
+			break
+		}
+
+		if link.Flags.Available() {
+			if ldb.index(&link) < 0 {
+				continue
+			}
+
+			LogDebug.Printf("Deleting link %v", link)
+			if err = ldb.removeLink(ctx, &link); err == nil {
+				for i := ldb.index(&link); i >= 0; i = ldb.index(&link) {
+					ldb.links = append(ldb.links[:i], ldb.links[i+1:]...)
+				}
+			}
+		} else if i := ldb.index(&link); i >= 0 {
+			if ldb.links[i].Data != link.Data {
+				LogDebug.Printf("Updating link %v", link)
+				if err = ldb.addLink(ctx, link); err == nil {
+					ldb.links[i].Data = link.Data
+				}
+			}
+		} else {
+			LogDebug.Printf("Adding link %v", link)
+			if err = ldb.addLink(ctx, link); err == nil {
+				ldb.links = append(ldb.links, link)
+			}
+		}
+	}
+	return err
 }
 
 func (ldb *linkdb) EnterLinkingMode(group insteon.Group) error {
+	return ldb.EnterLinkingModeContext(context.Background(), group)
+}
+
+// EnterLinkingModeContext is the same as EnterLinkingMode, but returns
+// ctx.Err() if the context is done before the IM acknowledges the command
+func (ldb *linkdb) EnterLinkingModeContext(ctx context.Context, group insteon.Group) error {
 	lr := &allLinkReq{Mode: linkingMode(0x03), Group: group}
 	payload, _ := lr.MarshalBinary()
-	_, err := ldb.plm.WritePacket(&Packet{Command: CmdStartAllLink, Payload: payload})
+	_, err := ldb.plm.WritePacketContext(ctx, &Packet{Command: CmdStartAllLink, Payload: payload})
 	return err
 }
 
 func (ldb *linkdb) ExitLinkingMode() error {
-	_, err := ldb.plm.WritePacket(&Packet{Command: CmdCancelAllLink})
+	return ldb.ExitLinkingModeContext(context.Background())
+}
+
+// ExitLinkingModeContext is the same as ExitLinkingMode, but returns
+// ctx.Err() if the context is done before the IM acknowledges the command
+func (ldb *linkdb) ExitLinkingModeContext(ctx context.Context) error {
+	_, err := ldb.plm.WritePacketContext(ctx, &Packet{Command: CmdCancelAllLink})
 	return err
 }
 
 func (ldb *linkdb) EnterUnlinkingMode(group insteon.Group) error {
+	return ldb.EnterUnlinkingModeContext(context.Background(), group)
+}
+
+// EnterUnlinkingModeContext is the same as EnterUnlinkingMode, but returns
+// ctx.Err() if the context is done before the IM acknowledges the command
+func (ldb *linkdb) EnterUnlinkingModeContext(ctx context.Context, group insteon.Group) error {
 	lr := &allLinkReq{Mode: linkingMode(0xff), Group: group}
 	payload, _ := lr.MarshalBinary()
-	_, err := ldb.plm.WritePacket(&Packet{Command: CmdStartAllLink, Payload: payload})
+	_, err := ldb.plm.WritePacketContext(ctx, &Packet{Command: CmdStartAllLink, Payload: payload})
 	return err
 }
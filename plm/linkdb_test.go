@@ -2,6 +2,7 @@ package plm
 
 import (
 	"bytes"
+	"context"
 	"encoding"
 	"errors"
 	"reflect"
@@ -51,7 +52,7 @@ func TestMarshalUnmarshalBinary(t *testing.T) {
 
 func TestLinkDBOld(t *testing.T) {
 	ldb := linkdb{
-		timeout: time.Hour,
+		maxAge: time.Hour,
 	}
 	if !ldb.old() {
 		t.Errorf("Expected database to be marked old")
@@ -60,6 +61,11 @@ func TestLinkDBOld(t *testing.T) {
 	if ldb.old() {
 		t.Errorf("Expected database to not be marked old")
 	}
+
+	ldb.invalidate()
+	if !ldb.old() {
+		t.Errorf("Expected database to be marked old once invalidated")
+	}
 }
 
 type testModem struct {
@@ -70,7 +76,7 @@ type testModem struct {
 	ack   []*Packet
 }
 
-func (tlplm *testModem) ReadPacket() (p *Packet, err error) {
+func (tlplm *testModem) ReadPacketContext(context.Context) (p *Packet, err error) {
 	err = tlplm.rxErr
 	if len(tlplm.rx) > 0 {
 		p = tlplm.rx[0]
@@ -81,7 +87,7 @@ func (tlplm *testModem) ReadPacket() (p *Packet, err error) {
 	return
 }
 
-func (tlplm *testModem) WritePacket(packet *Packet) (ack *Packet, err error) {
+func (tlplm *testModem) WritePacketContext(ctx context.Context, packet *Packet) (ack *Packet, err error) {
 	tlplm.tx = append(tlplm.tx, packet)
 	err = tlplm.txErr
 	if len(tlplm.ack) > 0 {
@@ -106,7 +112,7 @@ func TestLinkDBRefresh(t *testing.T) {
 	tests := []struct {
 		name      string
 		age       time.Time
-		timeout   time.Duration
+		maxAge    time.Duration
 		rx        []*Packet
 		rxErr     error
 		ack       []*Packet
@@ -136,7 +142,7 @@ func TestLinkDBRefresh(t *testing.T) {
 		},
 		{
 			name:    "Read Timeout",
-			timeout: -time.Hour,
+			maxAge:  -time.Hour,
 			ack:     []*Packet{{Command: CmdGetFirstAllLink}},
 			rxErr:   ErrReadTimeout,
 			wantErr: ErrReadTimeout,
@@ -146,7 +152,7 @@ func TestLinkDBRefresh(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			plm := &testModem{rx: test.rx, rxErr: test.rxErr, ack: test.ack, txErr: test.txErr}
-			ldb := linkdb{plm: plm, age: test.age, timeout: test.timeout}
+			ldb := linkdb{plm: plm, age: test.age, maxAge: test.maxAge}
 			gotLinks, gotErr := ldb.Links()
 			if test.wantErr == gotErr {
 				if gotErr == nil {
@@ -197,3 +203,62 @@ func TestLinkdbCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestLinkdbFind(t *testing.T) {
+	link := insteon.ControllerLink(1, insteon.Address(0x010203))
+	resp := &Packet{Command: CmdAllLinkRecordResp}
+	resp.Payload, _ = link.MarshalBinary()
+
+	tests := []struct {
+		name    string
+		test    func(ldb *linkdb) (*insteon.LinkRecord, error)
+		ack     []*Packet
+		rx      []*Packet
+		wantTx  []*Packet
+		want    *insteon.LinkRecord
+		wantErr error
+	}{
+		{
+			name:   "find",
+			test:   func(ldb *linkdb) (*insteon.LinkRecord, error) { return ldb.FindLink(1, insteon.Address(0x010203)) },
+			ack:    []*Packet{{Ack: 0x06}},
+			rx:     []*Packet{resp},
+			wantTx: []*Packet{{Command: CmdManageAllLinkRecord, Payload: []byte{byte(LinkCmdFindFirst), 0x00, 0x01, 0x01, 0x02, 0x03, 0x00, 0x00, 0x00}}},
+			want:   &link,
+		},
+		{
+			name:    "find not found",
+			test:    func(ldb *linkdb) (*insteon.LinkRecord, error) { return ldb.FindLink(1, insteon.Address(0x010203)) },
+			ack:     []*Packet{{Ack: 0x15}},
+			wantTx:  []*Packet{{Command: CmdManageAllLinkRecord, Payload: []byte{byte(LinkCmdFindFirst), 0x00, 0x01, 0x01, 0x02, 0x03, 0x00, 0x00, 0x00}}},
+			wantErr: ErrLinkNotFound,
+		},
+		{
+			name:   "sender",
+			test:   func(ldb *linkdb) (*insteon.LinkRecord, error) { return ldb.LinkForSender() },
+			ack:    []*Packet{{Ack: 0x06}},
+			rx:     []*Packet{resp},
+			wantTx: []*Packet{{Command: CmdGetAllLinkForSender}},
+			want:   &link,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plm := &testModem{rx: test.rx, ack: test.ack}
+			ldb := &linkdb{plm: plm}
+			got, err := test.test(ldb)
+			if err != test.wantErr {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(test.wantTx, plm.tx) {
+				t.Errorf("Wanted packets %v got %v", test.wantTx, plm.tx)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted link %v got %v", test.want, got)
+			}
+		})
+	}
+}
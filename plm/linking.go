@@ -0,0 +1,213 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+// LinkTimeout is how long Link and LinkDevices wait for each linking
+// session to complete.  The IM leaves linking mode on its own after four
+// minutes
+var LinkTimeout = 4 * time.Minute
+
+// LinkCode is the part the IM plays in a linking session
+type LinkCode byte
+
+const (
+	// LinkResponder makes the IM the responder
+	LinkResponder LinkCode = 0x00
+
+	// LinkController makes the IM the controller
+	LinkController LinkCode = 0x01
+
+	// LinkEither makes the IM the responder if the other device entered
+	// linking mode first, otherwise the IM is the controller.  It is
+	// only used to start linking, the All-Link complete report gives the
+	// part the IM actually played
+	LinkEither LinkCode = 0x03
+
+	// LinkDelete removes the link instead of creating it
+	LinkDelete LinkCode = 0xff
+)
+
+func (lc LinkCode) String() string {
+	switch lc {
+	case LinkResponder:
+		return "Responder"
+	case LinkController:
+		return "Controller"
+	case LinkEither:
+		return "Either"
+	case LinkDelete:
+		return "Delete"
+	}
+	return fmt.Sprintf("LinkCode(%d)", byte(lc))
+}
+
+// LinkResult is the All-Link complete report the IM sends when a linking
+// session is finished
+type LinkResult struct {
+	Code     LinkCode
+	Group    insteon.Group
+	Address  insteon.Address
+	DevCat   insteon.DevCat
+	Firmware insteon.FirmwareVersion
+}
+
+func (lr *LinkResult) String() string {
+	return fmt.Sprintf("%v %v group %v category %v firmware %d", lr.Code, lr.Address, lr.Group, lr.DevCat, lr.Firmware)
+}
+
+func (lr *LinkResult) MarshalBinary() ([]byte, error) {
+	buf := []byte{byte(lr.Code), byte(lr.Group)}
+	buf = append(buf, lr.Address.Bytes()...)
+	return append(buf, lr.DevCat[0], lr.DevCat[1], byte(lr.Firmware)), nil
+}
+
+func (lr *LinkResult) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 8 {
+		return fmt.Errorf("%w wanted 8 got %d", insteon.ErrBufferTooShort, len(buf))
+	}
+
+	lr.Code = LinkCode(buf[0])
+	lr.Group = insteon.Group(buf[1])
+	lr.Address.Put(buf[2:5])
+	copy(lr.DevCat[:], buf[5:7])
+	lr.Firmware = insteon.FirmwareVersion(buf[7])
+	return nil
+}
+
+// deliverLink hands an All-Link complete report to the goroutine waiting
+// in LinkContext.  False is returned if nobody is waiting
+func (plm *PLM) deliverLink(pkt *Packet) bool {
+	plm.mu.Lock()
+	defer plm.mu.Unlock()
+	if plm.linkCh == nil {
+		return false
+	}
+
+	result := &LinkResult{}
+	if err := result.UnmarshalBinary(pkt.Payload); err != nil {
+		Log.Printf("Failed to unmarshal All-Link complete: %v", err)
+		return false
+	}
+
+	select {
+	case plm.linkCh <- result:
+	default:
+		Log.Printf("All-Link complete dropped, a result is already waiting")
+	}
+	return true
+}
+
+// Link puts the IM into linking mode and waits, up to LinkTimeout, for a
+// device to link with it.  The IM becomes the controller, responder or
+// either depending on the code, or the link is deleted if the code is
+// LinkDelete
+func (plm *PLM) Link(code LinkCode, group insteon.Group) (*LinkResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), LinkTimeout)
+	defer cancel()
+	result, err := plm.LinkContext(ctx, code, group)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("All-Link complete %w", ErrReadTimeout)
+	}
+	return result, err
+}
+
+// LinkContext is the same as Link, except that it waits until the context
+// is done rather than LinkTimeout.  If the context is done before a device
+// links, the IM is taken out of linking mode and ctx.Err() is returned
+func (plm *PLM) LinkContext(ctx context.Context, code LinkCode, group insteon.Group) (*LinkResult, error) {
+	plm.linkMu.Lock()
+	defer plm.linkMu.Unlock()
+
+	ch := make(chan *LinkResult, 1)
+	plm.mu.Lock()
+	plm.linkCh = ch
+	plm.mu.Unlock()
+
+	defer func() {
+		plm.mu.Lock()
+		plm.linkCh = nil
+		plm.mu.Unlock()
+	}()
+
+	lr := &allLinkReq{Mode: linkingMode(code), Group: group}
+	payload, _ := lr.MarshalBinary()
+	_, err := retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: CmdStartAllLink, Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case result := <-ch:
+		return result, nil
+	case <-plm.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+	}
+
+	// a device may have linked just as the context finished
+	cancelErr := plm.ExitLinkingMode()
+	select {
+	case result := <-ch:
+		return result, nil
+	default:
+	}
+
+	if cancelErr != nil {
+		LogDebug.Printf("Failed to cancel linking mode: %v", cancelErr)
+	}
+	return nil, ctx.Err()
+}
+
+// LinkDevices links n devices, one after another, with the IM.  This
+// allows a batch of devices to be linked by pressing each device's set
+// button.  Each device has up to LinkTimeout to link.  The callback, if
+// not nil, is called as each device links.  The results so far are
+// returned along with any error
+func (plm *PLM) LinkDevices(code LinkCode, group insteon.Group, n int, cb func(*LinkResult)) ([]*LinkResult, error) {
+	return plm.LinkDevicesContext(context.Background(), code, group, n, cb)
+}
+
+// LinkDevicesContext is the same as LinkDevices, but stops waiting for
+// devices once the context is done
+func (plm *PLM) LinkDevicesContext(ctx context.Context, code LinkCode, group insteon.Group, n int, cb func(*LinkResult)) (results []*LinkResult, err error) {
+	for len(results) < n {
+		var result *LinkResult
+		timeout, cancel := context.WithTimeout(ctx, LinkTimeout)
+		result, err = plm.LinkContext(timeout, code, group)
+		cancel()
+
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				err = fmt.Errorf("All-Link complete %w", ErrReadTimeout)
+			}
+			break
+		}
+
+		results = append(results, result)
+		if cb != nil {
+			cb(result)
+		}
+	}
+	return results, err
+}
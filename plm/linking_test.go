@@ -0,0 +1,161 @@
+package plm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+func TestLinkResultUnmarshalBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    LinkResult
+		wantErr error
+	}{
+		{"controller", []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, LinkResult{LinkController, 2, insteon.Address(0x030405), insteon.DevCat{6, 7}, 8}, nil},
+		{"delete", []byte{0xff, 0x01, 0x0a, 0x0b, 0x0c, 0x01, 0x20, 0x41}, LinkResult{LinkDelete, 1, insteon.Address(0x0a0b0c), insteon.DevCat{1, 0x20}, 0x41}, nil},
+		{"short buffer", []byte{0x01}, LinkResult{}, insteon.ErrBufferTooShort},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := LinkResult{}
+			err := got.UnmarshalBinary(test.input)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if err == nil {
+				if got != test.want {
+					t.Errorf("Wanted %v got %v", test.want, got)
+				}
+
+				buf, _ := got.MarshalBinary()
+				if !reflect.DeepEqual(test.input, buf) {
+					t.Errorf("Wanted bytes %x got %x", test.input, buf)
+				}
+			}
+		})
+	}
+}
+
+// newLinkingIM returns a test IM that acknowledges every command and
+// reports an All-Link complete for each address in linked, one per
+// start All-Link command
+func newLinkingIM(linked ...byte) (im *testIM, sent func() []Command) {
+	var mu sync.Mutex
+	var cmds []Command
+	im = newTestIM(func(pkt []byte) [][]byte {
+		mu.Lock()
+		defer mu.Unlock()
+		cmds = append(cmds, Command(pkt[1]))
+		responses := [][]byte{append(append([]byte{}, pkt...), 0x06)}
+		if Command(pkt[1]) == CmdStartAllLink && len(linked) > 0 {
+			code := pkt[2]
+			if code == byte(LinkEither) {
+				code = byte(LinkController)
+			}
+			responses = append(responses, []byte{0x02, 0x53, code, pkt[3], 0x01, 0x02, linked[0], 0x02, 0x1a, 0x41})
+			linked = linked[1:]
+		}
+		return responses
+	})
+
+	return im, func() []Command {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Command{}, cmds...)
+	}
+}
+
+func TestLink(t *testing.T) {
+	im, sent := newLinkingIM(0x03)
+	defer im.Close()
+	modem := New(im, Timeout(time.Second), PacingScale(0))
+
+	got, err := modem.Link(LinkEither, 5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := &LinkResult{LinkController, 5, insteon.Address(0x010203), insteon.DevCat{0x02, 0x1a}, 0x41}
+	if *got != *want {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+
+	if want := []Command{CmdStartAllLink}; !reflect.DeepEqual(want, sent()) {
+		t.Errorf("Wanted commands %v got %v", want, sent())
+	}
+}
+
+func TestLinkCancelled(t *testing.T) {
+	im, sent := newLinkingIM()
+	defer im.Close()
+	modem := New(im, Timeout(time.Second), PacingScale(0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := modem.LinkContext(ctx, LinkResponder, 1)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Wanted error %v got %v", context.DeadlineExceeded, err)
+	}
+
+	if want := []Command{CmdStartAllLink, CmdCancelAllLink}; !reflect.DeepEqual(want, sent()) {
+		t.Errorf("Wanted commands %v got %v", want, sent())
+	}
+}
+
+func TestLinkDevices(t *testing.T) {
+	im, sent := newLinkingIM(0x03, 0x04, 0x05)
+	defer im.Close()
+	modem := New(im, Timeout(time.Second), PacingScale(0))
+
+	var called []insteon.Address
+	results, err := modem.LinkDevices(LinkController, 1, 3, func(result *LinkResult) {
+		called = append(called, result.Address)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []insteon.Address{0x010203, 0x010204, 0x010205}
+	if !reflect.DeepEqual(want, called) {
+		t.Errorf("Wanted callbacks for %v got %v", want, called)
+	}
+
+	if len(results) != len(want) {
+		t.Fatalf("Wanted %d results got %d", len(want), len(results))
+	}
+
+	for i, result := range results {
+		if result.Address != want[i] {
+			t.Errorf("Wanted result %d to be %v got %v", i, want[i], result.Address)
+		}
+	}
+
+	if want := []Command{CmdStartAllLink, CmdStartAllLink, CmdStartAllLink}; !reflect.DeepEqual(want, sent()) {
+		t.Errorf("Wanted commands %v got %v", want, sent())
+	}
+}
+
+func TestLinkDevicesTimeout(t *testing.T) {
+	im, _ := newLinkingIM(0x03)
+	defer im.Close()
+	modem := New(im, Timeout(time.Second), PacingScale(0))
+
+	defer func(timeout time.Duration) { LinkTimeout = timeout }(LinkTimeout)
+	LinkTimeout = 20 * time.Millisecond
+
+	results, err := modem.LinkDevices(LinkController, 1, 2, nil)
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Errorf("Wanted error %v got %v", ErrReadTimeout, err)
+	}
+
+	if len(results) != 1 {
+		t.Errorf("Wanted 1 result got %d", len(results))
+	}
+}
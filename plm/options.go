@@ -16,20 +16,79 @@ package plm
 
 import (
 	"time"
+
+	"github.com/abates/insteon/commands"
+	"github.com/abates/insteon/devices"
 )
 
 // The Option mechanism is based on the method described at https://dave.cheney.net/2014/10/17/functional-options-for-friendly-apis
 type Option func(p *PLM)
 
+// Timeout sets how long to wait for the IM to respond to a command.
+// Device ACK timeouts are based on the number of hops instead
 func Timeout(timeout time.Duration) Option {
 	return func(p *PLM) {
 		p.timeout = timeout
 	}
 }
 
-// WriteDelay can be passed as a parameter to New to change the delay used after writing a command before reading the response.
+// WriteDelay sets the minimum delay before the IM is asked to send a
+// message.  Messages are otherwise delayed only as long as it takes
+// earlier messages, and their retransmissions, to clear the network
 func WriteDelay(d time.Duration) Option {
 	return func(p *PLM) {
-		p.writeDelay = d
+		p.pacer.minDelay = d
+	}
+}
+
+// PacingScale scales the time allowed for messages to travel through the
+// network before the next one is sent.  It is meant for emulated networks
+// (see plmtest.TimeScale) where messages travel faster than they do over
+// the power line and RF
+func PacingScale(scale float64) Option {
+	return func(p *PLM) {
+		p.pacer.scale = scale
+	}
+}
+
+// OnWriteDelay sets a function that is called with the delay chosen
+// before each message is sent
+func OnWriteDelay(report func(pkt *Packet, delay time.Duration)) Option {
+	return func(p *PLM) {
+		p.pacer.report = report
+	}
+}
+
+// Retry sets the policy used to retry commands that the IM either NAKs
+// (because it is busy) or doesn't respond to in time
+func Retry(policy devices.RetryPolicy) Option {
+	return func(p *PLM) {
+		p.retry = policy
+	}
+}
+
+// LinkCacheAge sets how long the links read from the IM's All-Link
+// database are cached.  The cache is kept up to date with the changes
+// made through the PLM, and is dropped when the IM reports a new link
+// or a reset.  A zero age disables the cache
+func LinkCacheAge(age time.Duration) Option {
+	return func(p *PLM) {
+		p.linkdb.maxAge = age
+	}
+}
+
+// Coalesce enables coalescing of the given commands.  When one of the
+// commands is written while the same command is still queued for the
+// destination, the newer message replaces the queued one.  This keeps
+// status polls, for instance, from piling up behind other traffic
+func Coalesce(cmds ...commands.Command) Option {
+	return func(p *PLM) {
+		if p.queue.coalesce == nil {
+			p.queue.coalesce = make(map[int]bool)
+		}
+
+		for _, cmd := range cmds {
+			p.queue.coalesce[cmd.Command1()] = true
+		}
 	}
 }
@@ -4,19 +4,21 @@ import (
 	"bytes"
 	"testing"
 	"time"
+
+	"github.com/abates/insteon/devices"
 )
 
 func TestOptions(t *testing.T) {
 	want := 1234 * time.Millisecond
 
 	without := New(&bytes.Buffer{})
-	if without.writeDelay != 0 {
-		t.Errorf("writeDelay is %v, expected %v", without.writeDelay, time.Duration(0))
+	if without.pacer.minDelay != 0 {
+		t.Errorf("writeDelay is %v, expected %v", without.pacer.minDelay, time.Duration(0))
 	}
 
 	with := New(&bytes.Buffer{}, WriteDelay(want))
-	if with.writeDelay != want {
-		t.Errorf("writeDelay is %v, want %v", without.writeDelay, want)
+	if with.pacer.minDelay != want {
+		t.Errorf("writeDelay is %v, want %v", with.pacer.minDelay, want)
 	}
 
 	without = New(&bytes.Buffer{})
@@ -29,3 +31,15 @@ func TestOptions(t *testing.T) {
 		t.Errorf("timeout is %v, expected %v", with.timeout, want)
 	}
 }
+
+func TestRetryOption(t *testing.T) {
+	without := New(&bytes.Buffer{})
+	if without.retry.Retries != devices.DefaultRetryPolicy.Retries {
+		t.Errorf("retries is %d, expected %d", without.retry.Retries, devices.DefaultRetryPolicy.Retries)
+	}
+
+	with := New(&bytes.Buffer{}, Retry(devices.RetryPolicy{Retries: 7}))
+	if with.retry.Retries != 7 || with.linkdb.retry.Retries != 7 {
+		t.Errorf("retries is %d (linkdb %d), expected 7", with.retry.Retries, with.linkdb.retry.Retries)
+	}
+}
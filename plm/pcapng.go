@@ -0,0 +1,226 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/abates/insteon"
+)
+
+// LinkTypeIM is the pcapng link type of IM frames.  It is the first of
+// the link types reserved for private use (DLT_USER0), so Wireshark
+// must be told to decode it with the insteon dissector
+const LinkTypeIM = 147
+
+const (
+	pcapngSectionHeader  = 0x0a0d0d0a
+	pcapngInterface      = 0x00000001
+	pcapngEnhancedPacket = 0x00000006
+	pcapngByteOrderMagic = 0x1a2b3c4d
+	pcapngOptionEnd      = 0
+	pcapngOptionName     = 2
+	pcapngOptionFlags    = 2
+	pcapngFlagInbound    = 0x01
+	pcapngFlagOutbound   = 0x02
+)
+
+// nextFrame finds the first complete IM frame in buf.  The frame is
+// buf[start:end].  If the frame is incomplete, end is zero and the
+// bytes before start can be discarded
+func nextFrame(buf []byte, direction Direction) (start, end int) {
+	lens := commandLens
+	if direction == ToIM {
+		lens = hostLens
+	}
+
+	for ; start < len(buf); start++ {
+		// every frame starts with 0x02
+		if buf[start] != 0x02 {
+			continue
+		}
+
+		if len(buf) < start+2 {
+			return start, 0
+		}
+
+		paclen, found := lens[Command(buf[start+1])]
+		if !found {
+			continue
+		}
+
+		if Command(buf[start+1]) == CmdSendInsteonMsg {
+			if len(buf) < start+6 {
+				return start, 0
+			}
+
+			if insteon.Flags(buf[start+5]).Extended() {
+				paclen += 14
+			}
+		}
+
+		if len(buf) < start+2+paclen {
+			return start, 0
+		}
+		return start, start + 2 + paclen
+	}
+	return start, 0
+}
+
+// PcapngWriter writes captured traffic as a pcapng file that can be
+// opened by Wireshark.  Each packet is a single IM frame preceded by a
+// one byte header giving the direction (0 from the IM, 1 to the IM).
+// The direction is also set in the packet flags.  Since reads and
+// writes can split frames, the bytes for each direction are buffered
+// until a frame is complete and the packet is stamped with the time the
+// last part of the frame was captured
+type PcapngWriter struct {
+	mu      sync.Mutex
+	writer  io.Writer
+	pending [2][]byte
+	err     error
+}
+
+// NewPcapngWriter writes the pcapng section header and interface
+// description and returns a writer for the packets
+func NewPcapngWriter(writer io.Writer) (*PcapngWriter, error) {
+	pw := &PcapngWriter{writer: writer}
+
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:4], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:6], 1)
+	binary.LittleEndian.PutUint16(shb[6:8], 0)
+	// the section length is unknown
+	binary.LittleEndian.PutUint64(shb[8:16], 0xffffffffffffffff)
+	if err := pw.writeBlock(pcapngSectionHeader, shb); err != nil {
+		return nil, err
+	}
+
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:2], LinkTypeIM)
+	idb = append(idb, pcapngOption(pcapngOptionName, []byte("insteon"))...)
+	idb = append(idb, pcapngOption(pcapngOptionEnd, nil)...)
+	if err := pw.writeBlock(pcapngInterface, idb); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// pcapngOption encodes an option, padded to 32 bits
+func pcapngOption(code uint16, value []byte) []byte {
+	buf := make([]byte, 4+pad4(len(value)))
+	binary.LittleEndian.PutUint16(buf[0:2], code)
+	binary.LittleEndian.PutUint16(buf[2:4], uint16(len(value)))
+	copy(buf[4:], value)
+	return buf
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+func (pw *PcapngWriter) writeBlock(blockType uint32, body []byte) error {
+	length := 12 + pad4(len(body))
+	buf := make([]byte, length)
+	binary.LittleEndian.PutUint32(buf[0:4], blockType)
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(length))
+	copy(buf[8:], body)
+	binary.LittleEndian.PutUint32(buf[length-4:], uint32(length))
+	_, err := pw.writer.Write(buf)
+	return err
+}
+
+func (pw *PcapngWriter) writePacket(record CaptureRecord, frame []byte) error {
+	data := append([]byte{byte(record.Direction)}, frame...)
+	ts := uint64(record.Time.UnixNano() / 1000)
+	flags := make([]byte, 4)
+	if record.Direction == FromIM {
+		binary.LittleEndian.PutUint32(flags, pcapngFlagInbound)
+	} else {
+		binary.LittleEndian.PutUint32(flags, pcapngFlagOutbound)
+	}
+
+	epb := make([]byte, 20+pad4(len(data)))
+	binary.LittleEndian.PutUint32(epb[0:4], 0)
+	binary.LittleEndian.PutUint32(epb[4:8], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(epb[8:12], uint32(ts))
+	binary.LittleEndian.PutUint32(epb[12:16], uint32(len(data)))
+	binary.LittleEndian.PutUint32(epb[16:20], uint32(len(data)))
+	copy(epb[20:], data)
+	epb = append(epb, pcapngOption(pcapngOptionFlags, flags)...)
+	epb = append(epb, pcapngOption(pcapngOptionEnd, nil)...)
+	return pw.writeBlock(pcapngEnhancedPacket, epb)
+}
+
+// WriteRecord adds the record's data to the data already captured in
+// the same direction and writes out every complete frame.  Data between
+// frames is dropped.  Once a write fails, the error is returned for
+// every following record
+func (pw *PcapngWriter) WriteRecord(record CaptureRecord) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.err != nil {
+		return pw.err
+	}
+
+	dir := 0
+	if record.Direction == ToIM {
+		dir = 1
+	}
+
+	buf := append(pw.pending[dir], record.Data...)
+	for {
+		start, end := nextFrame(buf, record.Direction)
+		buf = buf[start:]
+		if end == 0 {
+			break
+		}
+
+		if pw.err = pw.writePacket(record, buf[0:end-start]); pw.err != nil {
+			return pw.err
+		}
+		buf = buf[end-start:]
+	}
+	pw.pending[dir] = append([]byte{}, buf...)
+	return nil
+}
+
+// ExportPcapng converts a capture to pcapng
+func ExportPcapng(writer io.Writer, capture io.Reader) error {
+	reader, err := NewCaptureReader(capture)
+	if err != nil {
+		return err
+	}
+
+	pw, err := NewPcapngWriter(writer)
+	if err != nil {
+		return err
+	}
+
+	for {
+		record, err := reader.ReadRecord()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err = pw.WriteRecord(record); err != nil {
+			return err
+		}
+	}
+}
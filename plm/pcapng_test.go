@@ -0,0 +1,119 @@
+package plm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNextFrame(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     []byte
+		direction Direction
+		wantStart int
+		wantEnd   int
+	}{
+		{"empty", nil, FromIM, 0, 0},
+		{"noise", []byte{0x15, 0x02}, FromIM, 1, 0},
+		{"get info", []byte{0x02, 0x60}, ToIM, 0, 2},
+		{"get info echo", []byte{0x02, 0x60, 0x01, 0x02, 0x03, 0x03, 0x15, 0x9e, 0x06}, FromIM, 0, 9},
+		{"partial echo", []byte{0x02, 0x60, 0x01, 0x02}, FromIM, 0, 0},
+		{"unknown command", []byte{0x02, 0x42, 0x02, 0x60}, ToIM, 2, 4},
+		{"standard send", []byte{0x02, 0x62, 0x01, 0x02, 0x03, 0x0f, 0x11, 0xff}, ToIM, 0, 8},
+		{"extended send", append([]byte{0x02, 0x62, 0x01, 0x02, 0x03, 0x1f, 0x2e, 0x00}, make([]byte, 14)...), ToIM, 0, 22},
+		{"partial extended send", []byte{0x02, 0x62, 0x01, 0x02, 0x03, 0x1f, 0x2e, 0x00}, ToIM, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end := nextFrame(test.input, test.direction)
+			if start != test.wantStart || end != test.wantEnd {
+				t.Errorf("Wanted frame %d:%d got %d:%d", test.wantStart, test.wantEnd, start, end)
+			}
+		})
+	}
+}
+
+type pcapngBlock struct {
+	blockType uint32
+	body      []byte
+}
+
+func readPcapng(t *testing.T, buf []byte) (blocks []pcapngBlock) {
+	t.Helper()
+	for len(buf) > 0 {
+		if len(buf) < 12 {
+			t.Fatalf("Block too short: %x", buf)
+		}
+
+		length := binary.LittleEndian.Uint32(buf[4:8])
+		if length%4 != 0 || int(length) > len(buf) || binary.LittleEndian.Uint32(buf[length-4:length]) != length {
+			t.Fatalf("Invalid block length %d", length)
+		}
+		blocks = append(blocks, pcapngBlock{binary.LittleEndian.Uint32(buf[0:4]), buf[8 : length-4]})
+		buf = buf[length:]
+	}
+	return blocks
+}
+
+func TestExportPcapng(t *testing.T) {
+	start := time.Unix(1700000000, 123456000)
+	capture := &bytes.Buffer{}
+	cw, _ := NewCaptureWriter(capture)
+	cw.WriteRecord(CaptureRecord{Time: start, Direction: ToIM, Data: []byte{0x02, 0x60}})
+	// the IM's reply is split across two reads
+	cw.WriteRecord(CaptureRecord{Time: start.Add(time.Millisecond), Direction: FromIM, Data: []byte{0x02, 0x60, 0x01, 0x02}})
+	cw.WriteRecord(CaptureRecord{Time: start.Add(2 * time.Millisecond), Direction: FromIM, Data: []byte{0x03, 0x03, 0x15, 0x9e, 0x06, 0x02}})
+
+	out := &bytes.Buffer{}
+	if err := ExportPcapng(out, capture); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	blocks := readPcapng(t, out.Bytes())
+	var gotTypes []uint32
+	for _, block := range blocks {
+		gotTypes = append(gotTypes, block.blockType)
+	}
+
+	wantTypes := []uint32{pcapngSectionHeader, pcapngInterface, pcapngEnhancedPacket, pcapngEnhancedPacket}
+	if !reflect.DeepEqual(wantTypes, gotTypes) {
+		t.Fatalf("Wanted blocks %x got %x", wantTypes, gotTypes)
+	}
+
+	if linkType := binary.LittleEndian.Uint16(blocks[1].body[0:2]); linkType != LinkTypeIM {
+		t.Errorf("Wanted link type %d got %d", LinkTypeIM, linkType)
+	}
+
+	tests := []struct {
+		time  time.Time
+		data  []byte
+		flags uint32
+	}{
+		{start, []byte{byte(ToIM), 0x02, 0x60}, pcapngFlagOutbound},
+		{start.Add(2 * time.Millisecond), []byte{byte(FromIM), 0x02, 0x60, 0x01, 0x02, 0x03, 0x03, 0x15, 0x9e, 0x06}, pcapngFlagInbound},
+	}
+
+	for i, test := range tests {
+		body := blocks[i+2].body
+		ts := uint64(binary.LittleEndian.Uint32(body[4:8]))<<32 | uint64(binary.LittleEndian.Uint32(body[8:12]))
+		if want := uint64(test.time.UnixNano() / 1000); ts != want {
+			t.Errorf("Packet %d wanted timestamp %d got %d", i, want, ts)
+		}
+
+		length := binary.LittleEndian.Uint32(body[12:16])
+		if got := body[20 : 20+length]; !bytes.Equal(test.data, got) {
+			t.Errorf("Packet %d wanted data %x got %x", i, test.data, got)
+		}
+
+		options := body[20+pad4(int(length)):]
+		if code := binary.LittleEndian.Uint16(options[0:2]); code != pcapngOptionFlags {
+			t.Errorf("Packet %d wanted flags option got %d", i, code)
+		} else if flags := binary.LittleEndian.Uint32(options[4:8]); flags != test.flags {
+			t.Errorf("Packet %d wanted flags %d got %d", i, test.flags, flags)
+		}
+	}
+}
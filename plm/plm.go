@@ -16,6 +16,7 @@ package plm
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -23,9 +24,11 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
 	"github.com/abates/insteon/devices"
 )
 
@@ -39,6 +42,8 @@ var (
 	ErrWrongAck           = errors.New("Command in ACK does not match TX packet")
 	ErrWrongPayload       = errors.New("Payload in ACK does not match TX packet")
 	ErrNak                = errors.New("PLM responded with a NAK.  Resend command")
+	ErrClosed             = errors.New("PLM is closed")
+	ErrLinkNotFound       = errors.New("No matching link record in the IM")
 )
 
 var (
@@ -54,60 +59,166 @@ func hexDump(format string, buf []byte, sep string) string {
 	return strings.Join(str, sep)
 }
 
+// PLM is a connection to an Insteon PowerLinc Modem (or any other
+// Insteon IM). A single PLM is safe for concurrent use by multiple
+// goroutines.  Transmissions are serialized and each ACK, NAK and
+// IM response is delivered only to the goroutine waiting for it
 type PLM struct {
-	writer  io.Writer
 	reader  *packetReader
 	address insteon.Address
 
 	linkdb
-	timeout    time.Duration
-	retries    int
-	writeDelay time.Duration
+	timeout time.Duration
+	retry   devices.RetryPolicy
+	pacer   pacer
+
+	dial       Dialer
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	stateFunc  func(ConnState, error)
 
-	msgBuf    chan *Packet
+	msgBuf    chan *insteon.Message
 	packetBuf chan *Packet
+	ackBuf    chan *Packet
+
+	// done is closed by Close, stopped is closed when readLoop exits
+	done     chan struct{}
+	stopped  chan struct{}
+	doneOnce sync.Once
+
+	// txMu serializes IM commands and their ACKs
+	txMu sync.Mutex
+
+	// linkMu serializes linking sessions started with LinkContext
+	linkMu sync.Mutex
+
+	// x10Mu keeps the address and function of an X10 send together,
+	// so that another sender can't change the addressed unit
+	x10Mu sync.Mutex
+
+	// queue serializes insteon transmissions, a message has its turn
+	// from the time it is sent until the device ACK is received
+	queue sendQueue
+
+	// mu protects the fields below
+	mu      sync.Mutex
+	port    io.ReadWriter
+	writer  io.Writer
+	state   ConnState
+	down    chan struct{} // closed when the connection is lost
+	pending *pendingAck
+	conns   map[insteon.Address][]*Conn
+	subs    []*subscriber
+	x10     x10Decoder
+	linkCh  chan *LinkResult
+	closed  bool
+}
+
+// pendingAck is the insteon message waiting for a device ACK
+type pendingAck struct {
+	dst insteon.Address
+	cmd commands.Command
+	ch  chan *insteon.Message
+}
+
+// matches indicates if msg is the ACK (or NAK) of the pending message.
+// Devices also ACK direct messages sent to the IM during linking, so
+// the ACK must repeat command 1 of the message, except for a light status
+// request whose ACK has the All-Link database delta in command 1
+func (p *pendingAck) matches(msg *insteon.Message) bool {
+	if msg.Src != p.dst || !(msg.Ack() || msg.Nak()) {
+		return false
+	}
+	return msg.Command.Command1() == p.cmd.Command1() || p.cmd.Command1() == commands.LightStatusRequest.Command1()
 }
 
 // New creates a new PLM instance.
 func New(rw io.ReadWriter, options ...Option) (plm *PLM) {
 	plm = &PLM{
-		writer: logWriter{rw},
-		reader: newPacketReader(rw, false),
-
-		timeout:   time.Second * 3,
-		retries:   3,
-		msgBuf:    make(chan *Packet, 10),
-		packetBuf: make(chan *Packet, 10),
+		timeout:    time.Second * 3,
+		linkdb:     linkdb{maxAge: DefaultLinkCacheAge},
+		retry:      devices.DefaultRetryPolicy,
+		pacer:      pacer{scale: 1},
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+		msgBuf:     make(chan *insteon.Message, 10),
+		packetBuf:  make(chan *Packet, 10),
+		ackBuf:     make(chan *Packet, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		conns:      make(map[insteon.Address][]*Conn),
 	}
 
 	for _, o := range options {
 		o(plm)
 	}
 
+	plm.connect(rw)
+
 	plm.linkdb.plm = plm
-	plm.linkdb.retries = plm.retries
-	plm.linkdb.timeout = plm.timeout
+	plm.linkdb.retry = plm.retry
 	go plm.readLoop()
 	return plm
 }
 
 func (plm *PLM) readLoop() {
+	defer close(plm.stopped)
 	for {
 		pkt, err := plm.reader.ReadPacket()
-		if err != nil {
-			if !errors.Is(err, io.EOF) {
+		if err != nil && !plm.isClosed() && plm.dial != nil && plm.reconnect(err) {
+			continue
+		} else if err != nil {
+			if !errors.Is(err, io.EOF) && !plm.isClosed() {
 				Log.Printf("Read error: %v", err)
 			}
 			close(plm.msgBuf)
 			close(plm.packetBuf)
+			close(plm.ackBuf)
+			plm.stop()
 			return
 		}
 
+		if pkt.Command == CmdX10MsgReceived {
+			plm.pacer.busyFor(x10Delay, false)
+			if plm.dispatchX10(pkt) {
+				continue
+			}
+		}
+
+		if event, ok := decodeEvent(pkt); ok {
+			LogDebug.Printf("RX Event %v", event)
+			if _, reset := event.(UserResetEvent); reset {
+				Log.Printf("The IM was reset by the user")
+				plm.linkdb.invalidate()
+			}
+			plm.dispatchEvent(event)
+			continue
+		}
+
+		if pkt.Command == CmdAllLinkComplete {
+			plm.linkdb.invalidate()
+		}
+
+		if pkt.Command == CmdAllLinkComplete && plm.deliverLink(pkt) {
+			continue
+		}
+
 		if pkt.Command == CmdStdMsgReceived || pkt.Command == CmdExtMsgReceived {
+			msg := &insteon.Message{}
+			err = msg.UnmarshalBinary(pkt.Payload)
+			if err == nil {
+				LogDebug.Printf("RX Insteon Message %v", msg)
+				plm.pacer.received(msg, len(pkt.Payload))
+				plm.dispatch(msg)
+			} else {
+				Log.Printf("Failed to unmarshal insteon message: %v", err)
+			}
+		} else if pkt.Command == CmdNak || pkt.Command >= CmdGetInfo {
+			// responses to IM commands go to whoever is holding txMu
 			select {
-			case plm.msgBuf <- pkt:
+			case plm.ackBuf <- pkt:
 			default:
-				Log.Printf("PLM Packet dropped, no one listening")
+				Log.Printf("PLM ACK dropped, no one listening")
 			}
 		} else {
 			select {
@@ -119,26 +230,222 @@ func (plm *PLM) readLoop() {
 	}
 }
 
+// stop closes all subscriptions, nothing more will be delivered
+func (plm *PLM) stop() {
+	plm.mu.Lock()
+	defer plm.mu.Unlock()
+	plm.closed = true
+	for _, s := range plm.subs {
+		s.close()
+	}
+	plm.subs = nil
+}
+
+func (plm *PLM) isClosed() bool {
+	select {
+	case <-plm.done:
+		return true
+	default:
+	}
+	return false
+}
+
+// readErr is returned by reads once the buffers have been closed
+func (plm *PLM) readErr() error {
+	if plm.isClosed() {
+		return ErrClosed
+	}
+	return io.EOF
+}
+
+// Close stops the PLM and closes the port, if the port is an io.Closer.
+// Any goroutine waiting in Read, ReadPacket or Write (including those
+// on a Conn) is unblocked and gets ErrClosed, as does any later call.
+// Close waits for the read loop to exit.  If the port can't be closed
+// the read loop will only exit once the next read from the port
+// returns
+func (plm *PLM) Close() (err error) {
+	err = ErrClosed
+	plm.doneOnce.Do(func() {
+		err = nil
+		close(plm.done)
+
+		plm.mu.Lock()
+		port := plm.port
+		plm.mu.Unlock()
+		plm.stop()
+
+		// a nil port means the read loop is reconnecting, it
+		// will notice done before dialing again
+		if closer, ok := port.(io.Closer); ok {
+			err = closer.Close()
+			<-plm.stopped
+		} else if port == nil {
+			<-plm.stopped
+		}
+	})
+	return err
+}
+
+// dispatch delivers an insteon message to the goroutine waiting for it.
+// Every matching subscription gets a copy of the message.  Beyond that,
+// device ACKs go to the pending writer, messages from a device go to
+// that device's Conn and everything else goes to Read
+func (plm *PLM) dispatch(msg *insteon.Message) {
+	plm.mu.Lock()
+	defer plm.mu.Unlock()
+
+	subscribed := plm.publish(messageTopic, msg) > 0
+
+	if p := plm.pending; p != nil && p.matches(msg) {
+		plm.pending = nil
+		p.ch <- msg
+		return
+	}
+
+	if conns := plm.conns[msg.Src]; len(conns) > 0 {
+		for _, conn := range conns {
+			conn.deliver(msg)
+		}
+		return
+	}
+
+	select {
+	case plm.msgBuf <- msg:
+	default:
+		if !subscribed {
+			Log.Printf("PLM Packet dropped, no one listening")
+		}
+	}
+}
+
+// Dial returns a connection to the device with the given address.  Any
+// messages sent by the device (other than ACKs to messages written by
+// another goroutine) are delivered only to the connection, which allows
+// many devices to be used concurrently from different goroutines.  The
+// connection should be closed when it is no longer needed
+func (plm *PLM) Dial(dst insteon.Address) *Conn {
+	conn := &Conn{
+		plm:    plm,
+		addr:   dst,
+		msgBuf: make(chan *insteon.Message, 10),
+	}
+	plm.mu.Lock()
+	plm.conns[dst] = append(plm.conns[dst], conn)
+	plm.mu.Unlock()
+	return conn
+}
+
+// DialDevice is the same as Dial.  It makes the PLM a devices.Dialer, so
+// that devices opened with the PLM (see devices.Open) each read their
+// messages from their own connection
+func (plm *PLM) DialDevice(dst insteon.Address) devices.MessageWriter {
+	return plm.Dial(dst)
+}
+
+func (plm *PLM) hangup(conn *Conn) {
+	plm.mu.Lock()
+	defer plm.mu.Unlock()
+	conns := plm.conns[conn.addr]
+	for i, c := range conns {
+		if c == conn {
+			conns = append(conns[0:i], conns[i+1:]...)
+			break
+		}
+	}
+
+	if len(conns) == 0 {
+		delete(plm.conns, conn.addr)
+	} else {
+		plm.conns[conn.addr] = conns
+	}
+}
+
 // Write insteon message
 func (plm *PLM) Write(msg *insteon.Message) (ack *insteon.Message, err error) {
+	return plm.WriteContext(context.Background(), msg)
+}
+
+// WriteContext will send the insteon message and wait for the corresponding
+// ACK or NAK from the remote device.  How long to wait depends on the number
+// of hops and the message length (see devices.AckTimeout).  If the context
+// is done before the ACK is received then ctx.Err() is returned.
+//
+// Messages are queued and sent one at a time, in order of the priority
+// given to the context with WithPriority.  Messages with the same priority
+// take turns by destination.  If the message's command is coalesced (see
+// the Coalesce option) and the same command is already queued for the
+// destination, the queued message is replaced and both callers get the
+// ACK of the newer message.  If the context of the caller sending the
+// message is done, one of the callers still waiting sends it instead
+func (plm *PLM) WriteContext(ctx context.Context, msg *insteon.Message) (ack *insteon.Message, err error) {
+	if _, err = msg.MarshalBinary(); err != nil {
+		return nil, err
+	}
+
+	r := plm.queue.push(msg, priority(ctx))
+	msg, err = plm.queue.wait(ctx, r)
+	if err != nil {
+		return nil, err
+	} else if msg == nil {
+		return r.ack, r.err
+	}
+
+	ack, err = plm.send(ctx, msg)
+	if err != nil && ctx.Err() != nil {
+		// the other callers waiting on a coalesced message still
+		// want it sent
+		plm.queue.release(r, ack, err)
+	} else {
+		plm.queue.finish(r, ack, err)
+	}
+	return ack, err
+}
+
+// send transmits the message and waits for the device ACK
+func (plm *PLM) send(ctx context.Context, msg *insteon.Message) (ack *insteon.Message, err error) {
 	buf, err := msg.MarshalBinary()
-	if err == nil {
-		LogDebug.Printf("TX Message %v", msg)
-		// slice off the source address since the PLM doesn't want it
-		buf = buf[3:]
-		_, err = retry(plm, plm.retries, true).WritePacket(&Packet{Command: CmdSendInsteonMsg, Payload: buf})
+	if err != nil {
+		return nil, err
+	}
 
-		if err == nil {
-			// get the ACK
-			ack, err = plm.Read()
-			for ; err == nil; ack, err = plm.Read() {
-				if ack.Src == msg.Dst && (ack.Ack() || ack.Nak()) {
-					if ack.Nak() {
-						err = devices.ErrNak
-					}
-					break
-				}
+	// register for the ACK prior to sending the message so that
+	// a fast response can't get away
+	pending := &pendingAck{dst: msg.Dst, cmd: msg.Command, ch: make(chan *insteon.Message, 1)}
+	plm.mu.Lock()
+	plm.pending = pending
+	plm.mu.Unlock()
+
+	defer func() {
+		plm.mu.Lock()
+		if plm.pending == pending {
+			plm.pending = nil
+		}
+		plm.mu.Unlock()
+	}()
+
+	LogDebug.Printf("TX Message %v", msg)
+	// slice off the source address since the PLM doesn't want it
+	buf = buf[3:]
+	_, err = retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: CmdSendInsteonMsg, Payload: buf})
+
+	if err == nil {
+		timer := time.NewTimer(devices.AckTimeout(msg))
+		defer timer.Stop()
+
+		select {
+		case msg, ok := <-pending.ch:
+			if !ok {
+				err = ErrDisconnected
+			} else if ack = msg; ack.Nak() {
+				err = devices.ErrNak
 			}
+		case <-plm.done:
+			err = ErrClosed
+		case <-timer.C:
+			err = fmt.Errorf("Device ACK %w", insteon.ErrReadTimeout)
+		case <-ctx.Done():
+			err = ctx.Err()
 		}
 	}
 
@@ -146,66 +453,177 @@ func (plm *PLM) Write(msg *insteon.Message) (ack *insteon.Message, err error) {
 }
 
 func (plm *PLM) WritePacket(pkt *Packet) (ack *Packet, err error) {
+	return plm.WritePacketContext(context.Background(), pkt)
+}
+
+// WritePacketContext will send the packet to the IM and wait for the IM
+// to acknowledge it.  If the context is done before the acknowledgement
+// is received then ctx.Err() is returned
+func (plm *PLM) WritePacketContext(ctx context.Context, pkt *Packet) (ack *Packet, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	} else if plm.isClosed() {
+		return nil, ErrClosed
+	}
+
 	buf, err := pkt.MarshalBinary()
-	if err == nil {
-		LogDebug.Printf("TX Packet %v", pkt)
-		_, err = plm.writer.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	plm.txMu.Lock()
+	defer plm.txMu.Unlock()
+
+	plm.mu.Lock()
+	writer, down := plm.writer, plm.down
+	plm.mu.Unlock()
 
+	select {
+	case <-down:
+		return nil, ErrDisconnected
+	default:
+	}
+
+	// discard any late ACKs from a previous command that timed out
+	for drained := false; !drained; {
+		select {
+		case stale, ok := <-plm.ackBuf:
+			if !ok {
+				return nil, plm.readErr()
+			}
+			LogDebug.Printf("Discarding stale ACK %v", stale)
+		default:
+			drained = true
+		}
+	}
+
+	// give earlier messages time to clear the network
+	if err = plm.pacer.wait(ctx, pkt); err != nil {
+		return nil, err
+	}
+
+	LogDebug.Printf("TX Packet %v", pkt)
+	_, err = writer.Write(buf)
+
+	if err == nil {
+		ack, err = plm.readAck(ctx, down)
 		if err == nil {
-			ack, err = plm.ReadPacket()
-			if err == nil {
-				// these things happen rarely, but we can (a least in the
-				// case of ErrWrongAck) usually do something about it
-				if !ack.ACK() && !ack.NAK() {
-					err = ErrNoAck
-				} else if ack.Command != pkt.Command {
-					err = ErrWrongAck
-				} else if ack.Command != CmdGetInfo && ack.Command != CmdGetConfig {
-					payload := ack.Payload
-					if ack.Command == CmdSendInsteonMsg {
-						payload = payload[3:]
-					}
-					if !bytes.Equal(payload, pkt.Payload) {
-						err = ErrWrongPayload
-					}
+			// these things happen rarely, but we can (a least in the
+			// case of ErrWrongAck) usually do something about it
+			if !ack.ACK() && !ack.NAK() {
+				err = ErrNoAck
+			} else if ack.Command != pkt.Command {
+				err = ErrWrongAck
+			} else if ack.Command != CmdGetInfo && ack.Command != CmdGetConfig {
+				payload := ack.Payload
+				if ack.Command == CmdSendInsteonMsg {
+					payload = payload[3:]
 				}
-
-				if ack.NAK() {
-					err = ErrNak
+				if !bytes.Equal(payload, pkt.Payload) {
+					err = ErrWrongPayload
 				}
 			}
+
+			if ack.NAK() {
+				err = ErrNak
+			} else if err == nil {
+				plm.pacer.sent(pkt)
+			}
 		}
 	}
 
 	return
 }
 
+// readAck waits for the IM response to the last command sent
+func (plm *PLM) readAck(ctx context.Context, down <-chan struct{}) (ack *Packet, err error) {
+	timer := time.NewTimer(plm.timeout)
+	defer timer.Stop()
+
+	select {
+	case pkt, ok := <-plm.ackBuf:
+		if !ok {
+			return nil, plm.readErr()
+		}
+		ack = pkt
+	case <-down:
+		err = ErrDisconnected
+	case <-plm.done:
+		err = ErrClosed
+	case <-timer.C:
+		err = fmt.Errorf("PLM ACK %w", ErrReadTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
 func (plm *PLM) ReadPacket() (pkt *Packet, err error) {
+	return plm.ReadPacketContext(context.Background())
+}
+
+// ReadPacketContext waits for the next packet from the IM that is not a
+// response to a command (such as All-Link records and IM events). The wait
+// is limited by both the PLM timeout and the context
+func (plm *PLM) ReadPacketContext(ctx context.Context) (pkt *Packet, err error) {
+	timer := time.NewTimer(plm.timeout)
+	defer timer.Stop()
+
 	select {
-	case pkt = <-plm.packetBuf:
-	case <-time.After(plm.timeout):
+	case p, ok := <-plm.packetBuf:
+		if !ok {
+			return nil, plm.readErr()
+		}
+		pkt = p
+	case <-plm.done:
+		err = ErrClosed
+	case <-timer.C:
 		err = fmt.Errorf("PLM ACK %w", ErrReadTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
 	}
 	return
 }
 
 func (plm *PLM) Read() (msg *insteon.Message, err error) {
+	return plm.ReadContext(context.Background())
+}
+
+// ReadContext waits for the next insteon message received by the IM that
+// was not delivered to a waiting writer or Conn.  The wait is limited by
+// both the PLM timeout and the context
+func (plm *PLM) ReadContext(ctx context.Context) (msg *insteon.Message, err error) {
+	return plm.readMessage(ctx, plm.msgBuf)
+}
+
+// readMessage waits for the next message on msgBuf
+func (plm *PLM) readMessage(ctx context.Context, msgBuf <-chan *insteon.Message) (msg *insteon.Message, err error) {
+	timer := time.NewTimer(plm.timeout)
+	defer timer.Stop()
+
 	select {
-	case pkt := <-plm.msgBuf:
-		msg = &insteon.Message{}
-		err = msg.UnmarshalBinary(pkt.Payload)
-		if err == nil {
-			LogDebug.Printf("RX Insteon Message %v", msg)
+	case m, ok := <-msgBuf:
+		if !ok {
+			return nil, plm.readErr()
 		}
-	case <-time.After(plm.timeout):
+		msg = m
+	case <-plm.done:
+		err = ErrClosed
+	case <-timer.C:
 		err = fmt.Errorf("Device ACK %w", insteon.ErrReadTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
 	}
 
 	return msg, err
 }
 
 func (plm *PLM) Info() (info *Info, err error) {
-	ack, err := retry(plm, plm.retries, true).WritePacket(&Packet{Command: CmdGetInfo})
+	return plm.info(context.Background())
+}
+
+func (plm *PLM) info(ctx context.Context) (info *Info, err error) {
+	ack, err := retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: CmdGetInfo})
 	if err == nil {
 		info = &Info{}
 		err = info.UnmarshalBinary(ack.Payload)
@@ -218,13 +636,17 @@ func (plm *PLM) Reset() error {
 	timeout := plm.timeout
 	plm.timeout = 20 * time.Second
 
-	_, err := retry(plm, plm.retries, true).WritePacket(&Packet{Command: CmdReset})
+	_, err := retry(plm, plm.retry, true).WritePacket(&Packet{Command: CmdReset})
 	plm.timeout = timeout
 	return err
 }
 
 func (plm *PLM) Config() (config Config, err error) {
-	ack, err := retry(plm, plm.retries, true).WritePacket(&Packet{Command: CmdGetConfig})
+	return plm.config(context.Background())
+}
+
+func (plm *PLM) config(ctx context.Context) (config Config, err error) {
+	ack, err := retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: CmdGetConfig})
 	if err == nil {
 		err = config.UnmarshalBinary(ack.Payload)
 	}
@@ -232,30 +654,91 @@ func (plm *PLM) Config() (config Config, err error) {
 }
 
 func (plm *PLM) SetConfig(config Config) error {
+	return plm.setConfig(context.Background(), config)
+}
+
+func (plm *PLM) setConfig(ctx context.Context, config Config) error {
 	payload, _ := config.MarshalBinary()
-	_, err := retry(plm, plm.retries, true).WritePacket(&Packet{Command: CmdSetConfig, Payload: payload})
+	_, err := retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: CmdSetConfig, Payload: payload})
+	return err
+}
+
+// SetDeviceCategory sets the sub-category that the IM reports to other
+// devices, for instance in response to an ID request or when linking.
+// The IM's domain and firmware version are left as they are.  Use
+// SetDeviceCategoryContext to set all of them
+func (plm *PLM) SetDeviceCategory(category insteon.Category) error {
+	ctx := context.Background()
+	info, err := plm.info(ctx)
+	if err == nil {
+		err = plm.SetDeviceCategoryContext(ctx, insteon.DevCat{info.DevCat[0], byte(category)}, info.Firmware)
+	}
 	return err
 }
 
-func (plm *PLM) SetDeviceCategory(insteon.Category) error {
-	// TODO
-	return ErrNotImplemented
+// SetDeviceCategoryContext sets the device category, sub-category and
+// firmware version that the IM reports to other devices.  The setting
+// is lost when the IM is power cycled
+func (plm *PLM) SetDeviceCategoryContext(ctx context.Context, devCat insteon.DevCat, firmware Version) error {
+	payload := []byte{devCat[0], devCat[1], byte(firmware)}
+	_, err := retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: CmdSetHostCategory, Payload: payload})
+	return err
 }
 
+// RFSleep puts the IM's radio to sleep until the host sends it another
+// command.  Use Wake to wake the IM
 func (plm *PLM) RFSleep() error {
-	// TODO
-	return ErrNotImplemented
+	return plm.RFSleepContext(context.Background())
+}
+
+// RFSleepContext is the same as RFSleep, but stops waiting for the IM
+// when the context is done
+func (plm *PLM) RFSleepContext(ctx context.Context) error {
+	_, err := retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: CmdRfSleep, Payload: []byte{0x00, 0x00}})
+	return err
+}
+
+// Wake wakes the IM from RF sleep and detects it again
+func (plm *PLM) Wake() (*Info, error) {
+	return plm.WakeContext(context.Background())
+}
+
+// WakeContext wakes the IM from RF sleep and returns its info.  The IM
+// discards the command that wakes it, so the command is always retried
+// at least once.  The IM's address is updated from the info
+func (plm *PLM) WakeContext(ctx context.Context) (info *Info, err error) {
+	policy := plm.retry
+	if policy.Retries < 1 {
+		policy.Retries = 1
+	}
+
+	ack, err := retry(plm, policy, true).WritePacketContext(ctx, &Packet{Command: CmdGetInfo})
+	if err == nil {
+		info = &Info{}
+		if err = info.UnmarshalBinary(ack.Payload); err == nil {
+			plm.mu.Lock()
+			plm.address = info.Address
+			plm.mu.Unlock()
+		}
+	}
+	return info, err
 }
 
 func (plm *PLM) Address() insteon.Address {
-	address := insteon.Address(0)
-	if plm.address == address {
+	plm.mu.Lock()
+	address := plm.address
+	plm.mu.Unlock()
+
+	if address == insteon.Address(0) {
 		info, err := plm.Info()
 		if err == nil {
-			plm.address = info.Address
+			address = info.Address
+			plm.mu.Lock()
+			plm.address = address
+			plm.mu.Unlock()
 		}
 	}
-	return plm.address
+	return address
 }
 
 func (plm *PLM) String() string {
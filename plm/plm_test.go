@@ -0,0 +1,380 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+	"github.com/abates/insteon/devices"
+)
+
+// testPort is an io.ReadWriter where reads block until data is
+// written to the rx side of the port
+type testPort struct {
+	rx *io.PipeReader
+}
+
+func newTestPort() (port *testPort, rx *io.PipeWriter) {
+	r, w := io.Pipe()
+	return &testPort{rx: r}, w
+}
+
+func (tp *testPort) Read(buf []byte) (int, error) { return tp.rx.Read(buf) }
+
+func (tp *testPort) Write(buf []byte) (int, error) { return len(buf), nil }
+
+func TestPLMReadContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		wantErr error
+	}{
+		{"cancelled", time.Hour, true, context.Canceled},
+		{"timeout", time.Millisecond, false, ErrReadTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			port, rx := newTestPort()
+			defer rx.Close()
+			modem := New(port, Timeout(test.timeout))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if test.cancel {
+				cancel()
+			}
+			defer cancel()
+
+			_, err := modem.ReadPacketContext(ctx)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Wanted ReadPacketContext error %v got %v", test.wantErr, err)
+			}
+
+			_, err = modem.ReadContext(ctx)
+			if test.wantErr == ErrReadTimeout {
+				test.wantErr = insteon.ErrReadTimeout
+			}
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Wanted ReadContext error %v got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPLMWriteContextCancelled(t *testing.T) {
+	port, rx := newTestPort()
+	defer rx.Close()
+	modem := New(port, Timeout(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := modem.WriteContext(ctx, &insteon.Message{Dst: insteon.Address(0x010203), Flags: insteon.StandardDirectMessage})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Wanted error %v got %v", context.Canceled, err)
+	}
+}
+
+func TestPLMCommandContextCancelled(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  func(ctx context.Context, modem *PLM) error
+	}{
+		{"set device category", func(ctx context.Context, modem *PLM) error {
+			return modem.SetDeviceCategoryContext(ctx, insteon.DevCat{0x01, 0x20}, 0x45)
+		}},
+		{"rf sleep", func(ctx context.Context, modem *PLM) error { return modem.RFSleepContext(ctx) }},
+		{"wake", func(ctx context.Context, modem *PLM) error { _, err := modem.WakeContext(ctx); return err }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			port, rx := newTestPort()
+			defer rx.Close()
+			modem := New(port, Timeout(time.Hour))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+
+			if err := test.cmd(ctx, modem); !errors.Is(err, context.Canceled) {
+				t.Errorf("Wanted error %v got %v", context.Canceled, err)
+			}
+		})
+	}
+}
+
+func TestPendingAckMatches(t *testing.T) {
+	dst := insteon.Address(0x010203)
+	tests := []struct {
+		name  string
+		cmd   commands.Command
+		msg   *insteon.Message
+		match bool
+	}{
+		{"ack", commands.LightOn, &insteon.Message{Src: dst, Flags: insteon.StandardDirectAck, Command: commands.LightOn}, true},
+		{"nak", commands.LightOn, &insteon.Message{Src: dst, Flags: insteon.StandardDirectNak, Command: commands.LightOn.SubCommand(0xff)}, true},
+		{"other device", commands.LightOn, &insteon.Message{Src: insteon.Address(0x040506), Flags: insteon.StandardDirectAck, Command: commands.LightOn}, false},
+		{"not an ack", commands.LightOn, &insteon.Message{Src: dst, Flags: insteon.StandardDirectMessage, Command: commands.LightOn}, false},
+		{"other command", commands.ExitLinkingMode, &insteon.Message{Src: dst, Flags: insteon.StandardDirectAck, Command: commands.AssignToAllLinkGroup}, false},
+		{"status request", commands.LightStatusRequest, &insteon.Message{Src: dst, Flags: insteon.StandardDirectAck, Command: commands.Command(0x000480)}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &pendingAck{dst: dst, cmd: test.cmd}
+			if got := p.matches(test.msg); got != test.match {
+				t.Errorf("Wanted match %v got %v", test.match, got)
+			}
+		})
+	}
+}
+
+// testIM is an io.ReadWriter that answers every packet written to it
+// with the responses generated by the respond function
+type testIM struct {
+	rx      *io.PipeReader
+	tx      *io.PipeWriter
+	mu      sync.Mutex
+	respond func(pkt []byte) [][]byte
+}
+
+func newTestIM(respond func(pkt []byte) [][]byte) *testIM {
+	r, w := io.Pipe()
+	return &testIM{rx: r, tx: w, respond: respond}
+}
+
+func (ti *testIM) Read(buf []byte) (int, error) { return ti.rx.Read(buf) }
+
+func (ti *testIM) Write(buf []byte) (int, error) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	for _, response := range ti.respond(buf) {
+		ti.tx.Write(response)
+	}
+	return len(buf), nil
+}
+
+func (ti *testIM) Close() error { return ti.tx.Close() }
+
+func TestPLMConcurrentWrites(t *testing.T) {
+	plmAddr := []byte{0x0a, 0x0b, 0x0c}
+	im := newTestIM(func(pkt []byte) [][]byte {
+		// echo the command back with an ACK
+		echo := append(append([]byte{}, pkt...), 0x06)
+		if pkt[1] != byte(CmdSendInsteonMsg) {
+			return [][]byte{echo}
+		}
+
+		dst := pkt[2:5]
+		ack := append(append(append([]byte{0x02, 0x50}, dst...), plmAddr...), byte(insteon.StandardDirectAck), pkt[6], pkt[7])
+		ext := append(append(append([]byte{0x02, 0x51}, dst...), plmAddr...), byte(insteon.ExtendedDirectMessage), pkt[6], pkt[7])
+		ext = append(ext, make([]byte, 14)...)
+		ext[len(ext)-1] = dst[2]
+		return [][]byte{echo, ack, ext}
+	})
+	defer im.Close()
+	modem := New(im, Timeout(time.Second), PacingScale(0))
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(addr insteon.Address) {
+			defer wg.Done()
+			conn := modem.Dial(addr)
+			defer conn.Close()
+
+			for j := 0; j < 5; j++ {
+				ack, err := conn.Write(&insteon.Message{Flags: insteon.StandardDirectMessage, Command: commands.ExtendedGetSet})
+				if err != nil {
+					t.Errorf("%v: unexpected error: %v", addr, err)
+					return
+				}
+
+				if ack.Src != addr {
+					t.Errorf("Wanted ACK from %v got %v", addr, ack.Src)
+				}
+
+				msg, err := conn.Read()
+				if err != nil {
+					t.Errorf("%v: unexpected error: %v", addr, err)
+				} else if msg.Src != addr || msg.Payload[13] != byte(addr) {
+					t.Errorf("Wanted extended response from %v got %v", addr, msg)
+				}
+			}
+		}(insteon.Address(0x010200 + i))
+	}
+	wg.Wait()
+}
+
+func TestPLMConcurrentLinks(t *testing.T) {
+	plmAddr := []byte{0x0a, 0x0b, 0x0c}
+	var im *testIM
+	im = newTestIM(func(pkt []byte) [][]byte {
+		echo := append(append([]byte{}, pkt...), 0x06)
+		if pkt[1] != byte(CmdSendInsteonMsg) {
+			return [][]byte{echo}
+		}
+
+		dst := append([]byte{}, pkt[2:5]...)
+		ack := append(append(append([]byte{0x02, 0x50}, dst...), plmAddr...), byte(insteon.StandardDirectAck), pkt[6], pkt[7])
+		if pkt[6] == byte(commands.ReadWriteALDB.Command1()) {
+			// the records trickle in, so the two link databases
+			// are read at the same time
+			go func() {
+				for i := 0; i < 4; i++ {
+					time.Sleep(2 * time.Millisecond)
+					link := insteon.ResponderLink(insteon.Group(i), insteon.Address(uint32(dst[0])<<16|uint32(dst[1])<<8|uint32(dst[2])))
+					if i == 3 {
+						link.Flags.SetLastRecord()
+					}
+					buf, _ := link.MarshalBinary()
+					payload := append(append([]byte{0x00, 0x01, 0x0f, byte(0xff - i*8), 0x00}, buf...), 0x00)
+					ext := append(append(append([]byte{0x02, 0x51}, dst...), plmAddr...), byte(insteon.ExtendedDirectMessage), pkt[6], pkt[7])
+					im.tx.Write(append(ext, payload...))
+				}
+			}()
+		}
+		return [][]byte{echo, ack}
+	})
+	defer im.Close()
+	modem := New(im, Timeout(time.Second), PacingScale(0))
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 2; i++ {
+		wg.Add(1)
+		go func(addr insteon.Address) {
+			defer wg.Done()
+			device := devices.New(modem, devices.DeviceInfo{Address: addr, EngineVersion: insteon.VerI2})
+			defer device.Close()
+
+			links, err := device.Links()
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", addr, err)
+				return
+			}
+
+			if len(links) != 3 {
+				t.Errorf("%v: wanted 3 links got %v", addr, links)
+			}
+
+			for _, link := range links {
+				if link.Address != addr {
+					t.Errorf("%v: wanted only its own links got %v", addr, links)
+					break
+				}
+			}
+		}(insteon.Address(0x010200 + i))
+	}
+	wg.Wait()
+}
+
+func TestPLMWriteAfterEOF(t *testing.T) {
+	modem := New(&capturePort{Reader: bytes.NewReader(nil)}, Timeout(time.Second))
+	<-modem.stopped
+
+	errCh := make(chan error, 1)
+	go func() { _, err := modem.Info(); errCh <- err }()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("Wanted error %v got %v", io.EOF, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Write after the reader hit EOF did not return")
+	}
+}
+
+func TestPLMClose(t *testing.T) {
+	im := newTestIM(func(pkt []byte) [][]byte { return nil })
+	modem := New(im, Timeout(time.Hour))
+	conn := modem.Dial(insteon.Address(0x010203))
+	sub := modem.Subscribe(devices.AllLinkMatcher())
+
+	reads := []func() error{
+		func() error { _, err := modem.Read(); return err },
+		func() error { _, err := modem.ReadPacket(); return err },
+		func() error { _, err := conn.Read(); return err },
+	}
+
+	errCh := make(chan error, len(reads))
+	for _, read := range reads {
+		go func(read func() error) { errCh <- read() }(read)
+	}
+
+	if err := modem.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case <-modem.stopped:
+	default:
+		t.Errorf("Expected read loop to have stopped")
+	}
+
+	for range reads {
+		if err := <-errCh; err != ErrClosed {
+			t.Errorf("Wanted error %v got %v", ErrClosed, err)
+		}
+	}
+
+	if _, ok := <-sub.Messages(); ok {
+		t.Errorf("Expected subscription to be closed")
+	}
+
+	if _, err := modem.WritePacket(&Packet{Command: CmdGetInfo}); err != ErrClosed {
+		t.Errorf("Wanted error %v got %v", ErrClosed, err)
+	}
+
+	if err := modem.Close(); err != ErrClosed {
+		t.Errorf("Wanted error %v got %v", ErrClosed, err)
+	}
+}
+
+func TestSnoopClose(t *testing.T) {
+	rx, _ := io.Pipe()
+	tx, _ := io.Pipe()
+	s := Snoop(rx, tx)
+
+	errCh := make(chan error, 1)
+	go func() { _, err := s.Read(); errCh <- err }()
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := <-errCh; err != ErrClosed {
+		t.Errorf("Wanted error %v got %v", ErrClosed, err)
+	}
+
+	if err := s.Close(); err != ErrClosed {
+		t.Errorf("Wanted error %v got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,555 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plmtest provides an in-process emulation of an Insteon IM
+// that can be used with plm.New to test code without any hardware:
+//
+//	im := plmtest.New(plmtest.Links(links...))
+//	modem := plm.New(im)
+//	defer modem.Close()
+//
+// The emulated IM answers the commands needed to query the IM, walk and
+// manage its All-Link database and send Insteon messages.  Faults, such
+// as NAKs and dropped responses, can be injected for any command.
+//
+// Devices added with AddDevice share an emulated Insteon network with
+// the IM.  Messages on the network are delivered one at a time, each
+// taking as long to propagate as it would on a real network (see
+// TimeScale), and the IM takes part in linking sessions the same way
+// a real IM does
+package plmtest
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/plm"
+)
+
+const (
+	ack = 0x06
+	nak = 0x15
+)
+
+// Fault is an error condition the emulated IM can be told to produce
+type Fault int
+
+const (
+	// Nak causes the IM to NAK the command without acting on it
+	Nak Fault = iota + 1
+
+	// Timeout causes the IM to silently drop the command
+	Timeout
+
+	// ShiftPayload causes the payload in the ACK to be shifted over by
+	// one byte.  When adding a record with CmdManageAllLinkRecord the
+	// shifted (corrupted) record is what gets stored, which is the
+	// behavior linkdb.WriteLinks works around on real PLMs
+	ShiftPayload
+)
+
+// Device is a device on the emulated Insteon network.  Direct messages
+// sent to the device's address, as well as every broadcast message, are
+// passed to Receive and the returned messages are sent out on the
+// network.  Receive is called while the IM is locked and must not call
+// any methods on the IM
+type Device interface {
+	Address() insteon.Address
+	Receive(msg *insteon.Message) []*insteon.Message
+}
+
+// Option is used to configure an IM
+type Option func(im *IM)
+
+// Info sets the address, category and firmware version reported by the IM
+func Info(info plm.Info) Option {
+	return func(im *IM) {
+		im.info = info
+	}
+}
+
+// Config sets the initial IM configuration
+func Config(config plm.Config) Option {
+	return func(im *IM) {
+		im.config = config
+	}
+}
+
+// Links sets the initial contents of the IM All-Link database
+func Links(links ...insteon.LinkRecord) Option {
+	return func(im *IM) {
+		im.links = append([]insteon.LinkRecord{}, links...)
+	}
+}
+
+// Capacity sets the maximum number of records in the All-Link database.
+// The default is 1000
+func Capacity(capacity int) Option {
+	return func(im *IM) {
+		im.capacity = capacity
+	}
+}
+
+// TimeScale scales the time it takes messages to propagate across the
+// emulated Insteon network.  A scale of 1, the default, approximates
+// a real network while a scale of 0 delivers every message immediately.
+// The PLM should be given the same scale with plm.PacingScale
+func TimeScale(scale float64) Option {
+	return func(im *IM) {
+		im.scale = scale
+	}
+}
+
+// IM is an emulated Insteon IM.  It is an io.ReadWriteCloser that
+// answers every command written to it with the bytes a real IM would
+// send
+type IM struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	info     plm.Info
+	config   plm.Config
+	links    []insteon.LinkRecord
+	capacity int
+	cursor   int
+	devices  []Device
+	faults   map[plm.Command][]Fault
+	scale    float64
+	queue    []*insteon.Message
+	linking  linkState
+	answer   plm.Packet
+	sender   insteon.Address
+	sent     []*insteon.Message
+	commands []*plm.Packet
+	in       []byte
+	out      []byte
+	shift    bool
+	asleep   bool
+	closed   bool
+}
+
+// New returns an emulated IM
+func New(options ...Option) *IM {
+	im := &IM{
+		info: plm.Info{
+			Address:  insteon.Address(0x445566),
+			DevCat:   insteon.DevCat{0x03, 0x15},
+			Firmware: plm.Version(0x9e),
+		},
+		capacity: 1000,
+		faults:   make(map[plm.Command][]Fault),
+		scale:    1,
+	}
+	im.cond = sync.NewCond(&im.mu)
+
+	for _, o := range options {
+		o(im)
+	}
+	go im.run()
+	return im
+}
+
+// Address returns the address of the IM
+func (im *IM) Address() insteon.Address {
+	return im.info.Address
+}
+
+// AddDevice attaches a device to the emulated Insteon network
+func (im *IM) AddDevice(device Device) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.devices = append(im.devices, device)
+}
+
+// InjectFault queues faults for the given command.  Every time the
+// command is received the next fault is removed from the queue and
+// produced
+func (im *IM) InjectFault(cmd plm.Command, faults ...Fault) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.faults[cmd] = append(im.faults[cmd], faults...)
+}
+
+// Links returns a copy of the IM All-Link database
+func (im *IM) Links() []insteon.LinkRecord {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return append([]insteon.LinkRecord{}, im.links...)
+}
+
+// Config returns the current IM configuration
+func (im *IM) Config() plm.Config {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return im.config
+}
+
+// Sent returns every insteon message the IM has transmitted
+func (im *IM) Sent() []*insteon.Message {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return append([]*insteon.Message{}, im.sent...)
+}
+
+// Commands returns every command the IM has received from the host,
+// including those that were dropped due to an injected fault
+func (im *IM) Commands() []*plm.Packet {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return append([]*plm.Packet{}, im.commands...)
+}
+
+// Receive delivers a message to the host as if the IM had received it
+// from the Insteon network
+func (im *IM) Receive(msg *insteon.Message) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.sender = msg.Src
+	im.receive(msg)
+}
+
+func (im *IM) receive(msg *insteon.Message) {
+	buf, _ := msg.MarshalBinary()
+	cmd := plm.CmdStdMsgReceived
+	if msg.Flags.Extended() {
+		cmd = plm.CmdExtMsgReceived
+	}
+	im.send(append([]byte{0x02, byte(cmd)}, buf...))
+}
+
+// Transmit sends a message out on the emulated network as if a device
+// had sent it.  The IM, and every device, hears the message
+func (im *IM) Transmit(msg *insteon.Message) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.transmitMsg(msg)
+}
+
+// SendPacket delivers an arbitrary packet, such as an All-Link
+// completed or button event report, to the host
+func (im *IM) SendPacket(pkt *plm.Packet) {
+	buf, _ := pkt.MarshalBinary()
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.send(buf)
+}
+
+func (im *IM) send(buf []byte) {
+	im.out = append(im.out, buf...)
+	im.cond.Broadcast()
+}
+
+// Read returns the bytes sent by the IM to the host.  Read blocks
+// until data is available or the IM is closed
+func (im *IM) Read(buf []byte) (n int, err error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	for len(im.out) == 0 && !im.closed {
+		im.cond.Wait()
+	}
+
+	if len(im.out) == 0 {
+		return 0, io.EOF
+	}
+
+	n = copy(buf, im.out)
+	im.out = im.out[n:]
+	return n, nil
+}
+
+// Write sends commands from the host to the IM.  Commands may be
+// split across, or combined in, calls to Write.  Bytes outside of a
+// command are discarded, just as the IM would
+func (im *IM) Write(buf []byte) (n int, err error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if im.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	im.in = append(im.in, buf...)
+	for pkt := im.next(); pkt != nil; pkt = im.next() {
+		im.commands = append(im.commands, pkt)
+		im.process(pkt)
+	}
+	return len(buf), nil
+}
+
+// next removes the next complete command from the input buffer
+func (im *IM) next() *plm.Packet {
+	for {
+		i := bytes.IndexByte(im.in, 0x02)
+		if i < 0 {
+			im.in = im.in[:0]
+			return nil
+		}
+		im.in = im.in[i:]
+		if len(im.in) < 2 {
+			return nil
+		}
+
+		cmd := plm.Command(im.in[1])
+		paclen, found := plm.HostPayloadLen(cmd)
+		if !found {
+			im.in = im.in[1:]
+			continue
+		}
+
+		if cmd == plm.CmdSendInsteonMsg && len(im.in) > 5 && insteon.Flags(im.in[5]).Extended() {
+			paclen += 14
+		}
+
+		if len(im.in) < 2+paclen {
+			return nil
+		}
+
+		pkt := &plm.Packet{Command: cmd, Payload: append([]byte{}, im.in[2:2+paclen]...)}
+		im.in = im.in[2+paclen:]
+		return pkt
+	}
+}
+
+// Close causes any blocked and future reads to return io.EOF and
+// stops delivering messages on the emulated network
+func (im *IM) Close() error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.closed = true
+	im.cond.Broadcast()
+	return nil
+}
+
+func (im *IM) fault(cmd plm.Command) Fault {
+	faults := im.faults[cmd]
+	if len(faults) == 0 {
+		return 0
+	}
+	im.faults[cmd] = faults[1:]
+	return faults[0]
+}
+
+// shift moves the payload over by one byte, the first byte is repeated
+// and the last one is lost
+func shift(payload []byte) []byte {
+	if len(payload) == 0 {
+		return payload
+	}
+	return append(payload[:1:1], payload[:len(payload)-1]...)
+}
+
+// reply sends the command back to the host followed by the ack byte
+func (im *IM) reply(pkt *plm.Packet, payload []byte, ackByte byte) {
+	if im.shift {
+		payload = shift(payload)
+	}
+	buf := append([]byte{0x02, byte(pkt.Command)}, payload...)
+	im.send(append(buf, ackByte))
+}
+
+func (im *IM) process(pkt *plm.Packet) {
+	fault := im.fault(pkt.Command)
+	if fault == Nak {
+		im.reply(pkt, pkt.Payload, nak)
+		return
+	} else if fault == Timeout {
+		return
+	}
+
+	im.shift = fault == ShiftPayload
+	defer func() { im.shift = false }()
+
+	// the first command sent to a sleeping IM only wakes it
+	if im.asleep {
+		im.asleep = false
+		return
+	}
+
+	switch pkt.Command {
+	case plm.CmdGetInfo:
+		payload, _ := im.info.MarshalBinary()
+		im.reply(pkt, payload, ack)
+	case plm.CmdGetConfig:
+		im.reply(pkt, []byte{byte(im.config), 0x00, 0x00}, ack)
+	case plm.CmdSetConfig:
+		im.config = plm.Config(pkt.Payload[0])
+		im.reply(pkt, pkt.Payload, ack)
+	case plm.CmdReset:
+		im.links = nil
+		im.config = 0
+		im.answer = plm.Packet{}
+		im.reply(pkt, nil, ack)
+	case plm.CmdGetFirstAllLink:
+		im.cursor = 0
+		im.sendLink(pkt)
+	case plm.CmdGetNextAllLink:
+		im.cursor++
+		im.sendLink(pkt)
+	case plm.CmdManageAllLinkRecord:
+		im.manage(pkt)
+	case plm.CmdGetAllLinkForSender:
+		im.linkForSender(pkt)
+	case plm.CmdSendInsteonMsg:
+		im.transmit(pkt)
+	case plm.CmdStartAllLink:
+		im.reply(pkt, pkt.Payload, ack)
+		im.startLinking(pkt.Payload[0], insteon.Group(pkt.Payload[1]))
+	case plm.CmdSetHostCategory:
+		im.info.DevCat = insteon.DevCat{pkt.Payload[0], pkt.Payload[1]}
+		im.info.Firmware = plm.Version(pkt.Payload[2])
+		im.reply(pkt, pkt.Payload, ack)
+	case plm.CmdSetAckMsg, plm.CmdSetNameMsgTwoBytes, plm.CmdSetNakMsgByte:
+		im.answer = plm.Packet{Command: pkt.Command, Payload: pkt.Payload}
+		im.reply(pkt, pkt.Payload, ack)
+	case plm.CmdRfSleep:
+		im.reply(pkt, pkt.Payload, ack)
+		im.asleep = true
+	case plm.CmdCancelAllLink:
+		im.linking = linkState{}
+		im.reply(pkt, nil, ack)
+	default:
+		im.reply(pkt, pkt.Payload, ack)
+	}
+}
+
+// sendLink answers GetFirst/GetNext with the record at the cursor
+func (im *IM) sendLink(pkt *plm.Packet) {
+	if im.cursor >= len(im.links) {
+		im.reply(pkt, nil, nak)
+		return
+	}
+
+	im.reply(pkt, nil, ack)
+	buf, _ := im.links[im.cursor].MarshalBinary()
+	im.send(append([]byte{0x02, byte(plm.CmdAllLinkRecordResp)}, buf...))
+}
+
+// linkForSender answers with the first record for the sender of the
+// last message the IM received
+func (im *IM) linkForSender(pkt *plm.Packet) {
+	for _, link := range im.links {
+		if link.Address == im.sender && im.sender != insteon.Address(0) {
+			im.reply(pkt, nil, ack)
+			buf, _ := link.MarshalBinary()
+			im.send(append([]byte{0x02, byte(plm.CmdAllLinkRecordResp)}, buf...))
+			return
+		}
+	}
+	im.reply(pkt, nil, nak)
+}
+
+// find returns the index of the first record at or after start that
+// has the same type, group and address as link
+func (im *IM) find(start int, link *insteon.LinkRecord) int {
+	for i := start; i < len(im.links); i++ {
+		if im.links[i].Equal(link) {
+			return i
+		}
+	}
+	return -1
+}
+
+// match returns the index of the first record at or after start with
+// the group and address, whether it is a controller or responder record
+func (im *IM) match(start int, group insteon.Group, address insteon.Address) int {
+	for i := start; i < len(im.links); i++ {
+		if im.links[i].Group == group && im.links[i].Address == address {
+			return i
+		}
+	}
+	return -1
+}
+
+// addLink updates the data of a matching record or adds the link to
+// the end of the database.  False is returned if the database is full
+func (im *IM) addLink(link *insteon.LinkRecord) bool {
+	if i := im.find(0, link); i >= 0 {
+		im.links[i].Data = link.Data
+	} else if len(im.links) < im.capacity {
+		im.links = append(im.links, *link)
+	} else {
+		return false
+	}
+	return true
+}
+
+// deleteLink removes the first record with the link's group and
+// address, false is returned if no record matched.  Like a real IM, the
+// controller/responder flag is ignored, so this may not be the record
+// that was asked for
+func (im *IM) deleteLink(link *insteon.LinkRecord) bool {
+	if i := im.match(0, link.Group, link.Address); i >= 0 {
+		im.links = append(im.links[:i], im.links[i+1:]...)
+		return true
+	}
+	return false
+}
+
+func (im *IM) manage(pkt *plm.Packet) {
+	link := &insteon.LinkRecord{}
+	link.UnmarshalBinary(pkt.Payload[1:])
+
+	ackByte := byte(ack)
+	switch cmd := pkt.Payload[0]; cmd {
+	case byte(plm.LinkCmdFindFirst), byte(plm.LinkCmdFindNext):
+		start := 0
+		if cmd == byte(plm.LinkCmdFindNext) {
+			start = im.cursor + 1
+		}
+
+		if i := im.match(start, link.Group, link.Address); i >= 0 {
+			im.cursor = i
+			im.reply(pkt, pkt.Payload, ack)
+			buf, _ := im.links[i].MarshalBinary()
+			im.send(append([]byte{0x02, byte(plm.CmdAllLinkRecordResp)}, buf...))
+			return
+		}
+		ackByte = nak
+	case byte(plm.LinkCmdModFirst), byte(plm.LinkCmdModFirstCtrl), byte(plm.LinkCmdModFirstResp):
+		if cmd == byte(plm.LinkCmdModFirstCtrl) {
+			link.Flags.SetController()
+		} else if cmd == byte(plm.LinkCmdModFirstResp) {
+			link.Flags.SetResponder()
+		}
+
+		if im.shift {
+			// store the corrupted record that the ACK will show
+			link.UnmarshalBinary(shift(pkt.Payload))
+			im.links = append(im.links, *link)
+		} else if !im.addLink(link) {
+			ackByte = nak
+		}
+	case byte(plm.LinkCmdDeleteFirst):
+		if !im.deleteLink(link) {
+			ackByte = nak
+		}
+	default:
+		ackByte = nak
+	}
+	im.reply(pkt, pkt.Payload, ackByte)
+}
+
+// transmit sends an insteon message from the host out on the network
+func (im *IM) transmit(pkt *plm.Packet) {
+	msg := &insteon.Message{}
+	err := msg.UnmarshalBinary(append(im.info.Address.Bytes(), pkt.Payload...))
+	if err != nil {
+		im.reply(pkt, pkt.Payload, nak)
+		return
+	}
+
+	im.sent = append(im.sent, msg)
+	im.reply(pkt, pkt.Payload, ack)
+	im.transmitMsg(msg)
+}
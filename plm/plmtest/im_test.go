@@ -0,0 +1,682 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plmtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+	"github.com/abates/insteon/devices"
+	"github.com/abates/insteon/plm"
+)
+
+// ackDevice ACKs every direct message it receives
+type ackDevice insteon.Address
+
+func (ad ackDevice) Address() insteon.Address { return insteon.Address(ad) }
+
+func (ad ackDevice) Receive(msg *insteon.Message) []*insteon.Message {
+	if msg.Dst != insteon.Address(ad) {
+		return nil
+	}
+	return []*insteon.Message{{
+		Src:     insteon.Address(ad),
+		Dst:     msg.Src,
+		Flags:   insteon.StandardDirectAck,
+		Command: msg.Command,
+	}}
+}
+
+func TestIMInfoConfig(t *testing.T) {
+	info := plm.Info{Address: insteon.Address(0x0a0b0c), DevCat: insteon.DevCat{0x03, 0x20}, Firmware: 0x45}
+	im := New(Info(info), Config(plm.Config(0x40)))
+	modem := plm.New(im, plm.Timeout(time.Second))
+	defer modem.Close()
+
+	got, err := modem.Info()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if *got != info {
+		t.Errorf("Wanted info %v got %v", info, got)
+	}
+
+	config, err := modem.Config()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config != plm.Config(0x40) {
+		t.Errorf("Wanted config %v got %v", plm.Config(0x40), config)
+	}
+
+	err = modem.SetConfig(plm.Config(0x80))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if im.Config() != plm.Config(0x80) {
+		t.Errorf("Wanted config %v got %v", plm.Config(0x80), im.Config())
+	}
+}
+
+func TestIMSetDeviceCategory(t *testing.T) {
+	im := New()
+	modem := plm.New(im, plm.Timeout(50*time.Millisecond), plm.Retry(devices.RetryPolicy{MinBackoff: time.Millisecond}))
+	defer modem.Close()
+
+	before, err := modem.Info()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := modem.SetDeviceCategory(insteon.Category(0x20)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := modem.Info()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// only the sub-category changes
+	want := plm.Info{Address: before.Address, DevCat: insteon.DevCat{before.DevCat[0], 0x20}, Firmware: before.Firmware}
+	if *got != want {
+		t.Errorf("Wanted info %v got %v", want, got)
+	}
+}
+
+func TestIMHostCategoryAndSleep(t *testing.T) {
+	im := New()
+	modem := plm.New(im, plm.Timeout(50*time.Millisecond), plm.Retry(devices.RetryPolicy{MinBackoff: time.Millisecond}))
+	defer modem.Close()
+
+	if err := modem.SetDeviceCategoryContext(context.Background(), insteon.DevCat{0x01, 0x20}, 0x45); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := modem.RFSleep(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info, err := modem.Wake()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := plm.Info{Address: im.Address(), DevCat: insteon.DevCat{0x01, 0x20}, Firmware: 0x45}
+	if *info != want {
+		t.Errorf("Wanted info %v got %v", want, info)
+	}
+
+	// the first GetInfo only woke the IM
+	want2 := []plm.Command{plm.CmdSetHostCategory, plm.CmdRfSleep, plm.CmdGetInfo, plm.CmdGetInfo}
+	var got []plm.Command
+	for _, pkt := range im.Commands() {
+		got = append(got, pkt.Command)
+	}
+
+	if !reflect.DeepEqual(want2, got) {
+		t.Errorf("Wanted commands %v got %v", want2, got)
+	}
+}
+
+func TestIMLinks(t *testing.T) {
+	links := []insteon.LinkRecord{
+		insteon.ControllerLink(1, insteon.Address(0x010203)),
+		insteon.ResponderLink(1, insteon.Address(0x010203)),
+	}
+	newLinks := []insteon.LinkRecord{
+		insteon.ControllerLink(2, insteon.Address(0x040506)),
+		insteon.ResponderLink(3, insteon.Address(0x070809)),
+	}
+
+	im := New(Links(links...))
+	modem := plm.New(im, plm.Timeout(time.Second))
+	defer modem.Close()
+
+	got, err := modem.Links()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(links, got) {
+		t.Errorf("Wanted links %v got %v", links, got)
+	}
+
+	// the first record is corrupted when written and must be repaired,
+	// it is added after the two old records are deleted and verified
+	im.InjectFault(plm.CmdManageAllLinkRecord, 0, 0, 0, 0, 0, ShiftPayload)
+	err = modem.WriteLinks(newLinks...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(newLinks, im.Links()) {
+		t.Errorf("Wanted links %v got %v", newLinks, im.Links())
+	}
+}
+
+func TestIMRewriteLinks(t *testing.T) {
+	links := []insteon.LinkRecord{
+		insteon.ControllerLink(1, insteon.Address(0x010203)),
+		insteon.ResponderLink(1, insteon.Address(0x010203)),
+	}
+	newLinks := []insteon.LinkRecord{
+		insteon.ControllerLink(1, insteon.Address(0x010203)),
+		insteon.ControllerLink(2, insteon.Address(0x040506)),
+		insteon.ResponderLink(3, insteon.Address(0x070809)),
+	}
+
+	tests := []struct {
+		name         string
+		faults       []Fault
+		want         []insteon.LinkRecord
+		wantActions  []plm.LinkAction
+		wantChanged  int
+		wantRestored bool
+	}{
+		{"success", nil, newLinks, []plm.LinkAction{plm.LinkDeleted, plm.LinkSkipped, plm.LinkAdded, plm.LinkAdded}, 3, false},
+		// find the pair, the delete removes the controller so it is
+		// read back, the responder is deleted and read back, then the
+		// controller is restored. Find first and next verify the
+		// delete, add, find first and then the second add is NAK'd
+		{"rollback", []Fault{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, Nak}, links, []plm.LinkAction{plm.LinkDeleted, plm.LinkSkipped, plm.LinkAdded, plm.LinkAdded}, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			im := New(Links(links...))
+			modem := plm.New(im, plm.Timeout(time.Second), plm.Retry(devices.RetryPolicy{}))
+			defer modem.Close()
+
+			im.InjectFault(plm.CmdManageAllLinkRecord, test.faults...)
+			report, err := modem.RewriteLinks(context.Background(), newLinks...)
+			if test.wantRestored {
+				if !errors.Is(err, plm.ErrNak) {
+					t.Errorf("Wanted error %v got %v", plm.ErrNak, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(links, report.Snapshot) {
+				t.Errorf("Wanted snapshot %v got %v", links, report.Snapshot)
+			}
+
+			var gotActions []plm.LinkAction
+			for _, change := range report.Changes {
+				gotActions = append(gotActions, change.Action)
+			}
+
+			if !reflect.DeepEqual(test.wantActions, gotActions) {
+				t.Errorf("Wanted actions %v got %v", test.wantActions, gotActions)
+			}
+
+			if test.wantChanged != len(report.Changed()) {
+				t.Errorf("Wanted %d changes got %v", test.wantChanged, report.Changed())
+			}
+
+			if test.wantRestored != report.Restored {
+				t.Errorf("Wanted restored %v got %v", test.wantRestored, report.Restored)
+			}
+
+			if !reflect.DeepEqual(test.want, im.Links()) {
+				t.Errorf("Wanted links %v got %v", test.want, im.Links())
+			}
+
+			got, err := modem.Links()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted cached links %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestIMBackupRestore(t *testing.T) {
+	links := []insteon.LinkRecord{
+		insteon.ControllerLink(1, insteon.Address(0x010203)),
+		insteon.ResponderLink(1, insteon.Address(0x010203)),
+		insteon.ResponderLink(3, insteon.Address(0x070809)),
+	}
+
+	tests := []struct {
+		name         string
+		address      insteon.Address
+		links        []insteon.LinkRecord
+		wantReplaced bool
+	}{
+		{"same IM", insteon.Address(0x0a0b0c), links[1:2], false},
+		{"replacement IM", insteon.Address(0x0d0e0f), []insteon.LinkRecord{insteon.ControllerLink(2, insteon.Address(0x040506))}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := New(Info(plm.Info{Address: insteon.Address(0x0a0b0c)}), Config(plm.Config(0x40)), Links(links...))
+			modem := plm.New(src, plm.Timeout(time.Second))
+			defer modem.Close()
+
+			backup, err := modem.Backup()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			buf := &bytes.Buffer{}
+			if err := backup.Write(buf); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			backup, err = plm.ReadBackup(buf)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(links, backup.Links) {
+				t.Errorf("Wanted backup links %v got %v", links, backup.Links)
+			}
+
+			dst := New(Info(plm.Info{Address: test.address}), Links(test.links...))
+			modem = plm.New(dst, plm.Timeout(time.Second))
+			defer modem.Close()
+
+			result, err := modem.Restore(backup)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.Replaced != test.wantReplaced {
+				t.Errorf("Wanted replaced %v got %v", test.wantReplaced, result.Replaced)
+			}
+
+			if dst.Config() != plm.Config(0x40) {
+				t.Errorf("Wanted config %v got %v", plm.Config(0x40), dst.Config())
+			}
+
+			if len(dst.Links()) != len(links) {
+				t.Errorf("Wanted links %v got %v", links, dst.Links())
+			}
+
+			for _, link := range links {
+				found := false
+				for _, got := range dst.Links() {
+					found = found || got == link
+				}
+
+				if !found {
+					t.Errorf("Wanted link %v in %v", link, dst.Links())
+				}
+			}
+		})
+	}
+}
+
+func TestIMUpdateLinks(t *testing.T) {
+	withData := func(link insteon.LinkRecord, data ...byte) insteon.LinkRecord {
+		copy(link.Data[:], data)
+		return link
+	}
+
+	available := func(link insteon.LinkRecord) insteon.LinkRecord {
+		link.Flags.SetAvailable()
+		return link
+	}
+
+	links := []insteon.LinkRecord{
+		insteon.ControllerLink(1, insteon.Address(0x010203)),
+		withData(insteon.ResponderLink(1, insteon.Address(0x010203)), 0xff, 0x1c, 0x01),
+		insteon.ControllerLink(2, insteon.Address(0x040506)),
+	}
+
+	tests := []struct {
+		name      string
+		input     []insteon.LinkRecord
+		want      []insteon.LinkRecord
+		wantCmds  []byte
+		wantFault bool
+	}{
+		{"unchanged", []insteon.LinkRecord{links[0], links[1]}, links, nil, false},
+		{"add", []insteon.LinkRecord{links[0], insteon.ResponderLink(3, insteon.Address(0x070809))}, append(append([]insteon.LinkRecord{}, links...), insteon.ResponderLink(3, insteon.Address(0x070809))), []byte{byte(plm.LinkCmdModFirstResp)}, false},
+		{"update data", []insteon.LinkRecord{withData(links[1], 0x00, 0x1c, 0x01)}, []insteon.LinkRecord{links[0], withData(links[1], 0x00, 0x1c, 0x01), links[2]}, []byte{byte(plm.LinkCmdModFirstResp)}, false},
+		{"delete", []insteon.LinkRecord{available(links[2])}, links[0:2], []byte{byte(plm.LinkCmdFindFirst), byte(plm.LinkCmdFindNext), byte(plm.LinkCmdDeleteFirst), byte(plm.LinkCmdFindFirst)}, false},
+		{"delete first of pair", []insteon.LinkRecord{available(links[0])}, links[1:], []byte{byte(plm.LinkCmdFindFirst), byte(plm.LinkCmdFindNext), byte(plm.LinkCmdFindNext), byte(plm.LinkCmdDeleteFirst), byte(plm.LinkCmdFindFirst), byte(plm.LinkCmdFindNext)}, false},
+		{"delete second of pair", []insteon.LinkRecord{available(links[1])}, []insteon.LinkRecord{links[2], links[0]}, []byte{byte(plm.LinkCmdFindFirst), byte(plm.LinkCmdFindNext), byte(plm.LinkCmdFindNext), byte(plm.LinkCmdDeleteFirst), byte(plm.LinkCmdFindFirst), byte(plm.LinkCmdFindNext), byte(plm.LinkCmdDeleteFirst), byte(plm.LinkCmdFindFirst), byte(plm.LinkCmdModFirstCtrl)}, false},
+		{"delete missing", []insteon.LinkRecord{available(insteon.ControllerLink(9, insteon.Address(0x070809)))}, links, nil, false},
+		{"corrupted", []insteon.LinkRecord{insteon.ControllerLink(3, insteon.Address(0x070809))}, append(append([]insteon.LinkRecord{}, links...), insteon.ControllerLink(3, insteon.Address(0x070809))), []byte{byte(plm.LinkCmdModFirstCtrl), byte(plm.LinkCmdDeleteFirst), byte(plm.LinkCmdModFirstCtrl)}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			im := New(Links(links...))
+			modem := plm.New(im, plm.Timeout(time.Second))
+			defer modem.Close()
+
+			if test.wantFault {
+				im.InjectFault(plm.CmdManageAllLinkRecord, ShiftPayload)
+			}
+
+			if err := modem.UpdateLinks(test.input...); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(test.want, im.Links()) {
+				t.Errorf("Wanted links %v got %v", test.want, im.Links())
+			}
+
+			var gotCmds []byte
+			for _, pkt := range im.Commands() {
+				if pkt.Command == plm.CmdManageAllLinkRecord {
+					gotCmds = append(gotCmds, pkt.Payload[0])
+				}
+			}
+
+			if !bytes.Equal(test.wantCmds, gotCmds) {
+				t.Errorf("Wanted record commands %x got %x", test.wantCmds, gotCmds)
+			}
+		})
+	}
+}
+
+func TestIMUpdateLinksCancelled(t *testing.T) {
+	links := []insteon.LinkRecord{insteon.ControllerLink(1, insteon.Address(0x010203))}
+	im := New(Links(links...))
+	modem := plm.New(im, plm.Timeout(time.Second))
+	defer modem.Close()
+
+	// read the links first so that only the write is left to cancel
+	if _, err := modem.Links(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := modem.UpdateLinksContext(ctx, insteon.ResponderLink(3, insteon.Address(0x070809)))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Wanted error %v got %v", context.Canceled, err)
+	}
+
+	if !reflect.DeepEqual(links, im.Links()) {
+		t.Errorf("Wanted links %v got %v", links, im.Links())
+	}
+}
+
+func TestIMLinkCache(t *testing.T) {
+	links := []insteon.LinkRecord{insteon.ControllerLink(1, insteon.Address(0x010203))}
+	im := New(Links(links...))
+	modem := plm.New(im, plm.Timeout(time.Second))
+	defer modem.Close()
+
+	// reads counts the number of times the database has been read
+	reads := func() (n int) {
+		for _, pkt := range im.Commands() {
+			if pkt.Command == plm.CmdGetFirstAllLink {
+				n++
+			}
+		}
+		return n
+	}
+
+	link := insteon.ResponderLink(3, insteon.Address(0x070809))
+	if err := modem.UpdateLinks(link); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := modem.Links()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if want := append(links, link); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted links %v got %v", want, got)
+	}
+
+	if reads() != 1 {
+		t.Errorf("Wanted the database to be read once got %d", reads())
+	}
+
+	// a device linked with the SET button changes the database
+	im.SendPacket(&plm.Packet{Command: plm.CmdAllLinkComplete, Payload: []byte{0x01, 0x05, 0x04, 0x05, 0x06, 0x02, 0x20, 0x45}})
+	for i := 0; i < 100 && reads() == 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if _, err := modem.Links(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if reads() != 2 {
+		t.Errorf("Expected the database to be read again after a link was completed")
+	}
+}
+
+func TestIMFindLinks(t *testing.T) {
+	links := []insteon.LinkRecord{
+		insteon.ControllerLink(1, insteon.Address(0x010203)),
+		insteon.ControllerLink(2, insteon.Address(0x010203)),
+		insteon.ResponderLink(1, insteon.Address(0x010203)),
+		insteon.ResponderLink(1, insteon.Address(0x040506)),
+	}
+
+	tests := []struct {
+		name    string
+		group   insteon.Group
+		address insteon.Address
+		want    []insteon.LinkRecord
+	}{
+		{"controller and responder", 1, insteon.Address(0x010203), []insteon.LinkRecord{links[0], links[2]}},
+		{"one", 2, insteon.Address(0x010203), []insteon.LinkRecord{links[1]}},
+		{"none", 3, insteon.Address(0x010203), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			im := New(Links(links...))
+			modem := plm.New(im, plm.Timeout(time.Second))
+			defer modem.Close()
+
+			got, err := modem.FindLinks(test.group, test.address)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted links %v got %v", test.want, got)
+			}
+
+			link, err := modem.FindLink(test.group, test.address)
+			if len(test.want) == 0 {
+				if err != plm.ErrLinkNotFound {
+					t.Errorf("Wanted error %v got %v", plm.ErrLinkNotFound, err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if *link != test.want[0] {
+				t.Errorf("Wanted link %v got %v", test.want[0], link)
+			}
+
+			// neither lookup should walk the database
+			for _, pkt := range im.Commands() {
+				if pkt.Command == plm.CmdGetFirstAllLink || pkt.Command == plm.CmdGetNextAllLink {
+					t.Errorf("Unexpected command %v", pkt.Command)
+				}
+			}
+		})
+	}
+}
+
+func TestIMLinkForSender(t *testing.T) {
+	link := insteon.ResponderLink(1, insteon.Address(0x010203))
+	im := New(Links(link))
+	modem := plm.New(im, plm.Timeout(time.Second))
+	defer modem.Close()
+
+	if _, err := modem.LinkForSender(); err != plm.ErrLinkNotFound {
+		t.Errorf("Wanted error %v got %v", plm.ErrLinkNotFound, err)
+	}
+
+	im.Receive(&insteon.Message{Src: insteon.Address(0x010203), Dst: im.Address(), Flags: insteon.StandardDirectMessage, Command: commands.LightOn})
+	if _, err := modem.Read(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := modem.LinkForSender()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if *got != link {
+		t.Errorf("Wanted link %v got %v", link, got)
+	}
+}
+
+func TestIMFaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		fault   Fault
+		wantErr error
+	}{
+		{"none", 0, nil},
+		{"nak", Nak, plm.ErrNak},
+		{"timeout", Timeout, plm.ErrReadTimeout},
+		{"shifted payload", ShiftPayload, plm.ErrWrongPayload},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			im := New()
+			modem := plm.New(im, plm.Timeout(10*time.Millisecond))
+			defer modem.Close()
+
+			im.InjectFault(plm.CmdStartAllLink, test.fault)
+			_, err := modem.WritePacket(&plm.Packet{Command: plm.CmdStartAllLink, Payload: []byte{0x03, 0x01}})
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if len(im.Commands()) != 1 {
+				t.Errorf("Wanted 1 command got %d", len(im.Commands()))
+			}
+		})
+	}
+}
+
+func TestIMSendInsteonMsg(t *testing.T) {
+	im := New(TimeScale(0))
+	im.AddDevice(ackDevice(0x010203))
+	modem := plm.New(im, plm.Timeout(100*time.Millisecond))
+	defer modem.Close()
+
+	msg := &insteon.Message{Dst: insteon.Address(0x010203), Flags: insteon.StandardDirectMessage, Command: commands.LightOn}
+	ack, err := modem.Write(msg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !ack.Ack() || ack.Src != insteon.Address(0x010203) {
+		t.Errorf("Wanted ACK from 01.02.03 got %v", ack)
+	}
+
+	sent := im.Sent()
+	if len(sent) != 1 || sent[0].Src != im.Address() || sent[0].Command != commands.LightOn {
+		t.Errorf("Wanted LightOn from %v got %v", im.Address(), sent)
+	}
+
+	// nobody is listening at this address
+	msg.Dst = insteon.Address(0x040506)
+	_, err = modem.Write(msg)
+	if !errors.Is(err, insteon.ErrReadTimeout) {
+		t.Errorf("Wanted error %v got %v", insteon.ErrReadTimeout, err)
+	}
+}
+
+// recorder records the messages sent to it
+type recorder struct {
+	addr insteon.Address
+	ch   chan *insteon.Message
+}
+
+func (r *recorder) Address() insteon.Address { return r.addr }
+
+func (r *recorder) Receive(msg *insteon.Message) []*insteon.Message {
+	if msg.Dst == r.addr {
+		r.ch <- msg
+	}
+	return nil
+}
+
+func TestIMReply(t *testing.T) {
+	im := New(TimeScale(0))
+	device := &recorder{addr: insteon.Address(0x010203), ch: make(chan *insteon.Message, 1)}
+	im.AddDevice(device)
+	modem := plm.New(im, plm.Timeout(100*time.Millisecond))
+	defer modem.Close()
+
+	// the handler leaves the reply alone so that each test sets it
+	handled := make(chan *insteon.Message, 2)
+	sub := modem.HandleDirect(devices.CmdMatcher(commands.LightStatusRequest), func(msg *insteon.Message) plm.Reply {
+		handled <- msg
+		return plm.Reply{}
+	})
+	defer sub.Unsubscribe()
+
+	statusRequest := &insteon.Message{Src: device.addr, Dst: im.Address(), Flags: insteon.StandardDirectMessage, Command: commands.LightStatusRequest}
+	tests := []struct {
+		name  string
+		reply plm.Reply
+		want  *insteon.Message
+	}{
+		{"default", plm.Reply{}, &insteon.Message{Flags: insteon.StandardDirectAck, Command: commands.From(byte(insteon.StandardDirectAck), 0x19, 0x00)}},
+		{"ack cmd2", plm.AckCmd2(0x80), &insteon.Message{Flags: insteon.StandardDirectAck, Command: commands.From(byte(insteon.StandardDirectAck), 0x19, 0x80)}},
+		{"ack cmd", plm.AckCmd(0x11, 0xff), &insteon.Message{Flags: insteon.StandardDirectAck, Command: commands.From(byte(insteon.StandardDirectAck), 0x11, 0xff)}},
+		{"nak cmd2", plm.NakCmd2(0xfd), &insteon.Message{Flags: insteon.StandardDirectNak, Command: commands.From(byte(insteon.StandardDirectNak), 0x19, 0xfd)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := modem.SetReply(test.reply); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			im.Transmit(statusRequest)
+			select {
+			case got := <-device.ch:
+				test.want.Src, test.want.Dst = im.Address(), device.addr
+				if !got.Equals(test.want) {
+					t.Errorf("Wanted %v got %v", test.want, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Timed out waiting for the IM to answer")
+			}
+
+			select {
+			case got := <-handled:
+				if got.Src != device.addr || got.Command.Command1() != commands.LightStatusRequest.Command1() {
+					t.Errorf("Wanted status request from %v got %v", device.addr, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Timed out waiting for the handler")
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plmtest
+
+import (
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+	"github.com/abates/insteon/plm"
+)
+
+// LinkingTimeout is how long a set button pressed controller broadcast
+// is remembered.  Anything entering linking mode within that time,
+// after hearing the broadcast, becomes the responder in the linking
+// session
+var LinkingTimeout = 4 * time.Minute
+
+// All-Link codes used by CmdStartAllLink and the All-Link complete
+// report
+const (
+	linkResponder  = 0x00
+	linkController = 0x01
+	linkEither     = 0x03
+	linkDelete     = 0xff
+)
+
+// linkState tracks the IM's part in a linking session
+type linkState struct {
+	active    bool
+	code      byte
+	group     insteon.Group
+	responder bool
+	heard     insteon.Address
+	heardAt   time.Time
+}
+
+// heardController indicates if another device recently started a
+// linking session as the controller
+func (ls *linkState) heardController() bool {
+	return ls.heard != insteon.Address(0) && time.Since(ls.heardAt) < LinkingTimeout
+}
+
+// run delivers messages on the emulated network until the IM is closed
+func (im *IM) run() {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	for {
+		for len(im.queue) == 0 && !im.closed {
+			im.cond.Wait()
+		}
+
+		if im.closed {
+			return
+		}
+
+		msg := im.queue[0]
+		im.queue = im.queue[1:]
+		if delay := im.delay(msg); delay > 0 {
+			im.mu.Unlock()
+			time.Sleep(delay)
+			im.mu.Lock()
+			if im.closed {
+				return
+			}
+		}
+		im.route(msg)
+	}
+}
+
+// delay is how long the message takes to propagate across the network
+func (im *IM) delay(msg *insteon.Message) time.Duration {
+	buf, _ := msg.MarshalBinary()
+	return time.Duration(float64(insteon.PropagationDelay(msg.MaxTTL(), len(buf))) * im.scale)
+}
+
+// transmitMsg queues a message to be sent out on the network
+func (im *IM) transmitMsg(msg *insteon.Message) {
+	im.queue = append(im.queue, msg)
+	im.cond.Broadcast()
+}
+
+// route delivers a message to the IM and every device that would
+// receive it.  Messages addressed to other devices are only passed on
+// to the host when the IM is in monitor mode
+func (im *IM) route(msg *insteon.Message) {
+	broadcast := msg.Type().Broadcast()
+	if msg.Src != im.info.Address {
+		if broadcast || msg.Dst == im.info.Address {
+			im.sender = msg.Src
+			im.hear(msg)
+			im.receive(msg)
+		} else if im.config.MonitorMode() {
+			im.receive(msg)
+		}
+	}
+
+	for _, device := range im.devices {
+		if device.Address() != msg.Src && (broadcast || msg.Dst == device.Address()) {
+			for _, response := range device.Receive(msg) {
+				im.transmitMsg(response)
+			}
+		}
+	}
+}
+
+// hear acknowledges direct messages sent to the IM and carries out the
+// IM's part of any linking session
+func (im *IM) hear(msg *insteon.Message) {
+	cmd1 := msg.Command.Command1()
+	switch msg.Type() {
+	case insteon.MsgTypeBroadcast:
+		if cmd1 == commands.SetButtonPressedController.Command1() {
+			if im.linking.active && im.linking.code == linkResponder && !im.linking.responder {
+				im.linking.responder = true
+				im.broadcast(commands.SetButtonPressedResponder)
+			} else {
+				im.linking.heard, im.linking.heardAt = msg.Src, time.Now()
+			}
+		} else if cmd1 == commands.SetButtonPressedResponder.Command1() {
+			im.linking.heard = insteon.Address(0)
+			if im.linking.active && !im.linking.responder && im.linking.code != linkResponder {
+				link := insteon.ControllerLink(im.linking.group, msg.Src)
+				link.Data = [3]byte{byte(msg.Dst >> 16), byte(msg.Dst >> 8), byte(msg.Dst)}
+				if im.linking.code == linkDelete {
+					im.deleteLink(&link)
+					im.transmitMsg(im.direct(msg.Src, commands.DeleteFromAllLinkGroup.SubCommand(int(link.Group))))
+					im.complete(linkDelete, link)
+				} else {
+					im.addLink(&link)
+					im.transmitMsg(im.direct(msg.Src, commands.AssignToAllLinkGroup.SubCommand(int(link.Group))))
+					im.complete(linkController, link)
+				}
+			}
+		}
+	case insteon.MsgTypeDirect:
+		im.transmitMsg(im.ack(msg))
+		if im.linking.active && im.linking.responder {
+			link := insteon.ResponderLink(insteon.Group(msg.Command.Command2()), msg.Src)
+			if cmd1 == commands.AssignToAllLinkGroup.Command1() {
+				im.addLink(&link)
+				im.complete(linkResponder, link)
+			} else if cmd1 == commands.DeleteFromAllLinkGroup.Command1() {
+				im.deleteLink(&link)
+				im.complete(linkDelete, link)
+			}
+		}
+	}
+}
+
+// startLinking puts the IM into linking mode.  If a controller is
+// already waiting, the IM becomes the responder, otherwise it starts a
+// new linking session as the controller
+func (im *IM) startLinking(code byte, group insteon.Group) {
+	im.linking.active, im.linking.code, im.linking.group, im.linking.responder = true, code, group, false
+	if (code == linkResponder || code == linkEither) && im.linking.heardController() {
+		im.linking.responder = true
+		im.linking.heard = insteon.Address(0)
+		im.broadcast(commands.SetButtonPressedResponder)
+	} else if code != linkResponder {
+		im.broadcast(commands.SetButtonPressedController)
+	}
+}
+
+// complete reports a finished linking session to the host and takes
+// the IM out of linking mode
+func (im *IM) complete(code byte, link insteon.LinkRecord) {
+	im.linking.active = false
+	buf := append([]byte{0x02, byte(plm.CmdAllLinkComplete), code, byte(link.Group)}, link.Address.Bytes()...)
+	im.send(append(buf, link.Data[:]...))
+}
+
+func (im *IM) broadcast(cmd commands.Command) {
+	dst := insteon.Address(uint32(im.info.DevCat[0])<<16 | uint32(im.info.DevCat[1])<<8 | uint32(im.info.Firmware))
+	im.transmitMsg(&insteon.Message{
+		Src:     im.info.Address,
+		Dst:     dst,
+		Flags:   insteon.StandardBroadcast,
+		Command: commands.From(byte(insteon.StandardBroadcast), byte(cmd.Command1()), byte(cmd.Command2())),
+	})
+}
+
+func (im *IM) direct(dst insteon.Address, cmd commands.Command) *insteon.Message {
+	return &insteon.Message{
+		Src:     im.info.Address,
+		Dst:     dst,
+		Flags:   insteon.StandardDirectMessage,
+		Command: commands.From(byte(insteon.StandardDirectMessage), byte(cmd.Command1()), byte(cmd.Command2())),
+	}
+}
+
+// ack answers a direct message with the answer set by the host, or an
+// ACK echoing the command if no answer was set
+func (im *IM) ack(msg *insteon.Message) *insteon.Message {
+	flags := insteon.StandardDirectAck
+	cmd1, cmd2 := byte(msg.Command.Command1()), byte(msg.Command.Command2())
+	switch im.answer.Command {
+	case plm.CmdSetAckMsg:
+		cmd2 = im.answer.Payload[0]
+	case plm.CmdSetNameMsgTwoBytes:
+		cmd1, cmd2 = im.answer.Payload[0], im.answer.Payload[1]
+	case plm.CmdSetNakMsgByte:
+		flags, cmd2 = insteon.StandardDirectNak, im.answer.Payload[0]
+	}
+
+	return &insteon.Message{
+		Src:     im.info.Address,
+		Dst:     msg.Src,
+		Flags:   flags,
+		Command: commands.From(byte(flags), cmd1, cmd2),
+	}
+}
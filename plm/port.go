@@ -16,90 +16,137 @@ package plm
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/abates/insteon"
+	"github.com/abates/insteon/devices"
 )
 
 type packetWriter interface {
-	ReadPacket() (*Packet, error)
-	WritePacket(*Packet) (ack *Packet, err error)
+	ReadPacketContext(ctx context.Context) (*Packet, error)
+	WritePacketContext(ctx context.Context, pkt *Packet) (ack *Packet, err error)
 }
 
-type delayWriter struct {
-	packetWriter
-	lastTTL  uint8
-	lastLen  int
+// pacer spaces out transmissions so that a new message isn't sent while
+// an earlier message, or its retransmissions, is still travelling
+// through the network.  Every message the IM sends or receives pushes
+// back the time the network is expected to be quiet
+type pacer struct {
 	minDelay time.Duration
-	lastRead time.Time
-	lastPkt  *Packet
+	scale    float64
+	report   func(pkt *Packet, delay time.Duration)
+
+	mu      sync.Mutex
+	quietAt time.Time
 }
 
-func (dw *delayWriter) ReadPacket() (*Packet, error) {
-	pkt, err := dw.packetWriter.ReadPacket()
-	if err == nil {
-		dw.lastRead = time.Now()
-		dw.lastLen = len(pkt.Payload)
-		if pkt.Command == CmdStdMsgReceived || pkt.Command == CmdExtMsgReceived {
-			dw.lastTTL = uint8(pkt.Payload[6] & 0x03)
-		} else if pkt.Command == CmdStartAllLink {
-			dw.lastTTL = 3
-		}
+// transmits indicates if the IM sends an insteon message on the network
+// in response to the command
+func transmits(cmd Command) bool {
+	return cmd == CmdSendInsteonMsg || cmd == CmdSendAllLink || cmd == CmdStartAllLink || cmd == CmdSendX10
+}
+
+// busy records a message of the given length that keeps the network
+// busy for the next number of hops.  When the message is an ACK the
+// acknowledged message has already finished travelling through the
+// network, so only the ACK itself is waited for
+func (p *pacer) busy(hops int, length int, ack bool) {
+	p.busyFor(time.Duration(hops)*insteon.PropagationDelay(0, length), ack)
+}
+
+// busyFor records traffic that keeps the network busy for the given
+// duration.  If replace is true the duration replaces any time that
+// the network was already expected to be busy
+func (p *pacer) busyFor(d time.Duration, replace bool) {
+	quietAt := time.Now().Add(time.Duration(float64(d) * p.scale))
+	p.mu.Lock()
+	if replace || quietAt.After(p.quietAt) {
+		p.quietAt = quietAt
 	}
-	return pkt, err
+	p.mu.Unlock()
 }
 
-func (dw *delayWriter) writeDelay(pkt *Packet) (delay time.Duration) {
-	if dw.lastPkt == nil {
-		return 0
+// received records an insteon message received by the IM, the message
+// is still being repeated if it has any hops left
+func (p *pacer) received(msg *insteon.Message, length int) {
+	p.busy(int(msg.Flags.TTL()), length, msg.Ack() || msg.Nak())
+}
+
+// sent records a packet that the IM has accepted for transmission
+func (p *pacer) sent(pkt *Packet) {
+	switch pkt.Command {
+	case CmdSendInsteonMsg:
+		// the message is sent once and then repeated up to the
+		// maximum hops, the IM adds its own address to it
+		p.busy(int(insteon.Flags(pkt.Payload[3]).MaxTTL())+1, len(pkt.Payload)+3, false)
+	case CmdSendAllLink, CmdStartAllLink:
+		// these are sent as standard broadcasts with the maximum hops
+		p.busy(4, commandLens[CmdStdMsgReceived], false)
+	case CmdSendX10:
+		p.busyFor(x10Delay, false)
 	}
+}
 
-	if dw.lastPkt.Command == CmdSendInsteonMsg || dw.lastPkt.Command == CmdStartAllLink {
-		delay = insteon.PropagationDelay(dw.lastTTL, dw.lastLen)
-		delay = time.Now().Sub(dw.lastRead.Add(delay))
-		delay = time.Now().Sub(dw.lastRead.Add(delay))
+// delay returns how long to wait before sending the packet.  Commands
+// that aren't transmitted on the network are never delayed
+func (p *pacer) delay(pkt *Packet) time.Duration {
+	if !transmits(pkt.Command) {
+		return 0
 	}
 
-	if delay < dw.minDelay {
-		delay = dw.minDelay
+	p.mu.Lock()
+	delay := time.Until(p.quietAt)
+	p.mu.Unlock()
+
+	if delay < p.minDelay {
+		delay = p.minDelay
 	}
 	return delay
 }
 
-func (dw *delayWriter) Write(pkt *Packet) (ack *Packet, err error) {
-	delay := dw.writeDelay(pkt)
-	LogDebug.Printf("Write delay %v)", delay)
-	time.Sleep(delay)
-
-	dw.lastPkt = pkt
-	return dw.packetWriter.WritePacket(pkt)
+// wait pauses until the packet can be sent without colliding with
+// earlier messages
+func (p *pacer) wait(ctx context.Context, pkt *Packet) error {
+	delay := p.delay(pkt)
+	if transmits(pkt.Command) {
+		LogDebug.Printf("Write delay %v", delay)
+		if p.report != nil {
+			p.report(pkt, delay)
+		}
+	}
+	return devices.Sleep(ctx, delay)
 }
 
 type retryWriter struct {
 	packetWriter
-	retries   int
+	policy    devices.RetryPolicy
 	ignoreNak bool
 }
 
 func (rw *retryWriter) WritePacket(packet *Packet) (ack *Packet, err error) {
-	retries := rw.retries
-	for 0 <= retries {
-		ack, err = rw.packetWriter.WritePacket(packet)
-		if (err == ErrNak && rw.ignoreNak) || err == ErrReadTimeout {
-			// TODO add exponential backoff
-			LogDebug.Printf("Got %v retrying", err)
-			time.Sleep(time.Second)
-			retries--
-		} else {
-			break
-		}
-	}
-	return
+	return rw.WritePacketContext(context.Background(), packet)
+}
+
+func (rw *retryWriter) WritePacketContext(ctx context.Context, packet *Packet) (ack *Packet, err error) {
+	err = rw.policy.Do(ctx, insteon.Address(0), 0, rw.retryable, func() (err error) {
+		ack, err = rw.packetWriter.WritePacketContext(ctx, packet)
+		return err
+	})
+	return ack, err
+}
+
+// retryable indicates if the IM didn't respond in time or, when NAKs
+// are being ignored, if the IM wasn't ready for the command
+func (rw *retryWriter) retryable(err error) bool {
+	return (errors.Is(err, ErrNak) && rw.ignoreNak) || errors.Is(err, ErrReadTimeout)
 }
 
-func retry(writer packetWriter, retries int, ignoreNak bool) packetWriter {
-	return &retryWriter{writer, retries, ignoreNak}
+func retry(writer packetWriter, policy devices.RetryPolicy, ignoreNak bool) *retryWriter {
+	return &retryWriter{writer, policy, ignoreNak}
 }
 
 type logReader struct {
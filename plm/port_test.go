@@ -2,11 +2,17 @@ package plm
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/devices"
 )
 
 type ErrWriter struct {
@@ -110,3 +116,83 @@ func TestPacketReaderRead(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryWriter(t *testing.T) {
+	ack := &Packet{Command: CmdGetInfo, Ack: 0x06}
+	nak := &Packet{Command: CmdGetInfo, Ack: 0x15}
+	tests := []struct {
+		name      string
+		acks      []*Packet
+		txErr     error
+		ignoreNak bool
+		wantTx    int
+		wantErr   error
+	}{
+		{"ack", []*Packet{ack}, nil, true, 1, nil},
+		{"nak then ack", []*Packet{nak, ack}, nil, true, 2, nil},
+		{"nak not ignored", []*Packet{nak, ack}, nil, false, 1, ErrNak},
+		{"retries exceeded", []*Packet{nak, nak, nak}, nil, true, 3, ErrNak},
+		{"timeout", nil, fmt.Errorf("PLM ACK %w", ErrReadTimeout), false, 3, ErrReadTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			retries := 0
+			policy := devices.RetryPolicy{Retries: 2, OnRetry: func(devices.RetryEvent) { retries++ }}
+			modem := &testModem{ack: test.acks, txErr: test.txErr}
+			_, err := retry(modem, policy, test.ignoreNak).WritePacket(&Packet{Command: CmdGetInfo})
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if len(modem.tx) != test.wantTx {
+				t.Errorf("Wanted %d writes got %d", test.wantTx, len(modem.tx))
+			}
+
+			if retries != test.wantTx-1 {
+				t.Errorf("Wanted %d retries reported got %d", test.wantTx-1, retries)
+			}
+		})
+	}
+}
+
+func TestPacerDelay(t *testing.T) {
+	slot := insteon.PropagationDelay(0, 9)
+	sendMsg := &Packet{Command: CmdSendInsteonMsg, Payload: []byte{1, 2, 3, byte(insteon.StandardDirectMessage), 0x11, 0xff}}
+	ack := &insteon.Message{Flags: insteon.Flag(insteon.MsgTypeDirectAck, false, 1, 3)}
+	broadcast := &insteon.Message{Flags: insteon.Flag(insteon.MsgTypeBroadcast, false, 2, 3)}
+	tests := []struct {
+		name     string
+		minDelay time.Duration
+		sent     *Packet
+		received []*insteon.Message
+		pkt      *Packet
+		want     time.Duration
+	}{
+		{"quiet network", 0, nil, nil, sendMsg, 0},
+		{"minimum delay", 100 * time.Millisecond, nil, nil, sendMsg, 100 * time.Millisecond},
+		{"not transmitted", 100 * time.Millisecond, sendMsg, nil, &Packet{Command: CmdGetInfo}, 0},
+		{"sent message", 0, sendMsg, nil, sendMsg, 3 * slot},
+		{"received message", 0, nil, []*insteon.Message{broadcast}, sendMsg, 2 * slot},
+		{"acknowledged", 0, sendMsg, []*insteon.Message{ack}, sendMsg, slot},
+		{"ack then broadcast", 0, sendMsg, []*insteon.Message{ack, broadcast}, sendMsg, 2 * slot},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &pacer{minDelay: test.minDelay, scale: 1}
+			if test.sent != nil {
+				p.sent(test.sent)
+			}
+
+			for _, msg := range test.received {
+				p.received(msg, 9)
+			}
+
+			got := p.delay(test.pkt)
+			if got > test.want || got < test.want-50*time.Millisecond {
+				t.Errorf("Wanted delay of about %v got %v", test.want, got)
+			}
+		})
+	}
+}
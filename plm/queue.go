@@ -0,0 +1,284 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/abates/insteon"
+)
+
+// Priority determines the order in which queued insteon messages are
+// sent.  Messages with a higher priority are always sent before those
+// with a lower priority
+type Priority int
+
+const (
+	// Background is for bulk work, such as walking a device's
+	// All-Link database or polling for status
+	Background Priority = iota
+
+	// Normal is the priority of messages written without one
+	Normal
+
+	// Interactive is for messages that someone is waiting on, such
+	// as turning on a light
+	Interactive
+)
+
+func (p Priority) String() string {
+	switch p {
+	case Background:
+		return "Background"
+	case Normal:
+		return "Normal"
+	case Interactive:
+		return "Interactive"
+	}
+	return "Unknown"
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of the context that causes messages
+// written with it (see PLM.WriteContext) to be sent at the given
+// priority
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// priority returns the priority stored in the context, or Normal
+func priority(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && Background <= p && p <= Interactive {
+		return p
+	}
+	return Normal
+}
+
+// request is a queued message and everyone waiting on it.  More than
+// one writer waits on a request when newer messages are coalesced into
+// it
+type request struct {
+	msg      *insteon.Message
+	priority Priority
+	waiters  int
+	started  bool          // the request has been given its turn
+	claimed  bool          // a waiter has taken the message to send it
+	ready    chan struct{} // closed when the request is given its turn
+	released chan struct{} // closed when the claimant gives up sending
+	done     chan struct{} // closed once the ACK (or error) is known
+	ack      *insteon.Message
+	err      error
+}
+
+// class is the queue for a single priority.  Destinations take turns so
+// that a long run of messages to one device doesn't hold up the others
+type class struct {
+	order   []insteon.Address
+	pending map[insteon.Address][]*request
+}
+
+func (c *class) push(r *request) {
+	if c.pending == nil {
+		c.pending = make(map[insteon.Address][]*request)
+	}
+
+	if _, found := c.pending[r.msg.Dst]; !found {
+		c.order = append(c.order, r.msg.Dst)
+	}
+	c.pending[r.msg.Dst] = append(c.pending[r.msg.Dst], r)
+}
+
+// pop removes the next request for the destination whose turn it is
+func (c *class) pop() *request {
+	if len(c.order) == 0 {
+		return nil
+	}
+
+	dst := c.order[0]
+	c.order = c.order[1:]
+	reqs := c.pending[dst]
+	if len(reqs) > 1 {
+		c.pending[dst] = reqs[1:]
+		c.order = append(c.order, dst)
+	} else {
+		delete(c.pending, dst)
+	}
+	return reqs[0]
+}
+
+func (c *class) remove(r *request) {
+	dst := r.msg.Dst
+	reqs := c.pending[dst]
+	for i, req := range reqs {
+		if req == r {
+			reqs = append(reqs[:i], reqs[i+1:]...)
+			break
+		}
+	}
+
+	if len(reqs) > 0 {
+		c.pending[dst] = reqs
+		return
+	}
+
+	delete(c.pending, dst)
+	for i, addr := range c.order {
+		if addr == dst {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// sendQueue holds insteon messages waiting to be sent.  Only one message
+// is sent at a time, the rest wait their turn by priority and then by
+// destination
+type sendQueue struct {
+	mu       sync.Mutex
+	busy     bool
+	coalesce map[int]bool
+	classes  [Interactive + 1]class
+}
+
+// coalesces indicates if msg can replace the queued message r.  Group
+// commands are never coalesced since each caller waits for its own
+// cleanup results
+func (q *sendQueue) coalesces(r *request, msg *insteon.Message) bool {
+	return !r.started && msg.Type() != insteon.MsgTypeAllLinkBroadcast && q.coalesce[msg.Command.Command1()] &&
+		r.msg.Command.Command1() == msg.Command.Command1() &&
+		r.msg.Command.Command2() == msg.Command.Command2() &&
+		r.msg.Flags.Extended() == msg.Flags.Extended()
+}
+
+// push queues the message.  If an equivalent message is already waiting
+// to be sent, and the command is coalesced, the newer message replaces
+// it and the returned request is shared
+func (q *sendQueue) push(msg *insteon.Message, priority Priority) *request {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c := &q.classes[priority]
+	for _, r := range c.pending[msg.Dst] {
+		if q.coalesces(r, msg) {
+			LogDebug.Printf("Replacing queued message %v with %v", r.msg, msg)
+			r.msg = msg
+			r.waiters++
+			return r
+		}
+	}
+
+	r := &request{msg: msg, priority: priority, waiters: 1, ready: make(chan struct{}), released: make(chan struct{}), done: make(chan struct{})}
+	c.push(r)
+	if !q.busy {
+		q.next()
+	}
+	return r
+}
+
+// next gives the next queued request its turn, q.mu must be held
+func (q *sendQueue) next() {
+	q.busy = false
+	for p := Interactive; p >= Background; p-- {
+		if r := q.classes[p].pop(); r != nil {
+			q.busy = true
+			r.started = true
+			close(r.ready)
+			return
+		}
+	}
+}
+
+// wait blocks until it is the request's turn.  The first waiter gets the
+// message and must send it, and then call finish (or release).  Everyone
+// else gets a nil message once the result is known, unless the message
+// is released in which case the next waiter gets it
+func (q *sendQueue) wait(ctx context.Context, r *request) (*insteon.Message, error) {
+	select {
+	case <-r.ready:
+	case <-ctx.Done():
+		q.leave(r)
+		return nil, ctx.Err()
+	}
+
+	for {
+		q.mu.Lock()
+		if !r.claimed {
+			r.claimed = true
+			q.mu.Unlock()
+			return r.msg, nil
+		}
+		released := r.released
+		q.mu.Unlock()
+
+		select {
+		case <-r.done:
+			return nil, nil
+		case <-released:
+		case <-ctx.Done():
+			q.leave(r)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// leave is called when a waiter gives up before the request's turn.
+// When nobody is left waiting the request is dropped from the queue, or
+// its turn is passed on if it already has it
+func (q *sendQueue) leave(r *request) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	r.waiters--
+	if r.waiters > 0 || r.claimed {
+		return
+	}
+
+	if r.started {
+		r.claimed = true
+		q.next()
+	} else {
+		q.classes[r.priority].remove(r)
+	}
+}
+
+// release is called when the waiter sending the request's message gives
+// up because its context is done.  The other waiters didn't give up, so
+// one of them takes over and sends the message.  If nobody else is
+// waiting then the result is final
+func (q *sendQueue) release(r *request, ack *insteon.Message, err error) {
+	q.mu.Lock()
+	r.waiters--
+	if r.waiters > 0 {
+		r.claimed = false
+		close(r.released)
+		r.released = make(chan struct{})
+		q.mu.Unlock()
+		return
+	}
+	q.mu.Unlock()
+	q.finish(r, ack, err)
+}
+
+// finish records the result of sending the request's message and gives
+// the next request its turn
+func (q *sendQueue) finish(r *request, ack *insteon.Message, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r.ack, r.err = ack, err
+	close(r.done)
+	q.next()
+}
@@ -0,0 +1,189 @@
+package plm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/commands"
+)
+
+func queueMsg(dst insteon.Address, cmd commands.Command) *insteon.Message {
+	return &insteon.Message{Dst: dst, Flags: insteon.StandardDirectMessage, Command: cmd}
+}
+
+// nextStarted finishes the current request and returns the one given
+// the next turn
+func nextStarted(q *sendQueue, current *request, reqs []*request) *request {
+	q.finish(current, nil, nil)
+	for _, r := range reqs {
+		select {
+		case <-r.done:
+		default:
+			if r.started {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+func TestSendQueueOrder(t *testing.T) {
+	q := &sendQueue{}
+	current := q.push(queueMsg(1, commands.LightOn), Normal)
+	if !current.started {
+		t.Fatalf("Expected the first request to start immediately")
+	}
+
+	reqs := []*request{
+		q.push(queueMsg(2, commands.LightOn), Background),
+		q.push(queueMsg(3, commands.LightOn), Normal),
+		q.push(queueMsg(3, commands.LightOff), Normal),
+		q.push(queueMsg(4, commands.LightOn), Interactive),
+		q.push(queueMsg(5, commands.LightOn), Normal),
+	}
+
+	// interactive first, then normal taking turns between destinations
+	want := []*request{reqs[3], reqs[1], reqs[4], reqs[2], reqs[0]}
+	for i, w := range want {
+		current = nextStarted(q, current, reqs)
+		if current != w {
+			t.Fatalf("Turn %d: wanted %v got %v", i, w.msg, current)
+		}
+	}
+
+	if nextStarted(q, current, reqs) != nil || q.busy {
+		t.Errorf("Expected the queue to be empty")
+	}
+}
+
+func TestSendQueueCoalesce(t *testing.T) {
+	q := &sendQueue{coalesce: map[int]bool{commands.LightStatusRequest.Command1(): true}}
+	current := q.push(queueMsg(1, commands.LightOn), Normal)
+
+	status1 := q.push(queueMsg(2, commands.LightStatusRequest), Normal)
+	status2 := q.push(queueMsg(2, commands.LightStatusRequest), Normal)
+	on1 := q.push(queueMsg(2, commands.LightOn), Normal)
+	on2 := q.push(queueMsg(2, commands.LightOn), Normal)
+
+	if status1 != status2 || status1.waiters != 2 {
+		t.Errorf("Expected status requests to be coalesced")
+	}
+
+	if on1 == on2 {
+		t.Errorf("Expected commands that aren't coalesced to be queued separately")
+	}
+
+	if next := nextStarted(q, current, []*request{status1, on1, on2}); next != status1 {
+		t.Fatalf("Expected the status request to be next")
+	}
+
+	if status3 := q.push(queueMsg(2, commands.LightStatusRequest), Normal); status3 == status1 {
+		t.Errorf("Expected a request that has started not to be coalesced")
+	}
+}
+
+func TestSendQueueWait(t *testing.T) {
+	q := &sendQueue{coalesce: map[int]bool{commands.LightStatusRequest.Command1(): true}}
+	current := q.push(queueMsg(1, commands.LightOn), Normal)
+	if msg, err := q.wait(context.Background(), current); msg == nil || err != nil {
+		t.Fatalf("Expected the first waiter to get the message, got %v %v", msg, err)
+	}
+
+	// a cancelled waiter is removed from the queue
+	cancelled := q.push(queueMsg(2, commands.LightOn), Normal)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.wait(ctx, cancelled); err != context.Canceled {
+		t.Errorf("Wanted error %v got %v", context.Canceled, err)
+	}
+
+	// coalesced waiters share the result
+	status := q.push(queueMsg(3, commands.LightStatusRequest), Normal)
+	q.push(queueMsg(3, commands.LightStatusRequest), Normal)
+	if next := nextStarted(q, current, []*request{cancelled, status}); next != status {
+		t.Fatalf("Expected the cancelled request to be skipped")
+	}
+
+	results := make(chan *insteon.Message, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			msg, _ := q.wait(context.Background(), status)
+			if msg != nil {
+				q.finish(status, &insteon.Message{Src: 3}, nil)
+			}
+			<-status.done
+			results <- status.ack
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		if ack := <-results; ack == nil || ack.Src != 3 {
+			t.Errorf("Expected both waiters to get the ACK, got %v", ack)
+		}
+	}
+}
+
+func TestSendQueueRelease(t *testing.T) {
+	q := &sendQueue{coalesce: map[int]bool{commands.LightStatusRequest.Command1(): true}}
+	current := q.push(queueMsg(1, commands.LightOn), Normal)
+	status := q.push(queueMsg(2, commands.LightStatusRequest), Normal)
+	q.push(queueMsg(2, commands.LightStatusRequest), Normal)
+	if next := nextStarted(q, current, []*request{status}); next != status {
+		t.Fatalf("Expected the status request to be next")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if msg, err := q.wait(ctx, status); msg == nil || err != nil {
+		t.Fatalf("Expected the first waiter to get the message, got %v %v", msg, err)
+	}
+
+	type result struct {
+		msg *insteon.Message
+		err error
+	}
+	results := make(chan result, 1)
+	go func() {
+		msg, err := q.wait(context.Background(), status)
+		results <- result{msg, err}
+	}()
+
+	// the first waiter's context is cancelled while sending, so the
+	// message is handed to the other waiter
+	cancel()
+	q.release(status, nil, ctx.Err())
+	got := <-results
+	if got.msg == nil || got.err != nil {
+		t.Fatalf("Expected the second waiter to get the message, got %v %v", got.msg, got.err)
+	}
+
+	select {
+	case <-status.done:
+		t.Fatalf("Expected the request not to be finished when it was released")
+	default:
+	}
+
+	q.finish(status, &insteon.Message{Src: 2}, nil)
+	if status.err != nil || status.ack == nil {
+		t.Errorf("Expected the second waiter's result, got %v %v", status.ack, status.err)
+	}
+
+	// the last waiter releasing the message finishes the request
+	last := q.push(queueMsg(3, commands.LightOn), Normal)
+	if msg, _ := q.wait(context.Background(), last); msg == nil {
+		t.Fatalf("Expected the waiter to get the message")
+	}
+	q.release(last, nil, context.Canceled)
+	select {
+	case <-last.done:
+		if last.err != context.Canceled {
+			t.Errorf("Wanted error %v got %v", context.Canceled, last.err)
+		}
+	default:
+		t.Errorf("Expected the request to be finished")
+	}
+
+	if q.busy {
+		t.Errorf("Expected the queue to be empty")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrDisconnected is returned for writes that are pending, or attempted,
+// while the connection to the IM is down
+var ErrDisconnected = errors.New("Connection to the IM is down")
+
+// ConnState is the state of the connection to the IM
+type ConnState int
+
+const (
+	// Connected indicates the IM is reachable
+	Connected ConnState = iota
+
+	// Disconnected indicates the connection to the IM was lost and is
+	// being re-established
+	Disconnected
+)
+
+func (cs ConnState) String() string {
+	switch cs {
+	case Connected:
+		return "connected"
+	case Disconnected:
+		return "disconnected"
+	}
+	return "unknown"
+}
+
+// Dialer opens the connection to an IM.  If the returned io.ReadWriter
+// is also an io.Closer then it will be closed when the connection is lost
+type Dialer func() (io.ReadWriter, error)
+
+// Reconnect will cause the PLM to re-open the connection to the IM, using
+// the given Dialer, whenever reading from the IM fails.  Without Reconnect
+// any read error permanently stops the PLM.  While the connection is
+// down, pending and new writes fail with ErrDisconnected
+func Reconnect(dial Dialer) Option {
+	return func(p *PLM) {
+		p.dial = dial
+	}
+}
+
+// ReconnectBackoff sets the minimum and maximum time to wait between
+// reconnect attempts.  The wait starts at min and doubles after every
+// failed attempt until it reaches max.  The defaults are one second and
+// thirty seconds
+func ReconnectBackoff(min, max time.Duration) Option {
+	return func(p *PLM) {
+		p.minBackoff = min
+		p.maxBackoff = max
+	}
+}
+
+// StateFunc registers a callback that is called every time the state of
+// the connection to the IM changes.  err is the error that caused the
+// connection to be lost.  The callback is called from the PLM's read
+// loop and must not block
+func StateFunc(cb func(state ConnState, err error)) Option {
+	return func(p *PLM) {
+		p.stateFunc = cb
+	}
+}
+
+// State returns the current state of the connection to the IM
+func (plm *PLM) State() ConnState {
+	plm.mu.Lock()
+	defer plm.mu.Unlock()
+	return plm.state
+}
+
+func (plm *PLM) setState(state ConnState, err error) {
+	LogDebug.Printf("IM %v", state)
+	if plm.stateFunc != nil {
+		plm.stateFunc(state, err)
+	}
+}
+
+// disconnected marks the connection as down and fails any write waiting
+// for a response
+func (plm *PLM) disconnected(err error) {
+	plm.mu.Lock()
+	plm.state = Disconnected
+	close(plm.down)
+	if plm.pending != nil {
+		close(plm.pending.ch)
+		plm.pending = nil
+	}
+	port := plm.port
+	plm.port = nil
+	plm.mu.Unlock()
+
+	if closer, ok := port.(io.Closer); ok {
+		closer.Close()
+	}
+	plm.setState(Disconnected, err)
+}
+
+// reconnect re-dials the IM, backing off between failed attempts,
+// and returns true once the connection has been restored.  False is
+// returned if the PLM was closed while reconnecting
+func (plm *PLM) reconnect(err error) bool {
+	Log.Printf("Lost connection to the IM (%v), reconnecting", err)
+	plm.disconnected(err)
+
+	backoff := plm.minBackoff
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-plm.done:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+
+		port, err := plm.dial()
+		if err == nil && !plm.connect(port) {
+			if closer, ok := port.(io.Closer); ok {
+				closer.Close()
+			}
+			return false
+		} else if err == nil {
+			Log.Printf("Reconnected to the IM")
+			plm.setState(Connected, nil)
+			return true
+		}
+
+		Log.Printf("Reconnect failed: %v", err)
+		backoff *= 2
+		if backoff > plm.maxBackoff {
+			backoff = plm.maxBackoff
+		}
+	}
+}
+
+// connect starts using port to communicate with the IM. The packet
+// reader is replaced so that it re-syncs on the new stream.  False is
+// returned, and the port is not used, if the PLM has been closed
+func (plm *PLM) connect(port io.ReadWriter) bool {
+	plm.mu.Lock()
+	defer plm.mu.Unlock()
+	if plm.isClosed() {
+		return false
+	}
+	plm.port = port
+	plm.writer = logWriter{port}
+	plm.reader = newPacketReader(port, false)
+	plm.down = make(chan struct{})
+	plm.state = Connected
+	return true
+}
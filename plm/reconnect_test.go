@@ -0,0 +1,94 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPLMReconnect(t *testing.T) {
+	unplugged := errors.New("unplugged")
+	written := make(chan struct{}, 1)
+
+	// the first IM never answers, the second one answers GetInfo
+	first := newTestIM(func(pkt []byte) [][]byte {
+		written <- struct{}{}
+		return nil
+	})
+	second := newTestIM(func(pkt []byte) [][]byte {
+		return [][]byte{{0x02, 0x60, 0x01, 0x02, 0x03, 0x03, 0x15, 0x9e, 0x06}}
+	})
+
+	dials := 0
+	dialer := func() (io.ReadWriter, error) {
+		dials++
+		if dials == 1 {
+			return nil, errors.New("not plugged in yet")
+		}
+		return second, nil
+	}
+
+	states := make(chan ConnState, 2)
+	modem := New(first,
+		Timeout(time.Hour),
+		Reconnect(dialer),
+		ReconnectBackoff(time.Millisecond, time.Millisecond),
+		StateFunc(func(state ConnState, err error) {
+			if state == Disconnected && !errors.Is(err, unplugged) {
+				t.Errorf("Wanted error %v got %v", unplugged, err)
+			}
+			states <- state
+		}),
+	)
+
+	// a write pending when the connection drops must fail
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := modem.Info()
+		errCh <- err
+	}()
+
+	<-written
+	first.tx.CloseWithError(unplugged)
+	if err := <-errCh; !errors.Is(err, ErrDisconnected) {
+		t.Errorf("Wanted error %v got %v", ErrDisconnected, err)
+	}
+
+	for _, want := range []ConnState{Disconnected, Connected} {
+		if got := <-states; got != want {
+			t.Errorf("Wanted state %v got %v", want, got)
+		}
+	}
+
+	if modem.State() != Connected {
+		t.Errorf("Wanted state %v got %v", Connected, modem.State())
+	}
+
+	if dials != 2 {
+		t.Errorf("Wanted 2 dial attempts got %d", dials)
+	}
+
+	info, err := modem.Info()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if info.Address != 0x010203 {
+		t.Errorf("Wanted address 01.02.03 got %v", info.Address)
+	}
+}
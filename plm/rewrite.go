@@ -0,0 +1,259 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/abates/insteon"
+)
+
+// ErrVerifyFailed is returned when a link record read back from the IM
+// doesn't match what was written
+var ErrVerifyFailed = errors.New("link record read back from the IM does not match")
+
+// LinkAction is what RewriteLinks did with a link record
+type LinkAction int
+
+const (
+	// LinkSkipped means the record was already in the database
+	LinkSkipped LinkAction = iota
+
+	// LinkAdded means the record was added to the database
+	LinkAdded
+
+	// LinkUpdated means the data of an existing record was changed
+	LinkUpdated
+
+	// LinkDeleted means the record was removed from the database
+	LinkDeleted
+)
+
+func (la LinkAction) String() string {
+	switch la {
+	case LinkSkipped:
+		return "Skipped"
+	case LinkAdded:
+		return "Added"
+	case LinkUpdated:
+		return "Updated"
+	case LinkDeleted:
+		return "Deleted"
+	}
+	return fmt.Sprintf("LinkAction(%d)", int(la))
+}
+
+// LinkChange is a single record handled by RewriteLinks
+type LinkChange struct {
+	Action LinkAction
+
+	// Link is the record that was skipped, added, updated or deleted
+	Link insteon.LinkRecord
+
+	// Previous is the record before it was updated
+	Previous insteon.LinkRecord
+
+	// Err is set if the change failed
+	Err error
+
+	// Restored is true if the change was undone after a later change
+	// failed
+	Restored bool
+}
+
+func (lc LinkChange) String() string {
+	str := fmt.Sprintf("%-7v %v", lc.Action, lc.Link)
+	if lc.Err != nil {
+		str = fmt.Sprintf("%s (%v)", str, lc.Err)
+	} else if lc.Restored {
+		str = fmt.Sprintf("%s (restored)", str)
+	}
+	return str
+}
+
+// RewriteReport describes what RewriteLinks did to the IM's All-Link
+// database
+type RewriteReport struct {
+	// Snapshot is the database before it was changed
+	Snapshot []insteon.LinkRecord
+
+	// Changes lists every record, in the order it was handled
+	Changes []LinkChange
+
+	// Restored is true if a change failed and the snapshot was
+	// restored
+	Restored bool
+}
+
+// Changed returns the changes that were made (and not undone)
+func (rr *RewriteReport) Changed() (changes []LinkChange) {
+	for _, change := range rr.Changes {
+		if change.Action != LinkSkipped && change.Err == nil && !change.Restored {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// plan returns the changes needed to turn the snapshot into links.
+// Records are deleted first to make room for the new ones
+func plan(snapshot, links []insteon.LinkRecord) (changes []LinkChange) {
+	find := func(links []insteon.LinkRecord, link *insteon.LinkRecord) int {
+		for i := range links {
+			if links[i].Equal(link) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, link := range snapshot {
+		if find(links, &link) < 0 {
+			changes = append(changes, LinkChange{Action: LinkDeleted, Link: link})
+		}
+	}
+
+	for i, link := range links {
+		// duplicates are only written once
+		if find(links[0:i], &link) >= 0 {
+			continue
+		}
+
+		if j := find(snapshot, &link); j < 0 {
+			changes = append(changes, LinkChange{Action: LinkAdded, Link: link})
+		} else if snapshot[j].Data != link.Data {
+			changes = append(changes, LinkChange{Action: LinkUpdated, Link: link, Previous: snapshot[j]})
+		} else {
+			changes = append(changes, LinkChange{Action: LinkSkipped, Link: link})
+		}
+	}
+	return changes
+}
+
+// present determines if the IM has a record matching the link, and
+// with the same data
+func (ldb *linkdb) present(ctx context.Context, link insteon.LinkRecord) (bool, error) {
+	for cmd := LinkCmdFindFirst; ; cmd = LinkCmdFindNext {
+		got, err := ldb.find(ctx, cmd, link.Group, link.Address)
+		if err == ErrLinkNotFound {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		} else if got.Equal(&link) {
+			return got.Data == link.Data, nil
+		}
+	}
+}
+
+// apply makes the change and then reads back the record to verify it
+func (ldb *linkdb) apply(ctx context.Context, change LinkChange) (err error) {
+	want := true
+	switch change.Action {
+	case LinkAdded, LinkUpdated:
+		err = ldb.addLink(ctx, change.Link)
+	case LinkDeleted:
+		want = false
+		err = ldb.removeLink(ctx, &change.Link)
+	default:
+		return nil
+	}
+
+	if err == nil {
+		var got bool
+		if got, err = ldb.present(ctx, change.Link); err == nil && got != want {
+			err = fmt.Errorf("%w: %v %v", ErrVerifyFailed, change.Action, change.Link)
+		}
+	}
+	return err
+}
+
+// undo reverses the change, if it was made
+func (ldb *linkdb) undo(ctx context.Context, change LinkChange) (err error) {
+	switch change.Action {
+	case LinkAdded:
+		err = ldb.removeLink(ctx, &change.Link)
+	case LinkUpdated:
+		err = ldb.addLink(ctx, change.Previous)
+	case LinkDeleted:
+		err = ldb.addLink(ctx, change.Link)
+	}
+	return err
+}
+
+// RewriteLinks makes the IM's All-Link database match the given links.
+// The current database is read first, to take a snapshot, and only the
+// records that differ are deleted, added or updated.  Each change is
+// verified by reading the record back from the IM.  If a change fails
+// then every change made so far is undone, restoring the snapshot.  The
+// report lists what happened to each record, along with the snapshot
+func (ldb *linkdb) RewriteLinks(ctx context.Context, links ...insteon.LinkRecord) (report *RewriteReport, err error) {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+
+	// the snapshot is used to restore the database, so it is always
+	// read from the IM rather than the cache
+	report = &RewriteReport{}
+	ldb.invalidate()
+	if err = ldb.refresh(ctx); err != nil {
+		return report, err
+	}
+	report.Snapshot = append([]insteon.LinkRecord{}, ldb.links...)
+
+	// the cached links are only accurate if every change was made,
+	// or every change was undone
+	defer func() {
+		if err != nil && !report.Restored {
+			ldb.invalidate()
+		}
+	}()
+
+	report.Changes = plan(report.Snapshot, links)
+	failed := -1
+	for i, change := range report.Changes {
+		if err = ldb.apply(ctx, change); err != nil {
+			LogDebug.Printf("Failed to %v link %v: %v", change.Action, change.Link, err)
+			report.Changes[i].Err = err
+			failed = i
+			break
+		}
+	}
+
+	if failed < 0 {
+		ldb.links = append([]insteon.LinkRecord{}, links...)
+		return report, nil
+	}
+
+	// put back everything that was changed, including the failed change
+	// since it may have been partially made.  The change may have failed
+	// because the context is done, so it isn't used to restore the
+	// snapshot
+	for i := failed; i >= 0; i-- {
+		change := &report.Changes[i]
+		if change.Action == LinkSkipped {
+			continue
+		}
+
+		if rerr := ldb.undo(context.Background(), *change); rerr != nil {
+			Log.Printf("Failed to restore link %v: %v", change.Link, rerr)
+			return report, fmt.Errorf("%w (restoring the link database failed: %v)", err, rerr)
+		}
+		change.Restored = i != failed
+	}
+	report.Restored = true
+	ldb.links = report.Snapshot
+	return report, err
+}
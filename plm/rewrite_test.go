@@ -0,0 +1,42 @@
+package plm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/abates/insteon"
+)
+
+func TestRewritePlan(t *testing.T) {
+	withData := func(link insteon.LinkRecord, data ...byte) insteon.LinkRecord {
+		copy(link.Data[:], data)
+		return link
+	}
+
+	ctrl := insteon.ControllerLink(1, insteon.Address(0x010203))
+	resp := insteon.ResponderLink(1, insteon.Address(0x010203))
+	other := insteon.ControllerLink(2, insteon.Address(0x040506))
+
+	tests := []struct {
+		name     string
+		snapshot []insteon.LinkRecord
+		links    []insteon.LinkRecord
+		want     []LinkChange
+	}{
+		{"empty", nil, nil, nil},
+		{"unchanged", []insteon.LinkRecord{ctrl, resp}, []insteon.LinkRecord{ctrl, resp}, []LinkChange{{Action: LinkSkipped, Link: ctrl}, {Action: LinkSkipped, Link: resp}}},
+		{"add", []insteon.LinkRecord{ctrl}, []insteon.LinkRecord{ctrl, other}, []LinkChange{{Action: LinkSkipped, Link: ctrl}, {Action: LinkAdded, Link: other}}},
+		{"delete first", []insteon.LinkRecord{ctrl, resp}, []insteon.LinkRecord{other, resp}, []LinkChange{{Action: LinkDeleted, Link: ctrl}, {Action: LinkAdded, Link: other}, {Action: LinkSkipped, Link: resp}}},
+		{"update", []insteon.LinkRecord{resp}, []insteon.LinkRecord{withData(resp, 0xff)}, []LinkChange{{Action: LinkUpdated, Link: withData(resp, 0xff), Previous: resp}}},
+		{"duplicates", nil, []insteon.LinkRecord{other, other}, []LinkChange{{Action: LinkAdded, Link: other}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := plan(test.snapshot, test.links)
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted changes %v got %v", test.want, got)
+			}
+		})
+	}
+}
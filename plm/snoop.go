@@ -1,22 +1,48 @@
 package plm
 
 import (
+	"context"
 	"errors"
 	"io"
+	"sync"
 
 	"github.com/abates/insteon"
 	"github.com/abates/insteon/devices"
 )
 
+// MessageWriteCloser is a devices.MessageWriter that must be closed
+// when it is no longer needed
+type MessageWriteCloser interface {
+	devices.MessageWriter
+	io.Closer
+}
+
 type snoop struct {
-	msgBuf <-chan *Packet
+	rx     io.Reader
+	tx     io.Reader
+	msgBuf chan *Packet
+	done   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
 }
 
 func (s *snoop) Read() (*insteon.Message, error) {
-	pkt := <-s.msgBuf
-	msg := &insteon.Message{}
-	err := msg.UnmarshalBinary(pkt.Payload)
-	return msg, err
+	return s.ReadContext(context.Background())
+}
+
+// ReadContext is the same as Read, but returns ctx.Err() if the
+// context is done before a message is snooped
+func (s *snoop) ReadContext(ctx context.Context) (*insteon.Message, error) {
+	select {
+	case pkt := <-s.msgBuf:
+		msg := &insteon.Message{}
+		err := msg.UnmarshalBinary(pkt.Payload)
+		return msg, err
+	case <-s.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 func (s *snoop) Write(*insteon.Message) (ack *insteon.Message, err error) {
@@ -24,29 +50,69 @@ func (s *snoop) Write(*insteon.Message) (ack *insteon.Message, err error) {
 	return nil, ErrNotImplemented
 }
 
-func Snoop(rx, tx io.Reader) devices.MessageWriter {
-	msgBuf := make(chan *Packet, 10)
+// Close stops snooping.  Any blocked Read returns ErrClosed. The rx
+// and tx readers are closed if they are io.Closers, in which case
+// Close waits for the read loops to exit
+func (s *snoop) Close() (err error) {
+	err = ErrClosed
+	s.once.Do(func() {
+		err = nil
+		close(s.done)
+
+		rxCloser, rxOk := s.rx.(io.Closer)
+		txCloser, txOk := s.tx.(io.Closer)
+		if rxOk {
+			err = rxCloser.Close()
+		}
+
+		if txOk {
+			if e := txCloser.Close(); err == nil {
+				err = e
+			}
+		}
+
+		if rxOk && txOk {
+			s.wg.Wait()
+		}
+	})
+	return err
+}
+
+func Snoop(rx, tx io.Reader) MessageWriteCloser {
 	s := &snoop{
-		msgBuf: msgBuf,
+		rx:     rx,
+		tx:     tx,
+		msgBuf: make(chan *Packet, 10),
+		done:   make(chan struct{}),
 	}
-	go s.readLoop(newPacketReader(tx, false), msgBuf)
-	go s.readLoop(newPacketReader(rx, true), msgBuf)
+	s.wg.Add(2)
+	go s.readLoop(newPacketReader(tx, false))
+	go s.readLoop(newPacketReader(rx, true))
 	return s
 }
 
-func (s *snoop) readLoop(reader *packetReader, msgBuf chan<- *Packet) {
+func (s *snoop) readLoop(reader *packetReader) {
+	defer s.wg.Done()
 	for {
 		pkt, err := reader.ReadPacket()
 		if err != nil {
-			if !errors.Is(err, io.EOF) {
-				Log.Printf("Read error: %v", err)
+			select {
+			case <-s.done:
+			default:
+				if !errors.Is(err, io.EOF) {
+					Log.Printf("Read error: %v", err)
+				}
 			}
 			return
 		}
 
 		if pkt.Command == CmdStdMsgReceived || pkt.Command == CmdExtMsgReceived || pkt.Command == CmdSendInsteonMsg {
 			if !pkt.ACK() {
-				msgBuf <- pkt
+				select {
+				case s.msgBuf <- pkt:
+				case <-s.done:
+					return
+				}
 			}
 		}
 	}
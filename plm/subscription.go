@@ -0,0 +1,246 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"sync/atomic"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/devices"
+)
+
+// OverflowPolicy determines what happens to a message delivered
+// to a subscription whose buffer is already full
+type OverflowPolicy int
+
+const (
+	// DropNewest discards the message being delivered and keeps
+	// everything already in the buffer.  This is the default policy
+	DropNewest OverflowPolicy = iota
+
+	// DropOldest discards the oldest message in the buffer to make
+	// room for the message being delivered
+	DropOldest
+)
+
+// DefaultSubscriptionBuffer is the number of messages a subscription
+// will buffer when no BufferSize option is given
+const DefaultSubscriptionBuffer = 100
+
+// SubscribeOption is used to configure a subscription
+type SubscribeOption func(*Subscription)
+
+// BufferSize sets the number of messages that a subscription will
+// hold before the overflow policy is applied
+func BufferSize(size int) SubscribeOption {
+	return func(s *Subscription) {
+		s.size = size
+	}
+}
+
+// Overflow sets the policy used when the subscription buffer is full
+func Overflow(policy OverflowPolicy) SubscribeOption {
+	return func(s *Subscription) {
+		s.policy = policy
+	}
+}
+
+// topic is the kind of value a subscriber receives
+type topic int
+
+const (
+	messageTopic topic = iota
+	x10Topic
+	eventTopic
+)
+
+// channel is the buffered channel of a subscriber.  Each kind of
+// subscription has a channel of its own type
+type channel interface {
+	// send queues the value without blocking.  False is returned if
+	// the buffer is full
+	send(v interface{}) bool
+
+	// discard removes the oldest value from the buffer, if there is one
+	discard()
+
+	close()
+}
+
+// subscriber is the part of a subscription the PLM delivers to.
+// Subscription, X10Subscription and EventSubscription each embed one
+type subscriber struct {
+	plm     *PLM
+	topic   topic
+	wants   func(v interface{}) bool // nil means everything on the topic
+	buf     channel
+	policy  OverflowPolicy
+	dropped uint64
+	closed  bool
+}
+
+// subscribe adds the subscriber to the PLM, the subscriber is closed
+// right away if the PLM has stopped
+func (plm *PLM) subscribe(s *subscriber) {
+	plm.mu.Lock()
+	defer plm.mu.Unlock()
+	s.plm = plm
+	if plm.closed {
+		s.close()
+	} else {
+		plm.subs = append(plm.subs, s)
+	}
+}
+
+// publish must be called with plm.mu held.  The value is delivered to
+// every subscriber of the topic that wants it, and the number of those
+// subscribers is returned
+func (plm *PLM) publish(t topic, v interface{}) (n int) {
+	for _, s := range plm.subs {
+		if s.topic == t && (s.wants == nil || s.wants(v)) {
+			s.deliver(v)
+			n++
+		}
+	}
+	return n
+}
+
+// Dropped returns the number of messages (or events) that were discarded
+// because the subscription buffer was full
+func (s *subscriber) Dropped() int {
+	return int(atomic.LoadUint64(&s.dropped))
+}
+
+// Unsubscribe stops delivery to the subscription and closes the
+// subscription channel
+func (s *subscriber) Unsubscribe() {
+	plm := s.plm
+	plm.mu.Lock()
+	defer plm.mu.Unlock()
+	for i, sub := range plm.subs {
+		if sub == s {
+			plm.subs = append(plm.subs[0:i], plm.subs[i+1:]...)
+			break
+		}
+	}
+	s.close()
+}
+
+// close must be called with plm.mu held
+func (s *subscriber) close() {
+	if !s.closed {
+		s.closed = true
+		s.buf.close()
+	}
+}
+
+// deliver must be called with plm.mu held.  deliver never blocks
+func (s *subscriber) deliver(v interface{}) {
+	if s.closed || s.buf.send(v) {
+		return
+	}
+
+	if s.policy == DropOldest {
+		s.buf.discard()
+		s.buf.send(v)
+	}
+	atomic.AddUint64(&s.dropped, 1)
+}
+
+// messageChan is the channel of a Subscription.  Each subscription gets
+// its own copy of the message
+type messageChan chan *insteon.Message
+
+func (c messageChan) send(v interface{}) bool {
+	select {
+	case c <- copyMessage(v.(*insteon.Message)):
+		return true
+	default:
+	}
+	return false
+}
+
+func (c messageChan) discard() {
+	select {
+	case <-c:
+	default:
+	}
+}
+
+func (c messageChan) close() { close(c) }
+
+// Subscription receives a copy of every insteon message, received by the
+// PLM, that matches the subscription's matcher.  Subscriptions do not
+// take messages away from other readers (Read, Conn or other subscriptions).
+// A slow subscriber only loses its own messages according to its
+// OverflowPolicy
+type Subscription struct {
+	subscriber
+	size int
+	ch   chan *insteon.Message
+}
+
+// Subscribe returns a Subscription that will receive every insteon message
+// matching the given matcher. Messages are buffered (DefaultSubscriptionBuffer
+// by default) and, once the buffer is full, dropped according to the
+// overflow policy (DropNewest by default). The subscription channel is
+// closed when Unsubscribe is called or the PLM stops reading
+func (plm *PLM) Subscribe(matcher devices.Matcher, options ...SubscribeOption) *Subscription {
+	s := &Subscription{size: DefaultSubscriptionBuffer}
+	s.topic = messageTopic
+	s.policy = DropNewest
+	s.wants = func(v interface{}) bool { return matcher.Matches(v.(*insteon.Message)) }
+
+	for _, o := range options {
+		o(s)
+	}
+
+	if s.size < 1 {
+		s.size = 1
+	}
+	s.ch = make(chan *insteon.Message, s.size)
+	s.buf = messageChan(s.ch)
+	plm.subscribe(&s.subscriber)
+	return s
+}
+
+// SubscribeFunc is the same as Subscribe except the callback is called,
+// from its own goroutine, for every matching message.  The callback must
+// not call Unsubscribe
+func (plm *PLM) SubscribeFunc(matcher devices.Matcher, cb func(*insteon.Message), options ...SubscribeOption) *Subscription {
+	s := plm.Subscribe(matcher, options...)
+	go func() {
+		for msg := range s.ch {
+			cb(msg)
+		}
+	}()
+	return s
+}
+
+// Messages returns the channel that matching messages are delivered to
+func (s *Subscription) Messages() <-chan *insteon.Message {
+	return s.ch
+}
+
+// copyMessage returns a deep copy of the message so that each subscriber
+// can safely modify what it receives
+func copyMessage(msg *insteon.Message) *insteon.Message {
+	c := *msg
+	if msg.Payload != nil {
+		c.Payload = make([]byte, len(msg.Payload))
+		copy(c.Payload, msg.Payload)
+	}
+	return &c
+}
@@ -0,0 +1,150 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+	"github.com/abates/insteon/devices"
+)
+
+func stdMsgPacket(src insteon.Address, flags insteon.Flags, group byte) []byte {
+	buf := []byte{0x02, byte(CmdStdMsgReceived)}
+	buf = append(buf, src.Bytes()...)
+	buf = append(buf, 0x00, 0x00, group, byte(flags), 0x11, 0x00)
+	return buf
+}
+
+func TestSubscribe(t *testing.T) {
+	port, rx := newTestPort()
+	modem := New(port, Timeout(time.Second))
+
+	all := modem.Subscribe(devices.Matches(func(*insteon.Message) bool { return true }))
+	allLink := modem.Subscribe(devices.AllLinkMatcher())
+	newest := modem.Subscribe(devices.SrcMatcher(insteon.Address(0x010203)), BufferSize(1))
+	oldest := modem.Subscribe(devices.SrcMatcher(insteon.Address(0x010203)), BufferSize(1), Overflow(DropOldest))
+
+	callback := make(chan *insteon.Message, 10)
+	modem.SubscribeFunc(devices.AllLinkMatcher(), func(msg *insteon.Message) { callback <- msg })
+
+	rx.Write(stdMsgPacket(insteon.Address(0x010203), insteon.StandardAllLinkBroadcast, 1))
+	rx.Write(stdMsgPacket(insteon.Address(0x010203), insteon.StandardBroadcast, 2))
+	rx.Write(stdMsgPacket(insteon.Address(0x040506), insteon.StandardAllLinkBroadcast, 3))
+	rx.Close()
+
+	tests := []struct {
+		name        string
+		sub         *Subscription
+		wantGroups  []byte
+		wantDropped int
+	}{
+		{"all", all, []byte{1, 2, 3}, 0},
+		{"all-link", allLink, []byte{1, 3}, 0},
+		{"drop newest", newest, []byte{1}, 1},
+		{"drop oldest", oldest, []byte{2}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := []byte{}
+			for msg := range test.sub.Messages() {
+				got = append(got, byte(msg.Dst))
+			}
+
+			if string(test.wantGroups) != string(got) {
+				t.Errorf("Wanted groups %v got %v", test.wantGroups, got)
+			}
+
+			if test.wantDropped != test.sub.Dropped() {
+				t.Errorf("Wanted %d dropped got %d", test.wantDropped, test.sub.Dropped())
+			}
+		})
+	}
+
+	for _, want := range []byte{1, 3} {
+		select {
+		case msg := <-callback:
+			if byte(msg.Dst) != want {
+				t.Errorf("Wanted callback for group %d got %d", want, byte(msg.Dst))
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Timed out waiting for callback")
+		}
+	}
+
+	// subscribing to a stopped PLM returns a closed subscription
+	if _, open := <-modem.Subscribe(devices.AllLinkMatcher()).Messages(); open {
+		t.Errorf("Expected subscription channel to be closed")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	port, rx := newTestPort()
+	defer rx.Close()
+	modem := New(port)
+
+	sub := modem.Subscribe(devices.AllLinkMatcher())
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	if _, open := <-sub.Messages(); open {
+		t.Errorf("Expected subscription channel to be closed")
+	}
+
+	if len(modem.subs) != 0 {
+		t.Errorf("Expected subscription to be removed from the PLM")
+	}
+}
+
+func TestPublishTopics(t *testing.T) {
+	port, rx := newTestPort()
+	defer rx.Close()
+	modem := New(port)
+
+	msgs := modem.Subscribe(devices.Matches(func(*insteon.Message) bool { return true }))
+	x10 := modem.SubscribeX10()
+	events := modem.SubscribeEvents()
+
+	modem.mu.Lock()
+	got := []int{
+		modem.publish(messageTopic, &insteon.Message{}),
+		modem.publish(x10Topic, X10Event{}),
+		modem.publish(eventTopic, UserResetEvent{}),
+	}
+	modem.mu.Unlock()
+
+	for i, n := range got {
+		if n != 1 {
+			t.Errorf("Topic %d: wanted 1 subscriber got %d", i, n)
+		}
+	}
+
+	if len(msgs.Messages()) != 1 || len(x10.Events()) != 1 || len(events.Events()) != 1 {
+		t.Errorf("Expected each subscription to only get its own topic")
+	}
+
+	x10.Unsubscribe()
+	modem.Close()
+	<-msgs.Messages()
+	<-events.Events()
+	if _, open := <-msgs.Messages(); open {
+		t.Errorf("Expected the message subscription to be closed")
+	}
+
+	if _, open := <-events.Events(); open {
+		t.Errorf("Expected the event subscription to be closed")
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultTCPPort is the port the Insteon Hub (2245) listens on for
+// raw IM commands
+const DefaultTCPPort = "9761"
+
+// TCPOption is used to configure a TCPPort
+type TCPOption func(*TCPPort)
+
+// ConnectTimeout sets the time to wait for a TCP connection to be
+// established.  The default is 5 seconds
+func ConnectTimeout(timeout time.Duration) TCPOption {
+	return func(tp *TCPPort) {
+		tp.dialer.Timeout = timeout
+	}
+}
+
+// KeepAlive sets the TCP keepalive period.  The default is 30 seconds,
+// a negative value disables keepalives
+func KeepAlive(period time.Duration) TCPOption {
+	return func(tp *TCPPort) {
+		tp.dialer.KeepAlive = period
+	}
+}
+
+// ReconnectDelay sets the time to wait between reconnection attempts.
+// The default is one second
+func ReconnectDelay(delay time.Duration) TCPOption {
+	return func(tp *TCPPort) {
+		tp.delay = delay
+	}
+}
+
+// TCPPort is an io.ReadWriteCloser for an IM that is reachable over the
+// network, such as the Insteon Hub 2245 (port 9761) or a serial port
+// shared with ser2net.  If the connection is lost, TCPPort will keep
+// trying to reconnect until it is closed.  Reads block while the port
+// is reconnecting, writes fail if the port can't be reconnected
+// immediately
+type TCPPort struct {
+	address string
+	dialer  net.Dialer
+	delay   time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed chan struct{}
+}
+
+// DialTCP will connect to the IM at the given address. If the address
+// does not include a port then DefaultTCPPort is used
+func DialTCP(address string, options ...TCPOption) (*TCPPort, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultTCPPort)
+	}
+
+	tp := &TCPPort{
+		address: address,
+		dialer:  net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second},
+		delay:   time.Second,
+		closed:  make(chan struct{}),
+	}
+
+	for _, o := range options {
+		o(tp)
+	}
+
+	conn, err := tp.dialer.Dial("tcp", tp.address)
+	if err == nil {
+		tp.conn = conn
+	}
+	return tp, err
+}
+
+func (tp *TCPPort) isClosed() bool {
+	select {
+	case <-tp.closed:
+		return true
+	default:
+	}
+	return false
+}
+
+// connection returns the current connection, dialing a new
+// one if the previous connection was lost.  The lock is not held while
+// dialing, so that Close isn't held up while the IM is unreachable
+func (tp *TCPPort) connection() (net.Conn, error) {
+	tp.mu.Lock()
+	conn := tp.conn
+	tp.mu.Unlock()
+	if tp.isClosed() {
+		return nil, io.EOF
+	} else if conn != nil {
+		return conn, nil
+	}
+
+	// closing the port abandons the dial
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-tp.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	conn, err := tp.dialer.DialContext(ctx, "tcp", tp.address)
+	if err != nil {
+		if tp.isClosed() {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.isClosed() {
+		conn.Close()
+		return nil, io.EOF
+	} else if tp.conn != nil {
+		// a concurrent read or write connected first
+		conn.Close()
+		return tp.conn, nil
+	}
+
+	LogDebug.Printf("Connected to %s", tp.address)
+	tp.conn = conn
+	return conn, nil
+}
+
+// disconnect discards conn if it is still the current connection
+func (tp *TCPPort) disconnect(conn net.Conn, err error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.conn == conn {
+		if !tp.isClosed() {
+			Log.Printf("Connection to %s lost (%v), reconnecting", tp.address, err)
+		}
+		tp.conn.Close()
+		tp.conn = nil
+	}
+}
+
+// Read reads from the IM.  If the connection is lost, Read will
+// continue trying to reconnect until either the connection is
+// restored or the port is closed
+func (tp *TCPPort) Read(buf []byte) (n int, err error) {
+	for {
+		var conn net.Conn
+		conn, err = tp.connection()
+		if err == nil {
+			n, err = conn.Read(buf)
+			if n > 0 || err == nil {
+				return n, nil
+			}
+			tp.disconnect(conn, err)
+		} else if err == io.EOF {
+			return 0, err
+		} else {
+			LogDebug.Printf("Failed to connect to %s: %v", tp.address, err)
+		}
+
+		select {
+		case <-tp.closed:
+			return 0, io.EOF
+		case <-time.After(tp.delay):
+		}
+	}
+}
+
+// Write sends the buffer to the IM. If the connection has been lost
+// Write will make one attempt to reconnect before returning an error
+func (tp *TCPPort) Write(buf []byte) (n int, err error) {
+	conn, err := tp.connection()
+	if err == nil {
+		n, err = conn.Write(buf)
+		if err != nil {
+			tp.disconnect(conn, err)
+		}
+	}
+	return n, err
+}
+
+// Close will close the network connection and stop any attempts to
+// reconnect. Any blocked Read will return io.EOF
+func (tp *TCPPort) Close() (err error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.isClosed() {
+		return errors.New("port already closed")
+	}
+	close(tp.closed)
+
+	if tp.conn != nil {
+		err = tp.conn.Close()
+		tp.conn = nil
+	}
+	return err
+}
+
+func (tp *TCPPort) String() string {
+	return "tcp://" + tp.address
+}
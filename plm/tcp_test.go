@@ -0,0 +1,183 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/abates/insteon"
+)
+
+// testTCPServer accepts connections and passes each one, in order,
+// to the next handler
+func testTCPServer(t *testing.T, handlers ...func(net.Conn)) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	go func() {
+		for _, handler := range handlers {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			handler(conn)
+		}
+	}()
+	return l
+}
+
+func TestTCPPortReconnect(t *testing.T) {
+	l := testTCPServer(t,
+		func(conn net.Conn) { conn.Write([]byte("abc")); conn.Close() },
+		func(conn net.Conn) { conn.Write([]byte("def")) },
+	)
+	defer l.Close()
+
+	port, err := DialTCP(l.Addr().String(), ReconnectDelay(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer port.Close()
+
+	for _, want := range []string{"abc", "def"} {
+		buf := make([]byte, 3)
+		_, err := io.ReadFull(port, buf)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if string(buf) != want {
+			t.Errorf("Wanted %q got %q", want, string(buf))
+		}
+	}
+}
+
+func TestTCPPortClose(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	l := testTCPServer(t, func(conn net.Conn) { <-done; conn.Close() })
+	defer l.Close()
+
+	port, err := DialTCP(l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := port.Read(make([]byte, 1))
+		errCh <- err
+	}()
+
+	port.Close()
+	select {
+	case err := <-errCh:
+		if err != io.EOF {
+			t.Errorf("Wanted io.EOF got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Timed out waiting for Read to return")
+	}
+
+	if _, err := port.Write([]byte{0x02}); err != io.EOF {
+		t.Errorf("Wanted io.EOF got %v", err)
+	}
+}
+
+func TestTCPPortCloseWhileDialing(t *testing.T) {
+	l := testTCPServer(t)
+	defer l.Close()
+
+	port, err := DialTCP(l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the next dial blocks until the test is done
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	port.dialer.Control = func(string, string, syscall.RawConn) error {
+		close(dialing)
+		<-release
+		return nil
+	}
+	port.disconnect(port.conn, io.EOF)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := port.Write([]byte{0x02})
+		errCh <- err
+	}()
+	<-dialing
+
+	closed := make(chan struct{})
+	go func() {
+		port.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("Close waited for the dial")
+	}
+
+	release <- struct{}{}
+	if err := <-errCh; err != io.EOF {
+		t.Errorf("Wanted io.EOF got %v", err)
+	}
+}
+
+func TestTCPPortDefaultPort(t *testing.T) {
+	port, _ := DialTCP("127.0.0.1", ConnectTimeout(time.Millisecond))
+	if port.String() != "tcp://127.0.0.1:9761" {
+		t.Errorf("Wanted tcp://127.0.0.1:9761 got %v", port)
+	}
+}
+
+func TestTCPPortPLM(t *testing.T) {
+	l := testTCPServer(t, func(conn net.Conn) {
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(conn, buf); err == nil && buf[1] == byte(CmdGetInfo) {
+			conn.Write([]byte{0x02, 0x60, 0x01, 0x02, 0x03, 0x03, 0x15, 0x9e, 0x06})
+		}
+	})
+	defer l.Close()
+
+	port, err := DialTCP(l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer port.Close()
+
+	modem := New(port, Timeout(time.Second))
+	info, err := modem.Info()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := insteon.Address(0x010203)
+	if info.Address != want {
+		t.Errorf("Wanted address %v got %v", want, info.Address)
+	}
+}
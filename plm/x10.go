@@ -0,0 +1,303 @@
+// Copyright 2026 Andrew Bates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidX10Address is returned when an X10 house code is not
+	// A through P or the unit code is not 1 through 16
+	ErrInvalidX10Address = errors.New("invalid X10 address")
+
+	// ErrInvalidX10Function is returned for an unknown X10 function
+	ErrInvalidX10Function = errors.New("invalid X10 function")
+)
+
+// x10Delay is how long it takes the IM to send an X10 address or
+// function on the powerline
+const x10Delay = 500 * time.Millisecond
+
+// x10Codes are the bit patterns used for house codes A-P and unit
+// codes 1-16
+var x10Codes = [16]byte{0x6, 0xe, 0x2, 0xa, 0x1, 0x9, 0x5, 0xd, 0x7, 0xf, 0x3, 0xb, 0x0, 0x8, 0x4, 0xc}
+
+// x10Index returns the index into x10Codes of the bit pattern
+func x10Index(code byte) int {
+	for i, c := range x10Codes {
+		if c == code&0x0f {
+			return i
+		}
+	}
+	return 0
+}
+
+// HouseCode is an X10 house code, 'A' through 'P'
+type HouseCode byte
+
+func (hc HouseCode) valid() bool { return 'A' <= hc && hc <= 'P' }
+
+func (hc HouseCode) code() byte { return x10Codes[hc-'A'] }
+
+func (hc HouseCode) String() string {
+	if hc.valid() {
+		return string(rune(hc))
+	}
+	return fmt.Sprintf("HouseCode(%d)", byte(hc))
+}
+
+// UnitCode is an X10 unit code, 1 through 16.  A unit code of zero is
+// used for functions that apply to every unit with the house code
+type UnitCode int
+
+func (uc UnitCode) valid() bool { return 1 <= uc && uc <= 16 }
+
+func (uc UnitCode) code() byte { return x10Codes[uc-1] }
+
+// X10Address is the house and unit code of an X10 device, such as A1
+type X10Address struct {
+	House HouseCode
+	Unit  UnitCode
+}
+
+// ParseX10Address parses a house code (A-P) optionally followed by a
+// unit code (1-16), such as "A1" or "p16"
+func ParseX10Address(str string) (addr X10Address, err error) {
+	err = addr.Set(str)
+	return addr, err
+}
+
+// Set satisfies the flag.Value interface
+func (addr *X10Address) Set(str string) error {
+	str = strings.ToUpper(strings.TrimSpace(str))
+	if len(str) == 0 {
+		return ErrInvalidX10Address
+	}
+
+	a := X10Address{House: HouseCode(str[0])}
+	if len(str) > 1 {
+		unit, err := strconv.Atoi(str[1:])
+		if err != nil || !UnitCode(unit).valid() {
+			return ErrInvalidX10Address
+		}
+		a.Unit = UnitCode(unit)
+	}
+
+	if !a.House.valid() {
+		return ErrInvalidX10Address
+	}
+	*addr = a
+	return nil
+}
+
+func (addr X10Address) String() string {
+	if addr.Unit == 0 {
+		return addr.House.String()
+	}
+	return fmt.Sprintf("%v%d", addr.House, addr.Unit)
+}
+
+// X10Function is an X10 command
+type X10Function byte
+
+// X10 functions
+const (
+	X10AllUnitsOff   X10Function = 0x00
+	X10AllLightsOn   X10Function = 0x01
+	X10On            X10Function = 0x02
+	X10Off           X10Function = 0x03
+	X10Dim           X10Function = 0x04
+	X10Bright        X10Function = 0x05
+	X10AllLightsOff  X10Function = 0x06
+	X10ExtendedCode  X10Function = 0x07
+	X10HailRequest   X10Function = 0x08
+	X10HailAck       X10Function = 0x09
+	X10PresetDim1    X10Function = 0x0a
+	X10PresetDim2    X10Function = 0x0b
+	X10ExtendedData  X10Function = 0x0c
+	X10StatusOn      X10Function = 0x0d
+	X10StatusOff     X10Function = 0x0e
+	X10StatusRequest X10Function = 0x0f
+)
+
+var x10Functions = []string{
+	"AllUnitsOff", "AllLightsOn", "On", "Off", "Dim", "Bright", "AllLightsOff", "ExtendedCode",
+	"HailRequest", "HailAck", "PresetDim1", "PresetDim2", "ExtendedData", "StatusOn", "StatusOff", "StatusRequest",
+}
+
+// Set satisfies the flag.Value interface.  Function names are not case
+// sensitive
+func (fn *X10Function) Set(str string) error {
+	for i, name := range x10Functions {
+		if strings.EqualFold(name, str) {
+			*fn = X10Function(i)
+			return nil
+		}
+	}
+	return ErrInvalidX10Function
+}
+
+func (fn X10Function) String() string {
+	if int(fn) < len(x10Functions) {
+		return x10Functions[fn]
+	}
+	return fmt.Sprintf("X10Function(%d)", byte(fn))
+}
+
+// X10Event is an X10 function received by the IM.  Unit is the unit
+// addressed before the function was sent, or zero if no unit was
+// addressed
+type X10Event struct {
+	X10Address
+	Function X10Function
+}
+
+func (e X10Event) String() string {
+	return fmt.Sprintf("%v %v", e.X10Address, e.Function)
+}
+
+// x10Decoder turns the address and function packets received by the IM
+// into events.  X10 devices are addressed with one or more address
+// packets followed by a function packet that applies to every unit
+// addressed
+type x10Decoder struct {
+	units    map[HouseCode][]UnitCode
+	function bool
+}
+
+// decode returns the events for a CmdX10MsgReceived payload, nothing
+// is returned for address packets
+func (d *x10Decoder) decode(payload []byte) (events []X10Event) {
+	if len(payload) < 2 {
+		return nil
+	}
+
+	house := HouseCode('A' + x10Index(payload[0]>>4))
+	if payload[1]&0x80 == 0 {
+		if d.units == nil || d.function {
+			d.units = make(map[HouseCode][]UnitCode)
+			d.function = false
+		}
+		d.units[house] = append(d.units[house], UnitCode(x10Index(payload[0])+1))
+		return nil
+	}
+
+	d.function = true
+	fn := X10Function(payload[0] & 0x0f)
+	for _, unit := range d.units[house] {
+		events = append(events, X10Event{X10Address{house, unit}, fn})
+	}
+
+	if len(events) == 0 {
+		events = append(events, X10Event{X10Address{House: house}, fn})
+	}
+	return events
+}
+
+// x10Chan is the channel of an X10Subscription
+type x10Chan chan X10Event
+
+func (c x10Chan) send(v interface{}) bool {
+	select {
+	case c <- v.(X10Event):
+		return true
+	default:
+	}
+	return false
+}
+
+func (c x10Chan) discard() {
+	select {
+	case <-c:
+	default:
+	}
+}
+
+func (c x10Chan) close() { close(c) }
+
+// X10Subscription receives the X10 events received by the IM
+type X10Subscription struct {
+	subscriber
+	ch chan X10Event
+}
+
+// SubscribeX10 returns a subscription that receives every X10 event
+// received by the IM.  Events are buffered (DefaultSubscriptionBuffer)
+// and dropped when the buffer is full.  The channel is closed when
+// Unsubscribe is called or the PLM stops reading
+func (plm *PLM) SubscribeX10() *X10Subscription {
+	s := &X10Subscription{ch: make(chan X10Event, DefaultSubscriptionBuffer)}
+	s.topic = x10Topic
+	s.buf = x10Chan(s.ch)
+	plm.subscribe(&s.subscriber)
+	return s
+}
+
+// Events returns the channel that X10 events are delivered to
+func (s *X10Subscription) Events() <-chan X10Event {
+	return s.ch
+}
+
+// dispatchX10 delivers the X10 packet to the X10 subscriptions.  False
+// is returned when nobody is subscribed
+func (plm *PLM) dispatchX10(pkt *Packet) bool {
+	plm.mu.Lock()
+	defer plm.mu.Unlock()
+
+	subscribed := false
+	for _, event := range plm.x10.decode(pkt.Payload) {
+		LogDebug.Printf("RX X10 %v", event)
+		if plm.publish(x10Topic, event) > 0 {
+			subscribed = true
+		}
+	}
+	return subscribed
+}
+
+// SendX10 sends an X10 function to the device at the given address
+func (plm *PLM) SendX10(addr X10Address, fn X10Function) error {
+	return plm.SendX10Context(context.Background(), addr, fn)
+}
+
+// SendX10Context sends the X10 address followed by the function.  When
+// the unit code is zero only the function is sent, which is how
+// functions such as X10AllLightsOn are normally sent
+func (plm *PLM) SendX10Context(ctx context.Context, addr X10Address, fn X10Function) error {
+	if !addr.House.valid() || (addr.Unit != 0 && !addr.Unit.valid()) {
+		return ErrInvalidX10Address
+	} else if fn > X10StatusRequest {
+		return ErrInvalidX10Function
+	}
+
+	plm.x10Mu.Lock()
+	defer plm.x10Mu.Unlock()
+
+	if addr.Unit != 0 {
+		payload := []byte{addr.House.code()<<4 | addr.Unit.code(), 0x00}
+		if _, err := retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: CmdSendX10, Payload: payload}); err != nil {
+			return err
+		}
+	}
+
+	payload := []byte{addr.House.code()<<4 | byte(fn), 0x80}
+	_, err := retry(plm, plm.retry, true).WritePacketContext(ctx, &Packet{Command: CmdSendX10, Payload: payload})
+	return err
+}
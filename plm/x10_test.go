@@ -0,0 +1,202 @@
+package plm
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseX10Address(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    X10Address
+		wantErr error
+	}{
+		{"A1", X10Address{'A', 1}, nil},
+		{"p16", X10Address{'P', 16}, nil},
+		{"C", X10Address{House: 'C'}, nil},
+		{"Q1", X10Address{}, ErrInvalidX10Address},
+		{"A17", X10Address{}, ErrInvalidX10Address},
+		{"A0", X10Address{}, ErrInvalidX10Address},
+		{"Ax", X10Address{}, ErrInvalidX10Address},
+		{"", X10Address{}, ErrInvalidX10Address},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := ParseX10Address(test.input)
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if got != test.want {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestX10FunctionSet(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    X10Function
+		wantErr error
+	}{
+		{"on", X10On, nil},
+		{"AllLightsOff", X10AllLightsOff, nil},
+		{"statusrequest", X10StatusRequest, nil},
+		{"explode", 0, ErrInvalidX10Function},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			var got X10Function
+			err := got.Set(test.input)
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if got != test.want {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestX10Decoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		input [][]byte
+		want  []X10Event
+	}{
+		{"address only", [][]byte{{0x66, 0x00}}, nil},
+		{"A1 On", [][]byte{{0x66, 0x00}, {0x62, 0x80}}, []X10Event{{X10Address{'A', 1}, X10On}}},
+		{"P16 Off", [][]byte{{0xcc, 0x00}, {0xc3, 0x80}}, []X10Event{{X10Address{'P', 16}, X10Off}}},
+		{"A1 A2 Off", [][]byte{{0x66, 0x00}, {0x6e, 0x00}, {0x63, 0x80}}, []X10Event{{X10Address{'A', 1}, X10Off}, {X10Address{'A', 2}, X10Off}}},
+		{"B AllLightsOn", [][]byte{{0xe1, 0x80}}, []X10Event{{X10Address{House: 'B'}, X10AllLightsOn}}},
+		{"new address after function", [][]byte{{0x66, 0x00}, {0x62, 0x80}, {0x6e, 0x00}, {0x62, 0x80}}, []X10Event{{X10Address{'A', 1}, X10On}, {X10Address{'A', 2}, X10On}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &x10Decoder{}
+			var got []X10Event
+			for _, payload := range test.input {
+				got = append(got, d.decode(payload)...)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSendX10(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    X10Address
+		fn      X10Function
+		want    [][]byte
+		wantErr error
+	}{
+		{"A1 On", X10Address{'A', 1}, X10On, [][]byte{{0x02, 0x63, 0x66, 0x00}, {0x02, 0x63, 0x62, 0x80}}, nil},
+		{"M13 Bright", X10Address{'M', 13}, X10Bright, [][]byte{{0x02, 0x63, 0x00, 0x00}, {0x02, 0x63, 0x05, 0x80}}, nil},
+		{"C AllUnitsOff", X10Address{House: 'C'}, X10AllUnitsOff, [][]byte{{0x02, 0x63, 0x20, 0x80}}, nil},
+		{"bad house", X10Address{'Z', 1}, X10On, nil, ErrInvalidX10Address},
+		{"bad function", X10Address{'A', 1}, 0x10, nil, ErrInvalidX10Function},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var got [][]byte
+			im := newTestIM(func(pkt []byte) [][]byte {
+				mu.Lock()
+				got = append(got, append([]byte{}, pkt...))
+				mu.Unlock()
+				return [][]byte{append(append([]byte{}, pkt...), 0x06)}
+			})
+			defer im.Close()
+			modem := New(im, Timeout(time.Second), PacingScale(0))
+
+			err := modem.SendX10(test.addr, test.fn)
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted packets %x got %x", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSendX10Concurrent(t *testing.T) {
+	var mu sync.Mutex
+	var got [][]byte
+	var im *testIM
+	im = newTestIM(func(pkt []byte) [][]byte {
+		mu.Lock()
+		got = append(got, append([]byte{}, pkt...))
+		mu.Unlock()
+
+		// slow ACKs give the other senders time to line up
+		ack := append(append([]byte{}, pkt...), 0x06)
+		go func() {
+			time.Sleep(2 * time.Millisecond)
+			im.tx.Write(ack)
+		}()
+		return nil
+	})
+	defer im.Close()
+	modem := New(im, Timeout(time.Second), PacingScale(0))
+
+	var wg sync.WaitGroup
+	for unit := UnitCode(1); unit <= 16; unit++ {
+		wg.Add(1)
+		go func(addr X10Address) {
+			defer wg.Done()
+			if err := modem.SendX10(addr, X10On); err != nil {
+				t.Errorf("%v: unexpected error: %v", addr, err)
+			}
+		}(X10Address{'A', unit})
+	}
+	wg.Wait()
+
+	// every function must directly follow its own address
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 32 {
+		t.Fatalf("Wanted 32 packets got %d", len(got))
+	}
+
+	for i := 0; i < len(got); i += 2 {
+		if got[i][3] != 0x00 || got[i+1][3] != 0x80 {
+			t.Errorf("Wanted address then function got %x %x", got[i], got[i+1])
+		}
+	}
+}
+
+func TestSubscribeX10(t *testing.T) {
+	port, rx := newTestPort()
+	defer rx.Close()
+	modem := New(port, Timeout(time.Second))
+
+	sub := modem.SubscribeX10()
+	go rx.Write(bytes.Join([][]byte{{0x02, 0x52, 0x66, 0x00}, {0x02, 0x52, 0x62, 0x80}}, nil))
+
+	select {
+	case event := <-sub.Events():
+		if want := (X10Event{X10Address{'A', 1}, X10On}); event != want {
+			t.Errorf("Wanted event %v got %v", want, event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for X10 event")
+	}
+
+	sub.Unsubscribe()
+	if _, open := <-sub.Events(); open {
+		t.Errorf("Expected the events channel to be closed")
+	}
+}
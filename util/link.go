@@ -15,6 +15,7 @@
 package util
 
 import (
+	"context"
 	_ "embed"
 	"errors"
 	"io"
@@ -122,7 +123,13 @@ func FindDuplicateLinks(linkable devices.Linkable, equal func(l1, l2 insteon.Lin
 // a LinkRecord that matches the group, address and controller/responder
 // indicator
 func FindLinkRecord(device devices.Linkable, controller bool, address insteon.Address, group insteon.Group) (found insteon.LinkRecord, err error) {
-	links, err := device.Links()
+	return FindLinkRecordContext(context.Background(), device, controller, address, group)
+}
+
+// FindLinkRecordContext is the same as FindLinkRecord, but retrieving the
+// link database is aborted if the context is done first
+func FindLinkRecordContext(ctx context.Context, device devices.Linkable, controller bool, address insteon.Address, group insteon.Group) (found insteon.LinkRecord, err error) {
+	links, err := linksContext(ctx, device)
 	if err == nil {
 		err = ErrLinkNotFound
 		for _, link := range links {
@@ -264,10 +271,16 @@ func fixCrosslinks(links []insteon.LinkRecord, forAddresses ...insteon.Address)
 // CrossLinkAll will create bi-directional links among all the devices
 // listed. This is useful for creating virtual N-Way connections
 func CrossLinkAll(group insteon.Group, devices ...devices.Linkable) (err error) {
+	return CrossLinkAllContext(context.Background(), group, devices...)
+}
+
+// CrossLinkAllContext is the same as CrossLinkAll, but linking is stopped
+// as soon as the context is done
+func CrossLinkAllContext(ctx context.Context, group insteon.Group, devices ...devices.Linkable) (err error) {
 	for i, d1 := range devices {
 		for _, d2 := range devices[i:] {
 			if d1 != d2 {
-				err = CrossLink(group, d1, d2)
+				err = CrossLinkContext(ctx, group, d1, d2)
 				if err != nil {
 					return err
 				}
@@ -282,9 +295,15 @@ func CrossLinkAll(group insteon.Group, devices ...devices.Linkable) (err error)
 // link for the given group. When using lighting control devices, this
 // will effectively create a 3-Way light switch configuration
 func CrossLink(group insteon.Group, d1, d2 devices.Linkable) error {
-	err := Link(group, d1, d2)
+	return CrossLinkContext(context.Background(), group, d1, d2)
+}
+
+// CrossLinkContext is the same as CrossLink, but linking is stopped
+// as soon as the context is done
+func CrossLinkContext(ctx context.Context, group insteon.Group, d1, d2 devices.Linkable) error {
+	err := LinkContext(ctx, group, d1, d2)
 	if err == nil || errors.Is(err, ErrAlreadyLinked) {
-		err = Link(group, d2, d1)
+		err = LinkContext(ctx, group, d2, d1)
 		if errors.Is(err, ErrAlreadyLinked) {
 			err = nil
 		}
@@ -296,6 +315,14 @@ func CrossLink(group insteon.Group, d1, d2 devices.Linkable) error {
 // databases without first checking if the links exist. The links are
 // created by simulating set button presses (using EnterLinkingMode)
 func ForceLink(group insteon.Group, controller, responder devices.Linkable) error {
+	return ForceLinkContext(context.Background(), group, controller, responder)
+}
+
+// ForceLinkContext is the same as ForceLink, but the linking session is
+// abandoned if the context is done before it completes.  Each device that
+// was sent the command to enter linking mode is taken out of linking mode
+// again, even when linking fails or the context is cancelled
+func ForceLinkContext(ctx context.Context, group insteon.Group, controller, responder devices.Linkable) (err error) {
 	// The sequence to create a link between two devices follows:
 	// 1) Controller enters linking mode (same as holding down the set button for 10 seconds)
 	// 2) Controller sends a "Set-Button Pressed Controller" broadcast message
@@ -305,22 +332,35 @@ func ForceLink(group insteon.Group, controller, responder devices.Linkable) erro
 	// At this point the two devices will exchange direct messages that won't necessarily
 	// be seen by the initiator (such as a PLM), so as soon as the responder broadcast
 	// is received, we assume the linking is complete
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	// once a device has been sent the command to enter linking mode it
+	// must be taken out of linking mode, even if waiting for it failed.
+	// The context may be done by then, so it isn't used
+	responderSent := false
+	defer func() {
+		controller.ExitLinkingMode()
+		if responderSent {
+			responder.ExitLinkingMode()
+		}
+	}()
+
 	devices.LogDebug.Printf("Putting controller %s into linking mode", controller)
 
 	// controller enters all-linking mode
 	// and waits for set-button message.  If not
 	// set-button message is received, err will
 	// be ErrReadTimeout
-	err := controller.EnterLinkingMode(group)
+	err = enterLinkingMode(ctx, controller, group)
 
 	if err == nil {
 		// responder pushes the set button responder and
 		// waits for the set-button message
 		devices.LogDebug.Printf("Assigning responder to group")
-		err = responder.EnterLinkingMode(group)
-
-		controller.ExitLinkingMode()
-		responder.ExitLinkingMode()
+		responderSent = true
+		err = enterLinkingMode(ctx, responder, group)
 	}
 	return err
 }
@@ -331,34 +371,40 @@ func ForceLink(group insteon.Group, controller, responder devices.Linkable) erro
 // entry exists than the other is deleted and new links are created. Once the link
 // check/cleanup has taken place the new links are created using ForceLink
 func Link(group insteon.Group, controller, responder devices.Linkable) (err error) {
+	return LinkContext(context.Background(), group, controller, responder)
+}
+
+// LinkContext is the same as Link, but retrieving the link databases and
+// the linking session itself are abandoned if the context is done first
+func LinkContext(ctx context.Context, group insteon.Group, controller, responder devices.Linkable) (err error) {
 	devices.LogDebug.Printf("Looking for existing links")
 	var controllerLink, responderLink insteon.LinkRecord
-	controllerLink, err = FindLinkRecord(controller, true, responder.Address(), group)
+	controllerLink, err = FindLinkRecordContext(ctx, controller, true, responder.Address(), group)
 
 	if err == ErrLinkNotFound {
-		responderLink, err = FindLinkRecord(responder, false, controller.Address(), group)
+		responderLink, err = FindLinkRecordContext(ctx, responder, false, controller.Address(), group)
 
 		if err == nil {
 			// the controller did not have a link to the responder, but
 			// the responder had a link to the controller so we want to
 			// remove it before re-linking the devices
 			devices.LogDebug.Printf("Responder link already exists, deleting it")
-			err = RemoveLinks(responder, responderLink)
+			err = RemoveLinksContext(ctx, responder, responderLink)
 		}
 
 		if err == nil || err == ErrLinkNotFound {
-			err = ForceLink(group, controller, responder)
+			err = ForceLinkContext(ctx, group, controller, responder)
 		}
 	} else if err == nil {
-		_, err = FindLinkRecord(responder, false, controller.Address(), group)
+		_, err = FindLinkRecordContext(ctx, responder, false, controller.Address(), group)
 		if err == ErrLinkNotFound {
 			// The controller link exists, but no matching responder link
 			// exists, so we want to remove the controller link before
 			// re-linking
 			devices.LogDebug.Printf("Responder link already exists, deleting it")
-			err = RemoveLinks(controller, controllerLink)
+			err = RemoveLinksContext(ctx, controller, controllerLink)
 			if err == nil {
-				err = ForceLink(group, controller, responder)
+				err = ForceLinkContext(ctx, group, controller, responder)
 			}
 		}
 	}
@@ -404,7 +450,13 @@ func Unlink(group insteon.Group, controller, responder devices.Linkable) error {
 }
 
 func RemoveLinks(device devices.Linkable, remove ...insteon.LinkRecord) error {
-	links, err := device.Links()
+	return RemoveLinksContext(context.Background(), device, remove...)
+}
+
+// RemoveLinksContext is the same as RemoveLinks, but no more links are
+// removed once the context is done
+func RemoveLinksContext(ctx context.Context, device devices.Linkable, remove ...insteon.LinkRecord) error {
+	links, err := linksContext(ctx, device)
 	if err == nil {
 		removeLinks := []insteon.LinkRecord{}
 		for i, link := range links {
@@ -412,22 +464,69 @@ func RemoveLinks(device devices.Linkable, remove ...insteon.LinkRecord) error {
 				if link.Equal(&r) {
 					link.Flags.SetAvailable()
 					if wl, ok := device.(devices.WriteLink); ok {
-						wl.WriteLink(i, link)
+						if err = ctx.Err(); err == nil {
+							err = wl.WriteLink(i, link)
+						}
 					} else {
 						removeLinks = append(removeLinks, link)
 					}
 					break
 				}
 			}
+
+			if err != nil {
+				return err
+			}
 		}
 
 		if len(removeLinks) > 0 {
-			err = device.UpdateLinks(removeLinks...)
+			err = updateLinks(ctx, device, removeLinks...)
 		}
 	}
 	return err
 }
 
+// linksContext retrieves the links from the device, passing the context
+// along if the device supports it
+func linksContext(ctx context.Context, device devices.Linkable) ([]insteon.LinkRecord, error) {
+	if cl, ok := device.(devices.ContextLinkable); ok {
+		return cl.LinksContext(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return device.Links()
+}
+
+// updateLinks updates the device's link database, passing the context
+// along if the device supports it
+func updateLinks(ctx context.Context, device devices.Linkable, links ...insteon.LinkRecord) error {
+	if ul, ok := device.(interface {
+		UpdateLinksContext(context.Context, ...insteon.LinkRecord) error
+	}); ok {
+		return ul.UpdateLinksContext(ctx, links...)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return device.UpdateLinks(links...)
+}
+
+// enterLinkingMode puts the device into linking mode, passing the context
+// along if the device supports it
+func enterLinkingMode(ctx context.Context, device devices.Linkable, group insteon.Group) error {
+	if cl, ok := device.(devices.ContextLinkable); ok {
+		return cl.EnterLinkingModeContext(ctx, group)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return device.EnterLinkingMode(group)
+}
+
 func DumpLinkDatabase(out io.Writer, linkable devices.Linkable) error {
 	links, err := linkable.Links()
 	if err == nil {
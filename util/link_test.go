@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -179,6 +180,82 @@ func TestForceLinkUnlink(t *testing.T) {
 	}
 }
 
+func TestLinkContextCancelled(t *testing.T) {
+	got := &cmdLogger{}
+	controller := &testLinkable{name: "controller", commands: got}
+	responder := &testLinkable{name: "responder", commands: got}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := LinkContext(ctx, 2, controller, responder)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Wanted error %v got %v", context.Canceled, err)
+	}
+
+	if len(got.commands) > 0 {
+		t.Errorf("Wanted no commands got %q", got.commands)
+	}
+}
+
+func TestLinkContextCancelledCleanup(t *testing.T) {
+	got := &cmdLogger{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the controller link exists without a responder link, so it is
+	// removed before linking.  Reading the responder's links cancels
+	// the context
+	controller := &testWritableLinkable{&testLinkable{address: insteon.Address(1), name: "controller", commands: got, links: []insteon.LinkRecord{insteon.ControllerLink(1, insteon.Address(2))}}}
+	responder := &cancellingLinkable{&testContextLinkable{testLinkable: &testLinkable{address: insteon.Address(2), name: "responder", commands: got}, cancel: cancel}}
+
+	err := LinkContext(ctx, 1, controller, responder)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Wanted error %v got %v", context.Canceled, err)
+	}
+
+	if len(got.commands) > 0 {
+		t.Errorf("Wanted no commands got %q", got.commands)
+	}
+}
+
+func TestForceLinkContextCancelled(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel string
+		want   []string
+	}{
+		{"controller", "controller", []string{"controller EnterLinkingMode 2", "controller ExitLinkingMode"}},
+		{"responder", "responder", []string{"controller EnterLinkingMode 2", "responder EnterLinkingMode 2", "controller ExitLinkingMode", "responder ExitLinkingMode"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			got := &cmdLogger{}
+			controller := &testContextLinkable{testLinkable: &testLinkable{name: "controller", commands: got}}
+			responder := &testContextLinkable{testLinkable: &testLinkable{name: "responder", commands: got}}
+			if test.cancel == "controller" {
+				controller.cancel = cancel
+			} else {
+				responder.cancel = cancel
+			}
+
+			err := ForceLinkContext(ctx, 2, controller, responder)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Wanted error %v got %v", context.Canceled, err)
+			}
+
+			wantStr := strings.Join(test.want, " ")
+			gotStr := strings.Join(got.commands, " ")
+			if wantStr != gotStr {
+				t.Errorf("Wanted commands %q got %q", wantStr, gotStr)
+			}
+		})
+	}
+}
+
 func TestLinksToText(t *testing.T) {
 	links := []insteon.LinkRecord{
 		{Flags: insteon.UnavailableController, Group: 1, Address: insteon.Address(0x010203)},
@@ -397,6 +474,44 @@ func (tl *testLinkable) WriteLinks(links ...insteon.LinkRecord) error {
 	return nil
 }
 
+// testContextLinkable is cancelled while waiting in linking mode, after
+// the command to enter linking mode has been sent
+type testContextLinkable struct {
+	*testLinkable
+	cancel context.CancelFunc
+}
+
+func (tcl *testContextLinkable) EnterLinkingModeContext(ctx context.Context, group insteon.Group) error {
+	tcl.EnterLinkingMode(group)
+	if tcl.cancel != nil {
+		tcl.cancel()
+		<-ctx.Done()
+	}
+	return ctx.Err()
+}
+
+func (tcl *testContextLinkable) EnterUnlinkingModeContext(ctx context.Context, group insteon.Group) error {
+	return tcl.EnterUnlinkingMode(group)
+}
+
+func (tcl *testContextLinkable) ExitLinkingModeContext(ctx context.Context) error {
+	return tcl.ExitLinkingMode()
+}
+
+func (tcl *testContextLinkable) LinksContext(ctx context.Context) ([]insteon.LinkRecord, error) {
+	return tcl.Links()
+}
+
+// cancellingLinkable cancels the context once its links have been read
+type cancellingLinkable struct {
+	*testContextLinkable
+}
+
+func (cl *cancellingLinkable) LinksContext(ctx context.Context) ([]insteon.LinkRecord, error) {
+	cl.cancel()
+	return cl.Links()
+}
+
 type testWritableLinkable struct {
 	*testLinkable
 }